@@ -0,0 +1,153 @@
+package admin_handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/github"
+	"github.com/macwilko/issues-sync/internal_handlers/helpers"
+	"github.com/macwilko/issues-sync/tasks"
+)
+
+// TriggerBackfill starts importing every existing issue of a repository from
+// the GitHub REST API. A backfill that's already underway is resumed from its
+// checkpoint, a finished or failed one starts over.
+func TriggerBackfill(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, queue *asynq.Client, inspector *asynq.Inspector) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if provider != forge.ProviderGithub {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "backfill is only supported for github",
+		})
+	}
+
+	// The worker's client only talks to the host GITHUB_API_URL serves
+	if configured := github.Host(os.Getenv("GITHUB_API_URL")); host != configured {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "backfill is only supported for " + configured,
+		})
+	}
+
+	slog.Info("💡 Starting - trigger backfill",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	backfill := models.Backfills{}
+
+	err = db.GetContext(ctx, &backfill, `
+	INSERT INTO backfills
+		(provider, host, repo_owner, repo_name, status)
+	VALUES
+		($1, $2, $3, $4, $5)
+	ON CONFLICT (provider, host, repo_owner, repo_name) DO UPDATE
+	SET status=$5, started_at=NULL, finished_at=NULL, next_page_url=NULL, pages=0, issues_seen=0,
+		pull_requests_skipped=0, rate_limited_until=NULL, last_error=NULL, updated_at=now()
+	WHERE backfills.status IN ($6, $7)
+	RETURNING *
+	`, provider, host, owner, name, tasks.BackfillQueued, tasks.BackfillCompleted, tasks.BackfillFailed)
+
+	if err == sql.ErrNoRows {
+		err = db.GetContext(ctx, &backfill, "SELECT * FROM backfills WHERE provider=$1 AND host=$2 AND repo_owner=$3 AND repo_name=$4",
+			provider, host, owner, name)
+	}
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	err = tasks.EnqueueGithubBackfill(ctx, queue, inspector, backfill)
+
+	if err != nil {
+		slog.Error("💀 Could not enqueue backfill",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()))
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - trigger backfill",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	return c.
+		Status(fiber.StatusAccepted).
+		JSON(&fiber.Map{"backfill": backfill.ToMap()})
+}
+
+// Backfill reports how far a repository's backfill has got.
+func Backfill(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	backfill := models.Backfills{}
+
+	err = db.GetContext(ctx, &backfill, "SELECT * FROM backfills WHERE provider=$1 AND host=$2 AND repo_owner=$3 AND repo_name=$4",
+		provider, host, owner, name)
+
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	} else if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"backfill": backfill.ToMap()})
+}
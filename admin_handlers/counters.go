@@ -0,0 +1,33 @@
+package admin_handlers
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macwilko/issues-sync/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+func Counters(c *fiber.Ctx, ctx context.Context, rdb *redis.Client) error {
+
+	slog.Info("💡 Starting - read counters")
+
+	counters, err := metrics.Counters(ctx, rdb)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - read counters")
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"counters": counters})
+}
@@ -0,0 +1,183 @@
+package admin_handlers
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/internal_handlers/helpers"
+	"github.com/macwilko/issues-sync/tasks"
+)
+
+// CreateImport accepts a JSONL file of GitHub issues or a GitHub migration
+// archive, either as the request body or as the "file" field of a multipart
+// form, and queues it for import.
+func CreateImport(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, queue *asynq.Client) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	format := c.Query("format", tasks.ImportFormatJSONL)
+
+	if format != tasks.ImportFormatJSONL && format != tasks.ImportFormatArchive {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "format must be jsonl or archive",
+		})
+	}
+
+	payload, err := importPayload(c)
+
+	if err != nil || len(payload) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "nothing to import",
+		})
+	}
+
+	slog.Info("💡 Starting - create import",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.String("format", format),
+		slog.Int("bytes", len(payload)))
+
+	report := models.Imports{}
+
+	err = db.GetContext(ctx, &report, `
+	INSERT INTO imports
+		(provider, host, repo_owner, repo_name, format, status, payload)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+	RETURNING *
+	`, provider, host, owner, name, format, tasks.ImportQueued, payload)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	task, err := tasks.NewImportIssues(report.ID)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	_, err = queue.Enqueue(task, asynq.Queue("low"), asynq.Timeout(6*time.Hour))
+
+	if err != nil {
+		slog.Error("💀 Could not enqueue import",
+			slog.Uint64("import_id", report.ID),
+			slog.String("error", err.Error()))
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	json, err := report.ToMap()
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - create import",
+		slog.Uint64("import_id", report.ID))
+
+	return c.
+		Status(fiber.StatusAccepted).
+		JSON(&fiber.Map{"import": json})
+}
+
+func importPayload(c *fiber.Ctx) ([]byte, error) {
+	file, err := c.FormFile("file")
+
+	if err != nil {
+		// Not a multipart upload, the body is the file
+		return append([]byte(nil), c.Body()...), nil
+	}
+
+	f, err := file.Open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// Import reports how an import went, with the records that failed.
+func Import(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	id, err := c.ParamsInt("id")
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	report := models.Imports{}
+
+	err = db.GetContext(ctx, &report, `
+	SELECT id, provider, host, repo_owner, repo_name, format, status, created_at, started_at, finished_at, records,
+		issues_imported, comments_imported, records_skipped, records_failed, errors, last_error
+	FROM imports WHERE id=$1
+	`, id)
+
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	} else if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.Int("import_id", id),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	json, err := report.ToMap()
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"import": json})
+}
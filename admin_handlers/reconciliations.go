@@ -0,0 +1,80 @@
+package admin_handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/internal_handlers/helpers"
+)
+
+const maxReconciliationsPerPage = 100
+
+// Reconciliations lists a repository's most recent drift reconciliation
+// reports, newest first.
+func Reconciliations(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	slog.Info("💡 Starting - list reconciliations",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	limit := c.QueryInt("limit", 20)
+
+	if limit <= 0 || limit > maxReconciliationsPerPage {
+		limit = maxReconciliationsPerPage
+	}
+
+	reports := []models.Reconciliations{}
+
+	err = db.SelectContext(ctx, &reports, `
+	SELECT * FROM reconciliations
+	WHERE provider=$1 AND host=$2 AND repo_owner=$3 AND repo_name=$4
+	ORDER BY started_at DESC
+	LIMIT $5
+	`, provider, host, owner, name, limit)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	reportsJson := []interface{}{}
+
+	for _, report := range reports {
+		reportsJson = append(reportsJson, report.ToMap())
+	}
+
+	slog.Info("✅ Finished - list reconciliations",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"reconciliations": reportsJson})
+}
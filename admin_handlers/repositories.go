@@ -0,0 +1,167 @@
+package admin_handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/github"
+	"github.com/macwilko/issues-sync/internal_handlers/helpers"
+)
+
+type UpdateRepositoryInput struct {
+	IngestionMode string `json:"ingestion_mode" validate:"required,oneof=webhook poll"`
+}
+
+// Repository shows how a repository's issues are ingested, repositories that
+// were never configured are fed by webhooks.
+func Repository(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	repository := models.Repositories{}
+
+	err = db.GetContext(ctx, &repository, "SELECT * FROM repositories WHERE provider=$1 AND host=$2 AND repo_owner=$3 AND repo_name=$4",
+		provider, host, owner, name)
+
+	if err == sql.ErrNoRows {
+		now := time.Now()
+
+		repository = models.Repositories{
+			Provider:      provider,
+			Host:          host,
+			RepoOwner:     owner,
+			RepoName:      name,
+			IngestionMode: models.IngestionModeWebhook,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+	} else if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(repository.ToMap())
+}
+
+// UpdateRepository switches a repository between webhook and poll ingestion.
+// Switching to poll schedules the first poll straight away.
+func UpdateRepository(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	slog.Info("💡 Starting - update repository",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	input := new(UpdateRepositoryInput)
+
+	if err := c.BodyParser(input); err != nil {
+		slog.Warn("Invalid input 💀")
+
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "invalid input",
+		})
+	}
+
+	if err := validator.New().Struct(input); err != nil {
+		slog.Warn("Invalid input 💀",
+			slog.String("error", err.Error()))
+
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "ingestion_mode must be webhook or poll",
+		})
+	}
+
+	if input.IngestionMode == models.IngestionModePoll && provider != forge.ProviderGithub {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "polling is only supported for github",
+		})
+	}
+
+	// The worker's client only talks to the host GITHUB_API_URL serves
+	if configured := github.Host(os.Getenv("GITHUB_API_URL")); input.IngestionMode == models.IngestionModePoll && host != configured {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "polling is only supported for " + configured,
+		})
+	}
+
+	repository := models.Repositories{}
+
+	err = db.GetContext(ctx, &repository, `
+	INSERT INTO repositories
+		(provider, host, repo_owner, repo_name, ingestion_mode, next_poll_at)
+	VALUES
+		($1, $2, $3, $4, $5, now())
+	ON CONFLICT (provider, host, repo_owner, repo_name) DO UPDATE
+	SET ingestion_mode=$5, updated_at=now(),
+		next_poll_at=CASE WHEN repositories.ingestion_mode <> $5 THEN now() ELSE repositories.next_poll_at END
+	RETURNING
+		*
+	`, provider, host, owner, name, input.IngestionMode)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - update repository",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.String("ingestion_mode", repository.IngestionMode))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(repository.ToMap())
+}
@@ -0,0 +1,279 @@
+package admin_handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/internal_handlers/helpers"
+	"github.com/macwilko/issues-sync/search"
+	"github.com/macwilko/issues-sync/tasks"
+)
+
+// searchSettingsRepo is the repository in the route, or the empty one the
+// defaults are stored under when there's none.
+func searchSettingsRepo(c *fiber.Ctx) (search.Repo, int, error) {
+	if c.Params("owner") == "" {
+		return search.Repo{}, 0, nil
+	}
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return search.Repo{}, fiber.StatusNotFound, err
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return search.Repo{}, fiber.StatusBadRequest, err
+	}
+
+	return search.Repo{Provider: provider, Host: host, Owner: owner, Name: name}, 0, nil
+}
+
+func searchSettingsJson(ctx context.Context, db *sqlx.DB, repo search.Repo, row models.SearchIndexSettings) (*fiber.Map, error) {
+	json, err := row.ToMap()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// What the index gets, the defaults with the repository's laid over
+	effective, err := search.LoadIndexSettings(ctx, db, repo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	(*json)["effective"] = effective
+
+	return json, nil
+}
+
+// enqueueApplySearchSettings has the worker apply the settings to the
+// repository's index, or to every index when the defaults changed.
+func enqueueApplySearchSettings(queue *asynq.Client, repo search.Repo) error {
+	task, err := tasks.NewApplySearchSettings(repo.Provider, repo.Host, repo.Owner, repo.Name)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = queue.Enqueue(task, asynq.Timeout(time.Hour))
+
+	return err
+}
+
+// SearchSettings shows the search settings stored for a repository, or the
+// defaults, with the effective settings its index gets.
+func SearchSettings(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	repo, status, err := searchSettingsRepo(c)
+
+	if err != nil {
+		return c.Status(status).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	row := models.SearchIndexSettings{}
+
+	err = db.GetContext(ctx, &row, "SELECT * FROM search_index_settings WHERE provider=$1 AND host=$2 AND repo_owner=$3 AND repo_name=$4",
+		repo.Provider, repo.Host, repo.Owner, repo.Name)
+
+	if err == sql.ErrNoRows {
+		now := time.Now()
+
+		row = models.SearchIndexSettings{
+			Provider:  repo.Provider,
+			Host:      repo.Host,
+			RepoOwner: repo.Owner,
+			RepoName:  repo.Name,
+			Settings:  []byte("{}"),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	} else if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", repo.Owner),
+			slog.String("name", repo.Name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	settingsJson, err := searchSettingsJson(ctx, db, repo, row)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", repo.Owner),
+			slog.String("name", repo.Name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(settingsJson)
+}
+
+// UpdateSearchSettings replaces the search settings stored for a repository,
+// or the defaults, and applies them in the background.
+func UpdateSearchSettings(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, queue *asynq.Client) error {
+
+	repo, status, err := searchSettingsRepo(c)
+
+	if err != nil {
+		return c.Status(status).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	slog.Info("💡 Starting - update search settings",
+		slog.String("owner", repo.Owner),
+		slog.String("name", repo.Name))
+
+	settings, err := search.ParseIndexSettings(c.Body())
+
+	if err != nil {
+		slog.Warn("Invalid input 💀",
+			slog.String("error", err.Error()))
+
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "invalid input",
+		})
+	}
+
+	if err := settings.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	encoded, err := json.Marshal(settings)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "invalid input",
+		})
+	}
+
+	row := models.SearchIndexSettings{}
+
+	err = db.GetContext(ctx, &row, `
+	INSERT INTO search_index_settings
+		(provider, host, repo_owner, repo_name, settings)
+	VALUES
+		($1, $2, $3, $4, $5)
+	ON CONFLICT (provider, host, repo_owner, repo_name) DO UPDATE
+	SET settings=$5, updated_at=now()
+	RETURNING
+		*
+	`, repo.Provider, repo.Host, repo.Owner, repo.Name, string(encoded))
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", repo.Owner),
+			slog.String("name", repo.Name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	if err := enqueueApplySearchSettings(queue, repo); err != nil {
+		// The next reindex or worker start applies them anyway
+		slog.Warn("💀 Could not enqueue apply search settings",
+			slog.String("error", err.Error()))
+	}
+
+	settingsJson, err := searchSettingsJson(ctx, db, repo, row)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", repo.Owner),
+			slog.String("name", repo.Name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - update search settings",
+		slog.String("owner", repo.Owner),
+		slog.String("name", repo.Name))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(settingsJson)
+}
+
+// DeleteSearchSettings drops a repository's settings, so it goes back to the
+// defaults, or drops the defaults.
+func DeleteSearchSettings(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, queue *asynq.Client) error {
+
+	repo, status, err := searchSettingsRepo(c)
+
+	if err != nil {
+		return c.Status(status).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	slog.Info("💡 Starting - delete search settings",
+		slog.String("owner", repo.Owner),
+		slog.String("name", repo.Name))
+
+	result, err := db.ExecContext(ctx, "DELETE FROM search_index_settings WHERE provider=$1 AND host=$2 AND repo_owner=$3 AND repo_name=$4",
+		repo.Provider, repo.Host, repo.Owner, repo.Name)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", repo.Owner),
+			slog.String("name", repo.Name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	if err := enqueueApplySearchSettings(queue, repo); err != nil {
+		// The next reindex or worker start applies them anyway
+		slog.Warn("💀 Could not enqueue apply search settings",
+			slog.String("error", err.Error()))
+	}
+
+	slog.Info("✅ Finished - delete search settings",
+		slog.String("owner", repo.Owner),
+		slog.String("name", repo.Name))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"message": "deleted"})
+}
@@ -50,7 +50,15 @@ func TriggerReindex(c *fiber.Ctx, queue *asynq.Client, db *sqlx.DB) error {
 		})
 	}
 
-	task, err := tasks.NewReindexSearchDatabase(owner, name)
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	task, err := tasks.NewReindexSearchDatabase(provider, host, owner, name)
 
 	if err != nil {
 		slog.Info("💀 Could not enqueue search reindex",
@@ -61,7 +69,8 @@ func TriggerReindex(c *fiber.Ctx, queue *asynq.Client, db *sqlx.DB) error {
 		})
 	}
 
-	info, err := queue.Enqueue(task, asynq.Unique(time.Hour))
+	// Streams every issue, big repositories take a while
+	info, err := queue.Enqueue(task, asynq.Unique(time.Hour), asynq.Timeout(2*time.Hour))
 
 	if err != nil {
 		switch {
@@ -0,0 +1,250 @@
+package admin_handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/tasks"
+)
+
+const (
+	maxDeliveriesPerPage = 500
+	maxDeliveriesReplay  = 1000
+)
+
+const selectDeliveries = `
+SELECT id, delivery_id, provider, event, received_at, enqueued_at, processed_at, status, attempts, last_error, repo_owner, repo_name
+FROM webhook_deliveries
+WHERE received_at >= $1 AND received_at < $2 AND ($3 = '' OR status = $3)
+ORDER BY received_at ASC
+LIMIT $4
+`
+
+// deliveriesRange reads ?since= and ?until= as RFC3339, defaulting to the
+// last 24 hours.
+func deliveriesRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+	until := time.Now()
+	since := until.Add(-24 * time.Hour)
+
+	if v := c.Query("since"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+
+		if err != nil {
+			return since, until, err
+		}
+
+		since = parsed
+	}
+
+	if v := c.Query("until"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+
+		if err != nil {
+			return since, until, err
+		}
+
+		until = parsed
+	}
+
+	return since, until, nil
+}
+
+func WebhookDeliveries(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	slog.Info("💡 Starting - list webhook deliveries")
+
+	since, until, err := deliveriesRange(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "since and until must be RFC3339 timestamps",
+		})
+	}
+
+	limit := c.QueryInt("limit", 50)
+
+	if limit <= 0 || limit > maxDeliveriesPerPage {
+		limit = maxDeliveriesPerPage
+	}
+
+	deliveries := []models.WebhookDeliveries{}
+
+	err = db.SelectContext(ctx, &deliveries, selectDeliveries, since, until, c.Query("status"), limit)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	deliveriesJson := []interface{}{}
+
+	for _, delivery := range deliveries {
+		deliveriesJson = append(deliveriesJson, delivery.ToMap())
+	}
+
+	slog.Info("✅ Finished - list webhook deliveries")
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"deliveries": deliveriesJson})
+}
+
+func WebhookDelivery(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	deliveryID := utils.CopyString(c.Params("delivery"))
+
+	slog.Info("💡 Starting - inspect webhook delivery",
+		slog.String("delivery", deliveryID))
+
+	delivery := models.WebhookDeliveries{}
+
+	err := db.GetContext(ctx, &delivery, "SELECT * FROM webhook_deliveries WHERE delivery_id=$1", deliveryID)
+
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	} else if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("delivery", deliveryID),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - inspect webhook delivery",
+		slog.String("delivery", deliveryID))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(delivery.ToDetailMap())
+}
+
+func ReplayWebhookDelivery(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, queue *asynq.Client) error {
+
+	deliveryID := utils.CopyString(c.Params("delivery"))
+
+	slog.Info("💡 Starting - replay webhook delivery",
+		slog.String("delivery", deliveryID))
+
+	delivery := models.WebhookDeliveries{}
+
+	err := db.GetContext(ctx, &delivery, "SELECT provider, event FROM webhook_deliveries WHERE delivery_id=$1", deliveryID)
+
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	} else if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("delivery", deliveryID),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	err = tasks.EnqueueWebhookDelivery(ctx, db, queue, delivery.Provider, delivery.Event, deliveryID, true)
+
+	if errors.Is(err, tasks.ErrUnhandledGithubEvent) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(&fiber.Map{
+			"message": "event is not handled",
+		})
+	} else if err != nil {
+		slog.Error("💀 Could not enqueue delivery replay",
+			slog.String("delivery", deliveryID),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - replay webhook delivery",
+		slog.String("delivery", deliveryID))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"message": "queued"})
+}
+
+func ReplayWebhookDeliveries(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, queue *asynq.Client) error {
+
+	slog.Info("💡 Starting - replay webhook deliveries")
+
+	if c.Query("since") == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "since is required",
+		})
+	}
+
+	since, until, err := deliveriesRange(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "since and until must be RFC3339 timestamps",
+		})
+	}
+
+	deliveries := []models.WebhookDeliveries{}
+
+	err = db.SelectContext(ctx, &deliveries, selectDeliveries, since, until, c.Query("status"), maxDeliveriesReplay)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	replayed := []string{}
+
+	for _, delivery := range deliveries {
+		err := tasks.EnqueueWebhookDelivery(ctx, db, queue, delivery.Provider, delivery.Event, delivery.DeliveryID, true)
+
+		if errors.Is(err, tasks.ErrUnhandledGithubEvent) {
+			continue
+		} else if err != nil {
+			slog.Error("💀 Could not enqueue delivery replay",
+				slog.String("delivery", delivery.DeliveryID),
+				slog.String("error", err.Error()),
+			)
+
+			return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+				"message":  "an internal error happened",
+				"replayed": replayed,
+			})
+		}
+
+		replayed = append(replayed, delivery.DeliveryID)
+	}
+
+	slog.Info("✅ Finished - replay webhook deliveries",
+		slog.Int("replayed", len(replayed)))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"message": "queued", "replayed": replayed})
+}
@@ -0,0 +1,207 @@
+package admin_handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/internal_handlers/helpers"
+)
+
+type CreateWebhookSecretInput struct {
+	Secret string `json:"secret" validate:"required,min=16,max=255"`
+}
+
+func WebhookSecrets(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	slog.Info("💡 Starting - list webhook secrets",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	secrets := []models.WebhookSecrets{}
+
+	err = db.SelectContext(ctx, &secrets, "SELECT * FROM webhook_secrets WHERE repo_owner=$1 AND repo_name=$2 AND provider=$3 AND host=$4 ORDER BY created_at DESC",
+		owner, name, provider, host)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	secretsJson := []interface{}{}
+
+	for _, secret := range secrets {
+		secretsJson = append(secretsJson, secret.ToMap())
+	}
+
+	slog.Info("✅ Finished - list webhook secrets",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"secrets": secretsJson})
+}
+
+func CreateWebhookSecret(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	slog.Info("💡 Starting - create webhook secret",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	input := new(CreateWebhookSecretInput)
+
+	if err := c.BodyParser(input); err != nil {
+		slog.Warn("Invalid input 💀")
+
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "invalid input",
+		})
+	}
+
+	if err := validator.New().Struct(input); err != nil {
+		slog.Warn("Invalid input 💀",
+			slog.String("error", err.Error()))
+
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "secret must be between 16 and 255 characters",
+		})
+	}
+
+	secret := models.WebhookSecrets{}
+
+	err = db.QueryRowxContext(ctx, `
+	INSERT INTO webhook_secrets
+		(repo_owner, repo_name, secret, provider, host)
+	VALUES
+		($1, $2, $3, $4, $5)
+	RETURNING
+		*
+	`, owner, name, input.Secret, provider, host).StructScan(&secret)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - create webhook secret",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Uint64("secret_id", secret.ID))
+
+	return c.
+		Status(fiber.StatusCreated).
+		JSON(secret.ToMap())
+}
+
+func DeleteWebhookSecret(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	id, err := c.ParamsInt("id")
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	slog.Info("💡 Starting - delete webhook secret",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Int("secret_id", id))
+
+	result, err := db.ExecContext(ctx, "DELETE FROM webhook_secrets WHERE id=$1 AND repo_owner=$2 AND repo_name=$3 AND provider=$4 AND host=$5",
+		id, owner, name, provider, host)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	slog.Info("✅ Finished - delete webhook secret",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Int("secret_id", id))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"message": "deleted"})
+}
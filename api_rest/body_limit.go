@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// Fiber's own default
+	defaultBodyLimit = 4 * 1024 * 1024
+	// Imports upload whole JSONL files and migration archives
+	importBodyLimit = 256 * 1024 * 1024
+)
+
+var importRoute = regexp.MustCompile(`^/v1/admin/repo/[^/]+/[^/]+/imports/?$`)
+
+// bodyLimit reads request bodies, which the server streams, up to the route's
+// limit. Only the import upload gets more than the default, so nothing else
+// can be made to buffer a large body.
+func bodyLimit() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		request := c.Request()
+
+		if !request.IsBodyStream() {
+			return c.Next()
+		}
+
+		limit := defaultBodyLimit
+
+		if c.Method() == fiber.MethodPost && importRoute.MatchString(c.Path()) {
+			limit = importBodyLimit
+		}
+
+		if request.Header.ContentLength() > limit {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(&fiber.Map{
+				"message": "request body too large",
+			})
+		}
+
+		// Chunked bodies have no length up front, read one byte past the limit
+		body, err := io.ReadAll(io.LimitReader(request.BodyStream(), int64(limit)+1))
+
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+				"message": "unable to read request body",
+			})
+		}
+
+		if len(body) > limit {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(&fiber.Map{
+				"message": "request body too large",
+			})
+		}
+
+		request.SetBody(body)
+
+		return c.Next()
+	}
+}
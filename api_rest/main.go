@@ -27,6 +27,8 @@ import (
 	"github.com/valyala/fasthttp"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/search"
 )
 
 func main() {
@@ -56,27 +58,31 @@ func main() {
 
 	defer db.Close()
 
-	slog.Info("🚀 Connecting to Meilisearch ✅")
+	var meili *meilisearch.Client
 
-	fasthttpClient := &fasthttp.Client{
-		Name:             "meilisearch-client",
-		DialDualStack:    true,
-		ConnPoolStrategy: fasthttp.LIFO,
-	}
-
-	meili := meilisearch.NewFastHTTPCustomClient(meilisearch.ClientConfig{
-		Host:   os.Getenv("MEILI_PRIVATE_URL"),
-		APIKey: os.Getenv("MEILI_API_KEY"),
-	}, fasthttpClient)
+	// Without meilisearch, search runs on Postgres alone
+	if os.Getenv("MEILI_PRIVATE_URL") != "" {
+		slog.Info("🚀 Connecting to Meilisearch ✅")
 
-	healthy := meili.IsHealthy()
+		fasthttpClient := &fasthttp.Client{
+			Name:             "meilisearch-client",
+			DialDualStack:    true,
+			ConnPoolStrategy: fasthttp.LIFO,
+		}
 
-	if !healthy {
-		slog.Error("Unable to connect to meili")
+		meili = meilisearch.NewFastHTTPCustomClient(meilisearch.ClientConfig{
+			Host:   os.Getenv("MEILI_PRIVATE_URL"),
+			APIKey: os.Getenv("MEILI_API_KEY"),
+		}, fasthttpClient)
 
-		os.Exit(1)
+		// Searches fail over to Postgres until it's up, see search.Failover
+		if !meili.IsHealthy() {
+			slog.Warn("💀 Unable to connect to meili, starting anyway")
+		}
 	}
 
+	backend := search.NewBackend(db, meili)
+
 	slog.Info("🚀 Connecting to Redis ✅")
 
 	redisOpts, err := redis.ParseURL(os.Getenv("REDIS_PRIVATE_URL"))
@@ -100,13 +106,33 @@ func main() {
 
 	defer queue.Close()
 
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{
+		Network:  redisOpts.Network,
+		Addr:     redisOpts.Addr,
+		Username: redisOpts.Username,
+		Password: redisOpts.Password,
+		DB:       redisOpts.DB,
+	})
+
+	defer inspector.Close()
+
+	rdb := redis.NewClient(redisOpts)
+
+	defer rdb.Close()
+
 	slog.Info("🚀 Starting web server ✅")
 
 	app := fiber.New(fiber.Config{
 		Network: "tcp",
+		// Bodies are read by bodyLimit, which lets only the import upload
+		// be larger than the default
+		BodyLimit:                    defaultBodyLimit,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
 
 	app.Use(recover.New(recover.Config{EnableStackTrace: true}))
+	app.Use(bodyLimit())
 	app.Use(logger.New())
 	app.Use(idempotency.New())
 	app.Use(requestid.New())
@@ -144,8 +170,21 @@ func main() {
 
 	v1.Mount("/webhooks", webhooks)
 
+	webhooks.Post("/github", func(c *fiber.Ctx) error {
+		return webhook_handlers.Github(c, ctx, db, rdb, queue)
+	})
+
+	// Kept for hooks that were installed before events were routed by header
 	webhooks.Post("/github/issues", func(c *fiber.Ctx) error {
-		return webhook_handlers.GithubIssues(c, queue)
+		return webhook_handlers.Github(c, ctx, db, rdb, queue)
+	})
+
+	webhooks.Post("/gitlab", func(c *fiber.Ctx) error {
+		return webhook_handlers.Forge(c, ctx, db, rdb, queue, forge.Gitlab{})
+	})
+
+	webhooks.Post("/gitea", func(c *fiber.Ctx) error {
+		return webhook_handlers.Forge(c, ctx, db, rdb, queue, forge.Gitea{})
 	})
 
 	internal := fiber.New()
@@ -153,7 +192,43 @@ func main() {
 	v1.Mount("/internal", internal)
 
 	internal.Get("/repo/:owner/:name/issues", func(c *fiber.Ctx) error {
-		return internal_handlers.Issues(c, ctx, db, meili)
+		return internal_handlers.Issues(c, ctx, db, backend)
+	})
+
+	internal.Get("/repo/:owner/:name/issues/export", func(c *fiber.Ctx) error {
+		return internal_handlers.ExportIssues(c, ctx, db)
+	})
+
+	internal.Get("/repo/:owner/:name/issues/:number/comments", func(c *fiber.Ctx) error {
+		return internal_handlers.IssueComments(c, ctx, db)
+	})
+
+	internal.Get("/repo/:owner/:name/issues/:number/timeline", func(c *fiber.Ctx) error {
+		return internal_handlers.IssueTimeline(c, ctx, db)
+	})
+
+	internal.Get("/repo/:owner/:name/issues/:number/snapshot", func(c *fiber.Ctx) error {
+		return internal_handlers.IssueSnapshot(c, ctx, db)
+	})
+
+	internal.Get("/repo/:owner/:name/snapshot", func(c *fiber.Ctx) error {
+		return internal_handlers.RepoSnapshot(c, ctx, db)
+	})
+
+	internal.Get("/repo/:owner/:name/labels", func(c *fiber.Ctx) error {
+		return internal_handlers.Labels(c, ctx, db)
+	})
+
+	internal.Get("/repo/:owner/:name/milestones", func(c *fiber.Ctx) error {
+		return internal_handlers.Milestones(c, ctx, db)
+	})
+
+	internal.Get("/repo/:owner/:name/milestones/:number/issues", func(c *fiber.Ctx) error {
+		return internal_handlers.MilestoneIssues(c, ctx, db)
+	})
+
+	internal.Get("/actors/:login", func(c *fiber.Ctx) error {
+		return internal_handlers.Actor(c, ctx, db)
 	})
 
 	admin := fiber.New()
@@ -164,6 +239,90 @@ func main() {
 		return admin_handlers.TriggerReindex(c, queue, db)
 	})
 
+	admin.Get("/search/settings", func(c *fiber.Ctx) error {
+		return admin_handlers.SearchSettings(c, ctx, db)
+	})
+
+	admin.Put("/search/settings", func(c *fiber.Ctx) error {
+		return admin_handlers.UpdateSearchSettings(c, ctx, db, queue)
+	})
+
+	admin.Delete("/search/settings", func(c *fiber.Ctx) error {
+		return admin_handlers.DeleteSearchSettings(c, ctx, db, queue)
+	})
+
+	admin.Get("/repo/:owner/:name/search/settings", func(c *fiber.Ctx) error {
+		return admin_handlers.SearchSettings(c, ctx, db)
+	})
+
+	admin.Put("/repo/:owner/:name/search/settings", func(c *fiber.Ctx) error {
+		return admin_handlers.UpdateSearchSettings(c, ctx, db, queue)
+	})
+
+	admin.Delete("/repo/:owner/:name/search/settings", func(c *fiber.Ctx) error {
+		return admin_handlers.DeleteSearchSettings(c, ctx, db, queue)
+	})
+
+	admin.Get("/repo/:owner/:name", func(c *fiber.Ctx) error {
+		return admin_handlers.Repository(c, ctx, db)
+	})
+
+	admin.Put("/repo/:owner/:name", func(c *fiber.Ctx) error {
+		return admin_handlers.UpdateRepository(c, ctx, db)
+	})
+
+	admin.Get("/repo/:owner/:name/backfill", func(c *fiber.Ctx) error {
+		return admin_handlers.Backfill(c, ctx, db)
+	})
+
+	admin.Post("/repo/:owner/:name/backfill", func(c *fiber.Ctx) error {
+		return admin_handlers.TriggerBackfill(c, ctx, db, queue, inspector)
+	})
+
+	admin.Get("/repo/:owner/:name/reconciliations", func(c *fiber.Ctx) error {
+		return admin_handlers.Reconciliations(c, ctx, db)
+	})
+
+	admin.Post("/repo/:owner/:name/imports", func(c *fiber.Ctx) error {
+		return admin_handlers.CreateImport(c, ctx, db, queue)
+	})
+
+	admin.Get("/imports/:id", func(c *fiber.Ctx) error {
+		return admin_handlers.Import(c, ctx, db)
+	})
+
+	admin.Get("/repo/:owner/:name/webhook-secrets", func(c *fiber.Ctx) error {
+		return admin_handlers.WebhookSecrets(c, ctx, db)
+	})
+
+	admin.Post("/repo/:owner/:name/webhook-secrets", func(c *fiber.Ctx) error {
+		return admin_handlers.CreateWebhookSecret(c, ctx, db)
+	})
+
+	admin.Delete("/repo/:owner/:name/webhook-secrets/:id", func(c *fiber.Ctx) error {
+		return admin_handlers.DeleteWebhookSecret(c, ctx, db)
+	})
+
+	admin.Get("/webhooks/deliveries", func(c *fiber.Ctx) error {
+		return admin_handlers.WebhookDeliveries(c, ctx, db)
+	})
+
+	admin.Post("/webhooks/deliveries/replay", func(c *fiber.Ctx) error {
+		return admin_handlers.ReplayWebhookDeliveries(c, ctx, db, queue)
+	})
+
+	admin.Get("/webhooks/deliveries/:delivery", func(c *fiber.Ctx) error {
+		return admin_handlers.WebhookDelivery(c, ctx, db)
+	})
+
+	admin.Post("/webhooks/deliveries/:delivery/replay", func(c *fiber.Ctx) error {
+		return admin_handlers.ReplayWebhookDelivery(c, ctx, db, queue)
+	})
+
+	admin.Get("/counters", func(c *fiber.Ctx) error {
+		return admin_handlers.Counters(c, ctx, rdb)
+	})
+
 	port := ":5000"
 
 	if envPort := os.Getenv("PORT"); envPort != "" {
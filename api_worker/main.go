@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"log/slog"
@@ -11,6 +12,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/macwilko/issues-sync/github"
+	"github.com/macwilko/issues-sync/search"
 	"github.com/macwilko/issues-sync/tasks"
 	"github.com/meilisearch/meilisearch-go"
 	"github.com/redis/go-redis/v9"
@@ -42,27 +45,31 @@ func main() {
 
 	defer db.Close()
 
-	slog.Info("🚀 Connecting to Meilisearch ✅")
+	var meili *meilisearch.Client
 
-	fasthttpClient := &fasthttp.Client{
-		Name:             "meilisearch-client",
-		DialDualStack:    true,
-		ConnPoolStrategy: fasthttp.LIFO,
-	}
-
-	meili := meilisearch.NewFastHTTPCustomClient(meilisearch.ClientConfig{
-		Host:   os.Getenv("MEILI_PRIVATE_URL"),
-		APIKey: os.Getenv("MEILI_API_KEY"),
-	}, fasthttpClient)
+	// Without meilisearch, search runs on Postgres alone
+	if os.Getenv("MEILI_PRIVATE_URL") != "" {
+		slog.Info("🚀 Connecting to Meilisearch ✅")
 
-	healthy := meili.IsHealthy()
+		fasthttpClient := &fasthttp.Client{
+			Name:             "meilisearch-client",
+			DialDualStack:    true,
+			ConnPoolStrategy: fasthttp.LIFO,
+		}
 
-	if !healthy {
-		slog.Error("Unable to connect to meili")
+		meili = meilisearch.NewFastHTTPCustomClient(meilisearch.ClientConfig{
+			Host:   os.Getenv("MEILI_PRIVATE_URL"),
+			APIKey: os.Getenv("MEILI_API_KEY"),
+		}, fasthttpClient)
 
-		os.Exit(1)
+		// Searches fail over to Postgres until it's up, see search.Failover
+		if !meili.IsHealthy() {
+			slog.Warn("💀 Unable to connect to meili, starting anyway")
+		}
 	}
 
+	backend := search.NewBackend(db, meili)
+
 	slog.Info("🚀 Connecting to Redis ✅")
 
 	redisOpts, err := redis.ParseURL(os.Getenv("REDIS_PRIVATE_URL"))
@@ -85,7 +92,8 @@ func main() {
 			DB:       redisOpts.DB,
 		},
 		asynq.Config{
-			Concurrency: 20,
+			Concurrency:    20,
+			RetryDelayFunc: tasks.RetryDelay,
 			Queues: map[string]int{
 				"critical": 6,
 				"default":  3,
@@ -104,18 +112,167 @@ func main() {
 
 	defer queue.Close()
 
+	rdb := redis.NewClient(redisOpts)
+
+	defer rdb.Close()
+
+	gh := github.NewFromEnv(rdb)
+
+	scheduler := asynq.NewScheduler(
+		asynq.RedisClientOpt{
+			Network:  redisOpts.Network,
+			Addr:     redisOpts.Addr,
+			Username: redisOpts.Username,
+			Password: redisOpts.Password,
+			DB:       redisOpts.DB,
+		},
+		nil,
+	)
+
+	// Every replica runs a scheduler, Unique stops them piling up the same task
+	_, err = scheduler.Register("@every 1m", tasks.NewDrainWebhookDeliveries(), asynq.Unique(time.Minute), asynq.Queue("critical"))
+
+	if err != nil {
+		slog.Error("Unable to schedule webhook drainer",
+			slog.String("error", err.Error()))
+
+		panic(err)
+	}
+
+	_, err = scheduler.Register("@every 1m", tasks.NewPropagateActors(), asynq.Unique(time.Minute), asynq.Queue("low"))
+
+	if err != nil {
+		slog.Error("Unable to schedule actor propagation",
+			slog.String("error", err.Error()))
+
+		panic(err)
+	}
+
+	_, err = scheduler.Register("@every 30m", tasks.NewScheduleReconciliations(), asynq.Unique(30*time.Minute), asynq.Queue("low"))
+
+	if err != nil {
+		slog.Error("Unable to schedule reconciliations",
+			slog.String("error", err.Error()))
+
+		panic(err)
+	}
+
+	_, err = scheduler.Register("@every 15s", tasks.NewSchedulePolls(), asynq.Unique(15*time.Second), asynq.Queue("default"))
+
+	if err != nil {
+		slog.Error("Unable to schedule repository polls",
+			slog.String("error", err.Error()))
+
+		panic(err)
+	}
+
+	_, err = scheduler.Register("@every 5m", tasks.NewReplayDirtySearch(), asynq.Unique(5*time.Minute), asynq.Queue("low"))
+
+	if err != nil {
+		slog.Error("Unable to schedule dirty search replays",
+			slog.String("error", err.Error()))
+
+		panic(err)
+	}
+
+	if err := scheduler.Start(); err != nil {
+		slog.Error("Unable to start scheduler",
+			slog.String("error", err.Error()))
+
+		panic(err)
+	}
+
+	defer scheduler.Shutdown()
+
+	// Brings every index in line with the stored search settings, Unique
+	// stops replicas starting together from each doing it
+	applySettings, err := tasks.NewApplySearchSettings("", "", "", "")
+
+	if err == nil {
+		_, err = queue.Enqueue(applySettings, asynq.Unique(time.Minute), asynq.Timeout(time.Hour), asynq.Queue("low"))
+	}
+
+	if err != nil && !errors.Is(err, asynq.ErrDuplicateTask) {
+		slog.Warn("💀 Unable to enqueue applying search settings",
+			slog.String("error", err.Error()))
+	}
+
 	mux := asynq.NewServeMux()
 
 	mux.HandleFunc(tasks.ReindexSearchDatabase, func(ctx context.Context, t *asynq.Task) error {
-		return tasks.HandleReindexSearchDatabase(ctx, t, db, meili)
+		return tasks.HandleReindexSearchDatabase(ctx, t, db, backend)
+	})
+
+	mux.HandleFunc(tasks.ReplayDirtySearch, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleReplayDirtySearch(ctx, t, db, queue)
 	})
 
 	mux.HandleFunc(tasks.GithubProcessIssueUpdate, func(ctx context.Context, t *asynq.Task) error {
-		return tasks.HandleGithubProcessIssueUpdate(ctx, t, db, meili, queue)
+		return tasks.HandleGithubProcessIssueUpdate(ctx, t, db, rdb, queue)
+	})
+
+	mux.HandleFunc(tasks.GithubProcessIssueComment, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleGithubProcessIssueComment(ctx, t, db, rdb, queue)
+	})
+
+	mux.HandleFunc(tasks.GithubProcessLabel, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleGithubProcessLabel(ctx, t, db, queue)
+	})
+
+	mux.HandleFunc(tasks.GithubProcessMilestone, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleGithubProcessMilestone(ctx, t, db, queue)
+	})
+
+	mux.HandleFunc(tasks.ForgeProcessIssueEvent, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleForgeProcessIssueEvent(ctx, t, db, rdb, queue)
+	})
+
+	mux.HandleFunc(tasks.GithubBackfill, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleGithubBackfill(ctx, t, db, rdb, queue, gh)
+	})
+
+	mux.HandleFunc(tasks.GithubScheduleReconciliations, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleScheduleReconciliations(ctx, t, db, queue, gh)
+	})
+
+	mux.HandleFunc(tasks.GithubReconcile, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleGithubReconcile(ctx, t, db, rdb, queue, gh)
+	})
+
+	mux.HandleFunc(tasks.GithubSchedulePolls, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleSchedulePolls(ctx, t, db, queue)
+	})
+
+	mux.HandleFunc(tasks.GithubPollEvents, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleGithubPollEvents(ctx, t, db, rdb, queue, gh)
+	})
+
+	mux.HandleFunc(tasks.ImportIssues, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleImportIssues(ctx, t, db, rdb, backend)
+	})
+
+	mux.HandleFunc(tasks.PropagateActors, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandlePropagateActors(ctx, t, db, queue)
+	})
+
+	mux.HandleFunc(tasks.ForgeFetchActor, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleForgeFetchActor(ctx, t, db, queue)
+	})
+
+	mux.HandleFunc(tasks.DrainWebhookDeliveries, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleDrainWebhookDeliveries(ctx, t, db, queue)
 	})
 
 	mux.HandleFunc(tasks.ReindexIssue, func(ctx context.Context, t *asynq.Task) error {
-		return tasks.HandleReindexIssue(ctx, t, db, meili)
+		return tasks.HandleReindexIssue(ctx, t, db, backend)
+	})
+
+	mux.HandleFunc(tasks.DeleteIssueDocument, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleDeleteIssueDocument(ctx, t, backend)
+	})
+
+	mux.HandleFunc(tasks.ApplySearchSettings, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleApplySearchSettings(ctx, t, db, backend)
 	})
 
 	if err := srv.Run(mux); err != nil {
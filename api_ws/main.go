@@ -12,6 +12,8 @@ import (
 
 	_ "github.com/lib/pq"
 	chatserver "github.com/macwilko/issues-sync/chatserver"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/internal_handlers/helpers"
 	"github.com/macwilko/issues-sync/ws_handlers"
 
 	"github.com/gofiber/contrib/websocket"
@@ -30,6 +32,26 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// messageTopic is the topic a subscribe or unsubscribe message names, either
+// as is or as the repository's owner, name and optionally provider and host.
+func messageTopic(data map[string]string) (string, bool) {
+	if topic, ok := data["topic"]; ok {
+		return topic, true
+	}
+
+	if data["owner"] == "" || data["name"] == "" {
+		return "", false
+	}
+
+	provider, host, err := helpers.ParseForge(data["provider"], data["host"])
+
+	if err != nil {
+		return "", false
+	}
+
+	return forge.RepoTopic(provider, host, data["owner"], data["name"]), true
+}
+
 func runChatServer(server *chatserver.Server) {
 	slog.Info("🚀 Accepting ws connections ✅")
 
@@ -315,7 +337,7 @@ func main() {
 
 					switch messageType {
 					case "subscribe":
-						topic, ok := data["topic"]
+						topic, ok := messageTopic(data)
 
 						if !ok {
 							slog.Error("Not valid topic, unregister client")
@@ -328,7 +350,7 @@ func main() {
 							Connection: c,
 						}
 					case "unsubscribe":
-						topic, ok := data["topic"]
+						topic, ok := messageTopic(data)
 
 						if !ok {
 							slog.Error("Not valid topic, unregister client")
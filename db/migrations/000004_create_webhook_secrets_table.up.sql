@@ -0,0 +1,10 @@
+CREATE TABLE webhook_secrets
+(
+  id              BIGSERIAL PRIMARY KEY,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  repo_owner      VARCHAR(255) NOT NULL,
+  repo_name       VARCHAR(255) NOT NULL,
+  secret          VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX webhook_secrets_repo_idx ON webhook_secrets (repo_owner, repo_name);
@@ -0,0 +1,20 @@
+CREATE TABLE webhook_deliveries
+(
+  id              BIGSERIAL PRIMARY KEY,
+  delivery_id     VARCHAR(255) NOT NULL,
+  event           VARCHAR(100) NOT NULL,
+  received_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+  enqueued_at     TIMESTAMPTZ,
+  processed_at    TIMESTAMPTZ,
+  status          VARCHAR(32) NOT NULL DEFAULT 'pending',
+  attempts        INT NOT NULL DEFAULT 0,
+  last_error      TEXT,
+  repo_owner      VARCHAR(255),
+  repo_name       VARCHAR(255),
+  repo_scoped     BOOLEAN NOT NULL DEFAULT false,
+  payload         BYTEA NOT NULL
+);
+
+CREATE UNIQUE INDEX webhook_deliveries_delivery_id_idx ON webhook_deliveries (delivery_id);
+CREATE INDEX webhook_deliveries_status_idx ON webhook_deliveries (status, received_at);
+CREATE INDEX webhook_deliveries_received_at_idx ON webhook_deliveries (received_at);
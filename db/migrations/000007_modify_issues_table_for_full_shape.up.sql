@@ -0,0 +1,10 @@
+ALTER TABLE issues ADD COLUMN body TEXT;
+ALTER TABLE issues ADD COLUMN html_url VARCHAR(2000);
+ALTER TABLE issues ADD COLUMN state_reason VARCHAR(50);
+ALTER TABLE issues ADD COLUMN closed_at TIMESTAMPTZ;
+ALTER TABLE issues ADD COLUMN closed_by JSONB;
+ALTER TABLE issues ADD COLUMN milestone JSONB;
+ALTER TABLE issues ADD COLUMN locked BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE issues ADD COLUMN active_lock_reason VARCHAR(50);
+ALTER TABLE issues ADD COLUMN reactions JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE issues ADD COLUMN author_association VARCHAR(50);
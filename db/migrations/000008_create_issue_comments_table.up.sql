@@ -0,0 +1,19 @@
+CREATE TABLE issue_comments
+(
+  id                  BIGSERIAL PRIMARY KEY,
+  github_id           BIGINT NOT NULL,
+  issue_github_id     BIGINT NOT NULL,
+  created_at          TIMESTAMPTZ NOT NULL,
+  updated_at          TIMESTAMPTZ,
+  deleted_at          TIMESTAMPTZ,
+  repo_name           VARCHAR(255) NOT NULL,
+  repo_owner          VARCHAR(255) NOT NULL,
+  body                TEXT NOT NULL DEFAULT '',
+  html_url            VARCHAR(2000),
+  author              JSONB NOT NULL,
+  author_association  VARCHAR(50),
+  reactions           JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE UNIQUE INDEX issue_comments_github_id_idx ON issue_comments (github_id);
+CREATE INDEX issue_comments_issue_github_id_idx ON issue_comments (issue_github_id, created_at);
@@ -0,0 +1,39 @@
+CREATE TABLE labels
+(
+  id              BIGSERIAL PRIMARY KEY,
+  github_id       BIGINT NOT NULL,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  repo_name       VARCHAR(255) NOT NULL,
+  repo_owner      VARCHAR(255) NOT NULL,
+  name            VARCHAR(255) NOT NULL,
+  color           VARCHAR(20) NOT NULL DEFAULT '',
+  description     VARCHAR(2000),
+  is_default      BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE UNIQUE INDEX labels_github_id_idx ON labels (github_id);
+CREATE INDEX labels_repo_idx ON labels (repo_owner, repo_name);
+
+CREATE TABLE issue_labels
+(
+  issue_id        BIGINT NOT NULL REFERENCES issues (id) ON DELETE CASCADE,
+  label_id        BIGINT NOT NULL REFERENCES labels (id) ON DELETE CASCADE,
+  PRIMARY KEY (issue_id, label_id)
+);
+
+CREATE INDEX issue_labels_label_id_idx ON issue_labels (label_id);
+
+INSERT INTO labels
+  (github_id, repo_name, repo_owner, name, color, description, is_default)
+SELECT DISTINCT ON ((l->>'id')::bigint)
+  (l->>'id')::bigint, i.repo_name, i.repo_owner, l->>'name', COALESCE(l->>'color', ''), l->>'description', COALESCE((l->>'default')::boolean, false)
+FROM issues i, jsonb_array_elements(i.labels) l
+WHERE l ? 'id'
+ORDER BY (l->>'id')::bigint, i.updated_at DESC NULLS LAST;
+
+INSERT INTO issue_labels
+  (issue_id, label_id)
+SELECT DISTINCT i.id, lb.id
+FROM issues i, jsonb_array_elements(i.labels) l, labels lb
+WHERE lb.github_id = (l->>'id')::bigint;
@@ -0,0 +1,60 @@
+CREATE TABLE actors
+(
+  id              BIGSERIAL PRIMARY KEY,
+  github_id       BIGINT NOT NULL,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  propagated_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  login           VARCHAR(255) NOT NULL,
+  avatar_url      VARCHAR(2000),
+  html_url        VARCHAR(2000),
+  type            VARCHAR(50),
+  site_admin      BOOLEAN NOT NULL DEFAULT false,
+  -- When the payload the profile came from was current
+  profile_seen_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX actors_github_id_idx ON actors (github_id);
+CREATE INDEX actors_login_idx ON actors (lower(login));
+CREATE INDEX actors_propagation_idx ON actors (updated_at) WHERE updated_at > propagated_at;
+
+ALTER TABLE issues ADD COLUMN author_id BIGINT REFERENCES actors (id);
+
+CREATE INDEX issues_author_id_idx ON issues (author_id);
+
+ALTER TABLE issue_comments ADD COLUMN author_id BIGINT REFERENCES actors (id);
+
+CREATE INDEX issue_comments_author_id_idx ON issue_comments (author_id);
+
+CREATE TABLE issue_assignees
+(
+  issue_id        BIGINT NOT NULL REFERENCES issues (id) ON DELETE CASCADE,
+  actor_id        BIGINT NOT NULL REFERENCES actors (id) ON DELETE CASCADE,
+  PRIMARY KEY (issue_id, actor_id)
+);
+
+CREATE INDEX issue_assignees_actor_id_idx ON issue_assignees (actor_id);
+
+INSERT INTO actors
+  (github_id, login, avatar_url, html_url, type, site_admin)
+SELECT DISTINCT ON ((u->>'id')::bigint)
+  (u->>'id')::bigint, u->>'login', u->>'avatar_url', u->>'html_url', u->>'type', COALESCE((u->>'site_admin')::boolean, false)
+FROM (
+  SELECT author AS u, updated_at FROM issues
+  UNION ALL
+  SELECT a AS u, i.updated_at FROM issues i, jsonb_array_elements(i.assignees) a
+  UNION ALL
+  SELECT author AS u, updated_at FROM issue_comments
+) users
+WHERE u ? 'id' AND u ? 'login'
+ORDER BY (u->>'id')::bigint, updated_at DESC NULLS LAST;
+
+UPDATE issues i SET author_id = a.id FROM actors a WHERE a.github_id = (i.author->>'id')::bigint;
+
+UPDATE issue_comments c SET author_id = a.id FROM actors a WHERE a.github_id = (c.author->>'id')::bigint;
+
+INSERT INTO issue_assignees
+  (issue_id, actor_id)
+SELECT DISTINCT i.id, a.id
+FROM issues i, jsonb_array_elements(i.assignees) u, actors a
+WHERE a.github_id = (u->>'id')::bigint;
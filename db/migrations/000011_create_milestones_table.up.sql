@@ -0,0 +1,48 @@
+CREATE TABLE milestones
+(
+  id                  BIGSERIAL PRIMARY KEY,
+  github_id           BIGINT NOT NULL,
+  created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+  github_updated_at   TIMESTAMPTZ,
+  repo_name           VARCHAR(255) NOT NULL,
+  repo_owner          VARCHAR(255) NOT NULL,
+  number              BIGINT NOT NULL,
+  title               VARCHAR(2000) NOT NULL,
+  description         TEXT,
+  state               VARCHAR(50) NOT NULL DEFAULT 'open',
+  due_on              TIMESTAMPTZ,
+  closed_at           TIMESTAMPTZ,
+  open_issues         BIGINT NOT NULL DEFAULT 0,
+  closed_issues       BIGINT NOT NULL DEFAULT 0,
+  html_url            VARCHAR(2000)
+);
+
+CREATE UNIQUE INDEX milestones_github_id_idx ON milestones (github_id);
+CREATE INDEX milestones_repo_idx ON milestones (repo_owner, repo_name, number);
+
+ALTER TABLE issues ADD COLUMN milestone_id BIGINT REFERENCES milestones (id) ON DELETE SET NULL;
+
+CREATE INDEX issues_milestone_id_idx ON issues (milestone_id);
+
+INSERT INTO milestones
+  (github_id, github_updated_at, repo_name, repo_owner, number, title, description, state, due_on, closed_at, open_issues, closed_issues, html_url)
+SELECT DISTINCT ON ((i.milestone->>'id')::bigint)
+  (i.milestone->>'id')::bigint,
+  (i.milestone->>'updated_at')::timestamptz,
+  i.repo_name,
+  i.repo_owner,
+  COALESCE((i.milestone->>'number')::bigint, 0),
+  COALESCE(i.milestone->>'title', ''),
+  i.milestone->>'description',
+  COALESCE(i.milestone->>'state', 'open'),
+  (i.milestone->>'due_on')::timestamptz,
+  (i.milestone->>'closed_at')::timestamptz,
+  COALESCE((i.milestone->>'open_issues')::bigint, 0),
+  COALESCE((i.milestone->>'closed_issues')::bigint, 0),
+  i.milestone->>'html_url'
+FROM issues i
+WHERE i.milestone ? 'id'
+ORDER BY (i.milestone->>'id')::bigint, (i.milestone->>'updated_at')::timestamptz DESC NULLS LAST;
+
+UPDATE issues i SET milestone_id = m.id FROM milestones m WHERE m.github_id = (i.milestone->>'id')::bigint;
@@ -0,0 +1,15 @@
+CREATE TABLE issue_events
+(
+  id              BIGSERIAL PRIMARY KEY,
+  issue_id        BIGINT NOT NULL REFERENCES issues (id) ON DELETE CASCADE,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  occurred_at     TIMESTAMPTZ NOT NULL,
+  actor           JSONB,
+  action          VARCHAR(50) NOT NULL,
+  field           VARCHAR(50) NOT NULL,
+  old_value       JSONB,
+  new_value       JSONB
+);
+
+CREATE INDEX issue_events_issue_idx ON issue_events (issue_id, occurred_at, id);
+CREATE INDEX issue_events_repository_idx ON issue_events (occurred_at) WHERE field = 'repository';
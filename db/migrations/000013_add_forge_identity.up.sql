@@ -0,0 +1,37 @@
+ALTER TABLE issues ADD COLUMN provider VARCHAR(50) NOT NULL DEFAULT 'github';
+ALTER TABLE issues ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT 'github.com';
+
+DROP INDEX issues_github_id_idx;
+CREATE UNIQUE INDEX issues_github_id_idx ON issues (provider, host, github_id);
+
+ALTER TABLE issue_comments ADD COLUMN provider VARCHAR(50) NOT NULL DEFAULT 'github';
+ALTER TABLE issue_comments ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT 'github.com';
+
+DROP INDEX issue_comments_github_id_idx;
+CREATE UNIQUE INDEX issue_comments_github_id_idx ON issue_comments (provider, host, github_id);
+
+ALTER TABLE labels ADD COLUMN provider VARCHAR(50) NOT NULL DEFAULT 'github';
+ALTER TABLE labels ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT 'github.com';
+
+DROP INDEX labels_github_id_idx;
+CREATE UNIQUE INDEX labels_github_id_idx ON labels (provider, host, github_id);
+
+ALTER TABLE milestones ADD COLUMN provider VARCHAR(50) NOT NULL DEFAULT 'github';
+ALTER TABLE milestones ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT 'github.com';
+
+DROP INDEX milestones_github_id_idx;
+CREATE UNIQUE INDEX milestones_github_id_idx ON milestones (provider, host, github_id);
+
+ALTER TABLE actors ADD COLUMN provider VARCHAR(50) NOT NULL DEFAULT 'github';
+ALTER TABLE actors ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT 'github.com';
+
+DROP INDEX actors_github_id_idx;
+CREATE UNIQUE INDEX actors_github_id_idx ON actors (provider, host, github_id);
+
+ALTER TABLE webhook_secrets ADD COLUMN provider VARCHAR(50) NOT NULL DEFAULT 'github';
+ALTER TABLE webhook_secrets ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT 'github.com';
+
+DROP INDEX webhook_secrets_repo_idx;
+CREATE INDEX webhook_secrets_repo_idx ON webhook_secrets (provider, host, repo_owner, repo_name);
+
+ALTER TABLE webhook_deliveries ADD COLUMN provider VARCHAR(50) NOT NULL DEFAULT 'github';
@@ -0,0 +1,21 @@
+CREATE TABLE backfills
+(
+  id                     BIGSERIAL PRIMARY KEY,
+  provider               VARCHAR(50) NOT NULL DEFAULT 'github',
+  host                   VARCHAR(255) NOT NULL DEFAULT 'github.com',
+  repo_owner             VARCHAR(255) NOT NULL,
+  repo_name              VARCHAR(255) NOT NULL,
+  status                 VARCHAR(32) NOT NULL DEFAULT 'queued',
+  created_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+  started_at             TIMESTAMPTZ,
+  finished_at            TIMESTAMPTZ,
+  next_page_url          TEXT,
+  pages                  BIGINT NOT NULL DEFAULT 0,
+  issues_seen            BIGINT NOT NULL DEFAULT 0,
+  pull_requests_skipped  BIGINT NOT NULL DEFAULT 0,
+  rate_limited_until     TIMESTAMPTZ,
+  last_error             TEXT
+);
+
+CREATE UNIQUE INDEX backfills_repo_idx ON backfills (provider, host, repo_owner, repo_name);
@@ -0,0 +1,19 @@
+CREATE TABLE reconciliations
+(
+  id               BIGSERIAL PRIMARY KEY,
+  provider         VARCHAR(50) NOT NULL DEFAULT 'github',
+  host             VARCHAR(255) NOT NULL DEFAULT 'github.com',
+  repo_owner       VARCHAR(255) NOT NULL,
+  repo_name        VARCHAR(255) NOT NULL,
+  status           VARCHAR(32) NOT NULL DEFAULT 'running',
+  since            TIMESTAMPTZ NOT NULL,
+  started_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+  finished_at      TIMESTAMPTZ,
+  duration_ms      BIGINT,
+  issues_checked   BIGINT NOT NULL DEFAULT 0,
+  rows_fixed       BIGINT NOT NULL DEFAULT 0,
+  rows_missing     BIGINT NOT NULL DEFAULT 0,
+  last_error       TEXT
+);
+
+CREATE INDEX reconciliations_repo_idx ON reconciliations (provider, host, repo_owner, repo_name, started_at DESC);
@@ -0,0 +1,19 @@
+CREATE TABLE repositories
+(
+  id                     BIGSERIAL PRIMARY KEY,
+  provider               VARCHAR(50) NOT NULL DEFAULT 'github',
+  host                   VARCHAR(255) NOT NULL DEFAULT 'github.com',
+  repo_owner             VARCHAR(255) NOT NULL,
+  repo_name              VARCHAR(255) NOT NULL,
+  ingestion_mode         VARCHAR(32) NOT NULL DEFAULT 'webhook',
+  created_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_event_id          BIGINT NOT NULL DEFAULT 0,
+  poll_interval_seconds  INT NOT NULL DEFAULT 60,
+  next_poll_at           TIMESTAMPTZ,
+  last_polled_at         TIMESTAMPTZ,
+  last_error             TEXT
+);
+
+CREATE UNIQUE INDEX repositories_repo_idx ON repositories (provider, host, repo_owner, repo_name);
+CREATE INDEX repositories_poll_idx ON repositories (ingestion_mode, next_poll_at);
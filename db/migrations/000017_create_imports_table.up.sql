@@ -0,0 +1,23 @@
+CREATE TABLE imports
+(
+  id                  BIGSERIAL PRIMARY KEY,
+  provider            VARCHAR(50) NOT NULL DEFAULT 'github',
+  host                VARCHAR(255) NOT NULL DEFAULT 'github.com',
+  repo_owner          VARCHAR(255) NOT NULL,
+  repo_name           VARCHAR(255) NOT NULL,
+  format              VARCHAR(32) NOT NULL,
+  status              VARCHAR(32) NOT NULL DEFAULT 'queued',
+  created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+  started_at          TIMESTAMPTZ,
+  finished_at         TIMESTAMPTZ,
+  records             BIGINT NOT NULL DEFAULT 0,
+  issues_imported     BIGINT NOT NULL DEFAULT 0,
+  comments_imported   BIGINT NOT NULL DEFAULT 0,
+  records_skipped     BIGINT NOT NULL DEFAULT 0,
+  records_failed      BIGINT NOT NULL DEFAULT 0,
+  errors              JSONB NOT NULL DEFAULT '[]'::jsonb,
+  last_error          TEXT,
+  payload             BYTEA NOT NULL
+);
+
+CREATE INDEX imports_repo_idx ON imports (provider, host, repo_owner, repo_name, created_at DESC);
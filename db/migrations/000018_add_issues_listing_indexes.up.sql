@@ -0,0 +1,4 @@
+-- Keyset pagination of a repository's open or closed issues, by created and
+-- by updated, the id breaks ties
+CREATE INDEX issues_listing_created_idx ON issues (repo_owner, repo_name, closed, provider, host, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX issues_listing_updated_idx ON issues (repo_owner, repo_name, closed, provider, host, (COALESCE(updated_at, created_at)), id) WHERE deleted_at IS NULL;
@@ -0,0 +1,25 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Full text search for when meilisearch is down or not deployed, one row per
+-- issue. Kept apart from issues so SELECT * there stays as it was.
+CREATE TABLE issue_search_documents
+(
+  issue_id            BIGINT PRIMARY KEY REFERENCES issues (id) ON DELETE CASCADE,
+  search_vector       TSVECTOR NOT NULL,
+  indexed_at          TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX issue_search_documents_vector_idx ON issue_search_documents USING GIN (search_vector);
+CREATE INDEX issues_title_trgm_idx ON issues USING GIN (title gin_trgm_ops);
+
+-- Title weighs most, then the body and labels, then the comments
+INSERT INTO issue_search_documents (issue_id, search_vector)
+SELECT i.id,
+  setweight(to_tsvector('english', i.title), 'A') ||
+  setweight(to_tsvector('english', COALESCE(i.body, '') || ' ' || COALESCE((SELECT string_agg(l->>'name', ' ') FROM jsonb_array_elements(i.labels) l), '')), 'B') ||
+  setweight(to_tsvector('english', COALESCE((
+    SELECT string_agg(c.body, E'\n' ORDER BY c.created_at)
+    FROM issue_comments c
+    WHERE c.provider = i.provider AND c.host = i.host AND c.issue_github_id = i.github_id AND c.deleted_at IS NULL
+  ), '')), 'C')
+FROM issues i;
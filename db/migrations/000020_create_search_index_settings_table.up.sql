@@ -0,0 +1,15 @@
+-- Search settings, the row with an empty provider, host and repository holds
+-- the defaults every repository's settings are laid over
+CREATE TABLE search_index_settings
+(
+  id                  BIGSERIAL PRIMARY KEY,
+  provider            VARCHAR(50) NOT NULL DEFAULT '',
+  host                VARCHAR(255) NOT NULL DEFAULT '',
+  repo_owner          VARCHAR(255) NOT NULL DEFAULT '',
+  repo_name           VARCHAR(255) NOT NULL DEFAULT '',
+  settings            JSONB NOT NULL DEFAULT '{}'::jsonb,
+  created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at          TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX search_index_settings_repo_idx ON search_index_settings (provider, host, repo_owner, repo_name);
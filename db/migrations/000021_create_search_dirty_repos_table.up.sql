@@ -0,0 +1,11 @@
+-- Repositories whose meilisearch index missed writes while it was down, the
+-- worker rebuilds them from Postgres once it's back
+CREATE TABLE search_dirty_repos
+(
+  provider            VARCHAR(50) NOT NULL,
+  host                VARCHAR(255) NOT NULL,
+  repo_owner          VARCHAR(255) NOT NULL,
+  repo_name           VARCHAR(255) NOT NULL,
+  marked_at           TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (provider, host, repo_owner, repo_name)
+);
@@ -0,0 +1,8 @@
+-- Issues keep the forge's case for their repository while lookups come in
+-- lowercased, so queries compare lower() of both and the indexes match that
+DROP INDEX issues_listing_created_idx;
+DROP INDEX issues_listing_updated_idx;
+
+CREATE INDEX issues_listing_created_idx ON issues (lower(repo_owner), lower(repo_name), closed, provider, host, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX issues_listing_updated_idx ON issues (lower(repo_owner), lower(repo_name), closed, provider, host, (COALESCE(updated_at, created_at)), id) WHERE deleted_at IS NULL;
+CREATE INDEX issues_repository_number_idx ON issues (lower(repo_owner), lower(repo_name), issue_number, provider, host);
@@ -0,0 +1,4 @@
+-- Set while a GitLab issue is confidential, deleted_at hides it meanwhile. It
+-- holds the updated_at of the hook that hid it, a newer public hook clears
+-- both and brings the issue back.
+ALTER TABLE issues ADD COLUMN confidential_since TIMESTAMPTZ;
@@ -1,4 +1,52 @@
 package models
 
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
 type Actors struct {
+	ID            uint64         `db:"id"`              // INT8 PKEY
+	Provider      string         `db:"provider"`        // VARCHAR(50)
+	Host          string         `db:"host"`            // VARCHAR(255)
+	GitHubID      uint64         `db:"github_id"`       // BIGINT unique
+	CreatedAt     time.Time      `db:"created_at"`      // TIMESTAMPZ
+	UpdatedAt     time.Time      `db:"updated_at"`      // TIMESTAMPZ
+	PropagatedAt  time.Time      `db:"propagated_at"`   // TIMESTAMPZ
+	Login         string         `db:"login"`           // VARCHAR(255) idx
+	AvatarURL     sql.NullString `db:"avatar_url"`      // VARCHAR(2000)
+	HTMLURL       sql.NullString `db:"html_url"`        // VARCHAR(2000)
+	Type          sql.NullString `db:"type"`            // VARCHAR(50)
+	SiteAdmin     bool           `db:"site_admin"`      // BOOLEAN
+	ProfileSeenAt sql.NullTime   `db:"profile_seen_at"` // TIMESTAMPZ
+}
+
+func (c Actors) ToMap() *fiber.Map {
+	return &fiber.Map{
+		"id":         c.ID,
+		"provider":   c.Provider,
+		"host":       c.Host,
+		"github_id":  c.GitHubID,
+		"created_at": c.CreatedAt.Format(time.RFC3339),
+		"updated_at": c.UpdatedAt.Format(time.RFC3339),
+		"login":      c.Login,
+		"avatar_url": nullString(c.AvatarURL),
+		"html_url":   nullString(c.HTMLURL),
+		"type":       nullString(c.Type),
+		"site_admin": c.SiteAdmin,
+	}
+}
+
+// ToProfileMap is the actor as it's embedded on issues and comments.
+func (c Actors) ToProfileMap() *fiber.Map {
+	return &fiber.Map{
+		"id":         c.GitHubID,
+		"login":      c.Login,
+		"avatar_url": nullString(c.AvatarURL),
+		"html_url":   nullString(c.HTMLURL),
+		"type":       nullString(c.Type),
+		"site_admin": c.SiteAdmin,
+	}
 }
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"database/sql"
+	"maps"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Backfills struct {
+	ID                  uint64         `db:"id"`                    // INT8 PKEY
+	Provider            string         `db:"provider"`              // VARCHAR(50)
+	Host                string         `db:"host"`                  // VARCHAR(255)
+	RepoOwner           string         `db:"repo_owner"`            // VARCHAR(255) unique
+	RepoName            string         `db:"repo_name"`             // VARCHAR(255) unique
+	Status              string         `db:"status"`                // VARCHAR(32)
+	CreatedAt           time.Time      `db:"created_at"`            // TIMESTAMPZ
+	UpdatedAt           time.Time      `db:"updated_at"`            // TIMESTAMPZ
+	StartedAt           sql.NullTime   `db:"started_at"`            // TIMESTAMPZ
+	FinishedAt          sql.NullTime   `db:"finished_at"`           // TIMESTAMPZ
+	NextPageURL         sql.NullString `db:"next_page_url"`         // TEXT
+	Pages               uint64         `db:"pages"`                 // INT8
+	IssuesSeen          uint64         `db:"issues_seen"`           // INT8
+	PullRequestsSkipped uint64         `db:"pull_requests_skipped"` // INT8
+	RateLimitedUntil    sql.NullTime   `db:"rate_limited_until"`    // TIMESTAMPZ
+	LastError           sql.NullString `db:"last_error"`            // TEXT
+}
+
+func (c Backfills) ToMap() *fiber.Map {
+	json := fiber.Map{
+		"id":                    c.ID,
+		"provider":              c.Provider,
+		"host":                  c.Host,
+		"repo_owner":            c.RepoOwner,
+		"repo_name":             c.RepoName,
+		"status":                c.Status,
+		"created_at":            c.CreatedAt.Format(time.RFC3339),
+		"updated_at":            c.UpdatedAt.Format(time.RFC3339),
+		"pages":                 c.Pages,
+		"issues_seen":           c.IssuesSeen,
+		"pull_requests_skipped": c.PullRequestsSkipped,
+	}
+
+	if c.StartedAt.Valid {
+		maps.Copy(json, fiber.Map{
+			"started_at": c.StartedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	if c.FinishedAt.Valid {
+		maps.Copy(json, fiber.Map{
+			"finished_at": c.FinishedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	if c.RateLimitedUntil.Valid && c.RateLimitedUntil.Time.After(time.Now()) {
+		maps.Copy(json, fiber.Map{
+			"rate_limited_until": c.RateLimitedUntil.Time.Format(time.RFC3339),
+		})
+	}
+
+	if c.LastError.Valid {
+		maps.Copy(json, fiber.Map{
+			"last_error": c.LastError.String,
+		})
+	}
+
+	return &json
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"database/sql"
+	"maps"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	types "github.com/jmoiron/sqlx/types"
+)
+
+type Imports struct {
+	ID               uint64         `db:"id"`                // INT8 PKEY
+	Provider         string         `db:"provider"`          // VARCHAR(50)
+	Host             string         `db:"host"`              // VARCHAR(255)
+	RepoOwner        string         `db:"repo_owner"`        // VARCHAR(255) idx
+	RepoName         string         `db:"repo_name"`         // VARCHAR(255) idx
+	Format           string         `db:"format"`            // VARCHAR(32)
+	Status           string         `db:"status"`            // VARCHAR(32)
+	CreatedAt        time.Time      `db:"created_at"`        // TIMESTAMPZ idx
+	StartedAt        sql.NullTime   `db:"started_at"`        // TIMESTAMPZ
+	FinishedAt       sql.NullTime   `db:"finished_at"`       // TIMESTAMPZ
+	Records          uint64         `db:"records"`           // INT8
+	IssuesImported   uint64         `db:"issues_imported"`   // INT8
+	CommentsImported uint64         `db:"comments_imported"` // INT8
+	RecordsSkipped   uint64         `db:"records_skipped"`   // INT8
+	RecordsFailed    uint64         `db:"records_failed"`    // INT8
+	Errors           types.JSONText `db:"errors"`            // JSONB
+	LastError        sql.NullString `db:"last_error"`        // TEXT
+	Payload          []byte         `db:"payload"`           // BYTEA
+}
+
+func (c Imports) ToMap() (*fiber.Map, error) {
+	errors := []interface{}{}
+
+	if err := c.Errors.Unmarshal(&errors); err != nil {
+		return nil, err
+	}
+
+	json := fiber.Map{
+		"id":                c.ID,
+		"provider":          c.Provider,
+		"host":              c.Host,
+		"repo_owner":        c.RepoOwner,
+		"repo_name":         c.RepoName,
+		"format":            c.Format,
+		"status":            c.Status,
+		"created_at":        c.CreatedAt.Format(time.RFC3339),
+		"records":           c.Records,
+		"issues_imported":   c.IssuesImported,
+		"comments_imported": c.CommentsImported,
+		"records_skipped":   c.RecordsSkipped,
+		"records_failed":    c.RecordsFailed,
+		"errors":            errors,
+	}
+
+	if c.StartedAt.Valid {
+		maps.Copy(json, fiber.Map{
+			"started_at": c.StartedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	if c.FinishedAt.Valid {
+		maps.Copy(json, fiber.Map{
+			"finished_at": c.FinishedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	if c.LastError.Valid {
+		maps.Copy(json, fiber.Map{
+			"last_error": c.LastError.String,
+		})
+	}
+
+	return &json, nil
+}
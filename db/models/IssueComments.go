@@ -0,0 +1,72 @@
+package models
+
+import (
+	"database/sql"
+	"maps"
+	"time"
+
+	types "github.com/jmoiron/sqlx/types"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type IssueComments struct {
+	ID                uint64         `db:"id"`                 // INT8 PKEY
+	Provider          string         `db:"provider"`           // VARCHAR(50)
+	Host              string         `db:"host"`               // VARCHAR(255)
+	GitHubID          uint64         `db:"github_id"`          // BIGINT unique
+	IssueGitHubID     uint64         `db:"issue_github_id"`    // BIGINT idx
+	CreatedAt         time.Time      `db:"created_at"`         // TIMESTAMPZ
+	UpdatedAt         sql.NullTime   `db:"updated_at"`         // TIMESTAMPZ
+	DeletedAt         sql.NullTime   `db:"deleted_at"`         // TIMESTAMPZ
+	RepoName          string         `db:"repo_name"`          // VARCHAR(255)
+	RepoOwner         string         `db:"repo_owner"`         // VARCHAR(255)
+	Body              string         `db:"body"`               // TEXT
+	HTMLURL           sql.NullString `db:"html_url"`           // VARCHAR(2000)
+	Author            types.JSONText `db:"author"`             // JSONB
+	AuthorAssociation sql.NullString `db:"author_association"` // VARCHAR(50)
+	Reactions         types.JSONText `db:"reactions"`          // JSONB
+	AuthorID          sql.NullInt64  `db:"author_id"`          // BIGINT idx
+}
+
+func (c IssueComments) ToMap() (*fiber.Map, error) {
+	var author fiber.Map
+	err := c.Author.Unmarshal(&author)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var reactions fiber.Map
+	err = c.Reactions.Unmarshal(&reactions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	json := fiber.Map{
+		"id":                 c.ID,
+		"provider":           c.Provider,
+		"host":               c.Host,
+		"created_at":         c.CreatedAt.Format(time.RFC3339),
+		"body":               c.Body,
+		"html_url":           nullString(c.HTMLURL),
+		"repo_name":          c.RepoName,
+		"repo_owner":         c.RepoOwner,
+		"author":             author,
+		"author_association": nullString(c.AuthorAssociation),
+		"reactions":          reactions,
+	}
+
+	if c.UpdatedAt.Valid {
+		maps.Copy(json, fiber.Map{
+			"updated_at": c.UpdatedAt.Time.Format(time.RFC3339),
+		})
+	} else {
+		maps.Copy(json, fiber.Map{
+			"updated_at": c.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return &json, nil
+}
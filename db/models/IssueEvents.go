@@ -0,0 +1,213 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	types "github.com/jmoiron/sqlx/types"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Fields an issue event can change, each maps onto one or more issue columns.
+const (
+	IssueEventFieldIssue      = "issue"
+	IssueEventFieldTitle      = "title"
+	IssueEventFieldBody       = "body"
+	IssueEventFieldState      = "state"
+	IssueEventFieldLabels     = "labels"
+	IssueEventFieldAssignees  = "assignees"
+	IssueEventFieldMilestone  = "milestone"
+	IssueEventFieldLock       = "lock"
+	IssueEventFieldDeletedAt  = "deleted_at"
+	IssueEventFieldRepository = "repository"
+)
+
+type IssueEvents struct {
+	ID         uint64             `db:"id"`          // INT8 PKEY
+	IssueID    uint64             `db:"issue_id"`    // BIGINT idx
+	CreatedAt  time.Time          `db:"created_at"`  // TIMESTAMPZ
+	OccurredAt time.Time          `db:"occurred_at"` // TIMESTAMPZ idx
+	Actor      types.NullJSONText `db:"actor"`       // JSONB
+	Action     string             `db:"action"`      // VARCHAR(50)
+	Field      string             `db:"field"`       // VARCHAR(50)
+	OldValue   types.NullJSONText `db:"old_value"`   // JSONB
+	NewValue   types.NullJSONText `db:"new_value"`   // JSONB
+}
+
+// IssueState is the value of the state field.
+type IssueState struct {
+	Closed      bool       `json:"closed"`
+	StateReason *string    `json:"state_reason"`
+	ClosedAt    *time.Time `json:"closed_at"`
+}
+
+// IssueLock is the value of the lock field.
+type IssueLock struct {
+	Locked           bool    `json:"locked"`
+	ActiveLockReason *string `json:"active_lock_reason"`
+}
+
+// IssueLocation is the value of the repository field.
+type IssueLocation struct {
+	RepoOwner   string `json:"repo_owner"`
+	RepoName    string `json:"repo_name"`
+	IssueNumber uint64 `json:"issue_number"`
+}
+
+func (c Issues) State() IssueState {
+	state := IssueState{Closed: c.Closed}
+
+	if c.StateReason.Valid {
+		state.StateReason = &c.StateReason.String
+	}
+
+	if c.ClosedAt.Valid {
+		state.ClosedAt = &c.ClosedAt.Time
+	}
+
+	return state
+}
+
+func (c Issues) Lock() IssueLock {
+	lock := IssueLock{Locked: c.Locked}
+
+	if c.ActiveLockReason.Valid {
+		lock.ActiveLockReason = &c.ActiveLockReason.String
+	}
+
+	return lock
+}
+
+func (c Issues) Location() IssueLocation {
+	return IssueLocation{
+		RepoOwner:   c.RepoOwner,
+		RepoName:    c.RepoName,
+		IssueNumber: c.IssueNumber,
+	}
+}
+
+// Revert undoes event on the issue, putting back the value it replaced.
+func (c *Issues) Revert(event IssueEvents) error {
+	old := []byte("null")
+
+	if event.OldValue.Valid {
+		old = event.OldValue.JSONText
+	}
+
+	switch event.Field {
+	case IssueEventFieldTitle:
+		return json.Unmarshal(old, &c.Title)
+	case IssueEventFieldBody:
+		var body *string
+
+		if err := json.Unmarshal(old, &body); err != nil {
+			return err
+		}
+
+		c.Body = sqlString(body)
+	case IssueEventFieldState:
+		var state IssueState
+
+		if err := json.Unmarshal(old, &state); err != nil {
+			return err
+		}
+
+		c.Closed = state.Closed
+		c.StateReason = sqlString(state.StateReason)
+		c.ClosedAt = sqlTime(state.ClosedAt)
+	case IssueEventFieldLabels:
+		c.Labels = jsonArray(event.OldValue)
+	case IssueEventFieldAssignees:
+		c.Assignees = jsonArray(event.OldValue)
+	case IssueEventFieldMilestone:
+		c.Milestone = event.OldValue
+	case IssueEventFieldLock:
+		var lock IssueLock
+
+		if err := json.Unmarshal(old, &lock); err != nil {
+			return err
+		}
+
+		c.Locked = lock.Locked
+		c.ActiveLockReason = sqlString(lock.ActiveLockReason)
+	case IssueEventFieldDeletedAt:
+		var deletedAt *time.Time
+
+		if err := json.Unmarshal(old, &deletedAt); err != nil {
+			return err
+		}
+
+		c.DeletedAt = sqlTime(deletedAt)
+	case IssueEventFieldRepository:
+		var location IssueLocation
+
+		if err := json.Unmarshal(old, &location); err != nil {
+			return err
+		}
+
+		c.RepoOwner = location.RepoOwner
+		c.RepoName = location.RepoName
+		c.IssueNumber = location.IssueNumber
+	}
+
+	return nil
+}
+
+func sqlString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: *s, Valid: true}
+}
+
+func sqlTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func jsonArray(j types.NullJSONText) types.JSONText {
+	if !j.Valid {
+		return types.JSONText("[]")
+	}
+
+	return j.JSONText
+}
+
+func (c IssueEvents) ToMap() (*fiber.Map, error) {
+	actor, err := nullJSON(c.Actor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var oldValue, newValue interface{}
+
+	if c.OldValue.Valid {
+		if err := c.OldValue.Unmarshal(&oldValue); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.NewValue.Valid {
+		if err := c.NewValue.Unmarshal(&newValue); err != nil {
+			return nil, err
+		}
+	}
+
+	return &fiber.Map{
+		"id":          c.ID,
+		"issue_id":    c.IssueID,
+		"occurred_at": c.OccurredAt.Format(time.RFC3339),
+		"actor":       actor,
+		"action":      c.Action,
+		"field":       c.Field,
+		"old_value":   oldValue,
+		"new_value":   newValue,
+	}, nil
+}
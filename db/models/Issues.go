@@ -11,19 +11,73 @@ import (
 )
 
 type Issues struct {
-	ID            uint64         `db:"id"`             // INT8 PKEY
-	GitHubID      uint64         `db:"github_id"`      // BIGINT
-	CreatedAt     time.Time      `db:"created_at"`     // TIMESTAMPZ
-	UpdatedAt     sql.NullTime   `db:"updated_at"`     // TIMESTAMPZ
-	Title         string         `db:"title"`          // VARCHAR(2000)
-	IssueNumber   uint64         `db:"issue_number"`   // BIGINT
-	CommentsCount uint64         `db:"comments_count"` // BIGINT
-	RepoName      string         `db:"repo_name"`      // VARCHAR(255) idx
-	RepoOwner     string         `db:"repo_owner"`     // VARCHAR(255) idx
-	Author        types.JSONText `db:"author"`         // JSONB
-	Labels        types.JSONText `db:"labels"`         // JSONB
-	Assignees     types.JSONText `db:"assignees"`      // JSONB
-	Closed        bool           `db:"closed"`         // BOOLEAN idx
+	ID                uint64             `db:"id"`                 // INT8 PKEY
+	Provider          string             `db:"provider"`           // VARCHAR(50)
+	Host              string             `db:"host"`               // VARCHAR(255)
+	GitHubID          uint64             `db:"github_id"`          // BIGINT
+	CreatedAt         time.Time          `db:"created_at"`         // TIMESTAMPZ
+	UpdatedAt         sql.NullTime       `db:"updated_at"`         // TIMESTAMPZ
+	Title             string             `db:"title"`              // VARCHAR(2000)
+	IssueNumber       uint64             `db:"issue_number"`       // BIGINT
+	CommentsCount     uint64             `db:"comments_count"`     // BIGINT
+	RepoName          string             `db:"repo_name"`          // VARCHAR(255) idx
+	RepoOwner         string             `db:"repo_owner"`         // VARCHAR(255) idx
+	Author            types.JSONText     `db:"author"`             // JSONB
+	Labels            types.JSONText     `db:"labels"`             // JSONB
+	Assignees         types.JSONText     `db:"assignees"`          // JSONB
+	Closed            bool               `db:"closed"`             // BOOLEAN idx
+	DeletedAt         sql.NullTime       `db:"deleted_at"`         // TIMESTAMPZ
+	Body              sql.NullString     `db:"body"`               // TEXT
+	HTMLURL           sql.NullString     `db:"html_url"`           // VARCHAR(2000)
+	StateReason       sql.NullString     `db:"state_reason"`       // VARCHAR(50)
+	ClosedAt          sql.NullTime       `db:"closed_at"`          // TIMESTAMPZ
+	ClosedBy          types.NullJSONText `db:"closed_by"`          // JSONB
+	Milestone         types.NullJSONText `db:"milestone"`          // JSONB
+	Locked            bool               `db:"locked"`             // BOOLEAN
+	ActiveLockReason  sql.NullString     `db:"active_lock_reason"` // VARCHAR(50)
+	Reactions         types.JSONText     `db:"reactions"`          // JSONB
+	AuthorAssociation sql.NullString     `db:"author_association"` // VARCHAR(50)
+	AuthorID          sql.NullInt64      `db:"author_id"`          // BIGINT idx
+	MilestoneID       sql.NullInt64      `db:"milestone_id"`       // BIGINT idx
+	ConfidentialSince sql.NullTime       `db:"confidential_since"` // TIMESTAMPZ
+}
+
+func nullString(s sql.NullString) interface{} {
+	if s.Valid {
+		return s.String
+	}
+
+	return nil
+}
+
+func nullTime(t sql.NullTime) interface{} {
+	if t.Valid {
+		return t.Time.Format(time.RFC3339)
+	}
+
+	return nil
+}
+
+func nullJSON(j types.NullJSONText) (interface{}, error) {
+	if !j.Valid {
+		return nil, nil
+	}
+
+	var value fiber.Map
+	err := j.Unmarshal(&value)
+
+	return value, err
+}
+
+// ReactionsCount is the reactions' total_count, 0 when there's none.
+func (c Issues) ReactionsCount() uint64 {
+	var reactions struct {
+		TotalCount uint64 `json:"total_count"`
+	}
+
+	c.Reactions.Unmarshal(&reactions)
+
+	return reactions.TotalCount
 }
 
 func (c Issues) ToMap() (*fiber.Map, error) {
@@ -48,18 +102,49 @@ func (c Issues) ToMap() (*fiber.Map, error) {
 		return nil, err
 	}
 
+	closedBy, err := nullJSON(c.ClosedBy)
+
+	if err != nil {
+		return nil, err
+	}
+
+	milestone, err := nullJSON(c.Milestone)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var reactions fiber.Map
+	err = c.Reactions.Unmarshal(&reactions)
+
+	if err != nil {
+		return nil, err
+	}
+
 	json := fiber.Map{
-		"id":             c.ID,
-		"created_at":     c.CreatedAt.Format(time.RFC3339),
-		"title":          c.Title,
-		"issue_number":   c.IssueNumber,
-		"comments_count": c.CommentsCount,
-		"repo_name":      c.RepoName,
-		"repo_owner":     c.RepoOwner,
-		"author":         author,
-		"labels":         labels,
-		"assignees":      assignees,
-		"closed":         c.Closed,
+		"id":                 c.ID,
+		"provider":           c.Provider,
+		"host":               c.Host,
+		"created_at":         c.CreatedAt.Format(time.RFC3339),
+		"title":              c.Title,
+		"body":               nullString(c.Body),
+		"html_url":           nullString(c.HTMLURL),
+		"issue_number":       c.IssueNumber,
+		"comments_count":     c.CommentsCount,
+		"repo_name":          c.RepoName,
+		"repo_owner":         c.RepoOwner,
+		"author":             author,
+		"author_association": nullString(c.AuthorAssociation),
+		"labels":             labels,
+		"assignees":          assignees,
+		"milestone":          milestone,
+		"closed":             c.Closed,
+		"closed_at":          nullTime(c.ClosedAt),
+		"closed_by":          closedBy,
+		"state_reason":       nullString(c.StateReason),
+		"locked":             c.Locked,
+		"active_lock_reason": nullString(c.ActiveLockReason),
+		"reactions":          reactions,
 	}
 
 	if c.UpdatedAt.Valid {
@@ -1,4 +1,40 @@
 package models
 
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
 type Labels struct {
+	ID          uint64         `db:"id"`          // INT8 PKEY
+	Provider    string         `db:"provider"`    // VARCHAR(50)
+	Host        string         `db:"host"`        // VARCHAR(255)
+	GitHubID    uint64         `db:"github_id"`   // BIGINT unique
+	CreatedAt   time.Time      `db:"created_at"`  // TIMESTAMPZ
+	UpdatedAt   time.Time      `db:"updated_at"`  // TIMESTAMPZ
+	RepoName    string         `db:"repo_name"`   // VARCHAR(255) idx
+	RepoOwner   string         `db:"repo_owner"`  // VARCHAR(255) idx
+	Name        string         `db:"name"`        // VARCHAR(255)
+	Color       string         `db:"color"`       // VARCHAR(20)
+	Description sql.NullString `db:"description"` // VARCHAR(2000)
+	IsDefault   bool           `db:"is_default"`  // BOOLEAN
+}
+
+func (c Labels) ToMap() *fiber.Map {
+	return &fiber.Map{
+		"id":          c.ID,
+		"provider":    c.Provider,
+		"host":        c.Host,
+		"github_id":   c.GitHubID,
+		"created_at":  c.CreatedAt.Format(time.RFC3339),
+		"updated_at":  c.UpdatedAt.Format(time.RFC3339),
+		"repo_name":   c.RepoName,
+		"repo_owner":  c.RepoOwner,
+		"name":        c.Name,
+		"color":       c.Color,
+		"description": nullString(c.Description),
+		"default":     c.IsDefault,
+	}
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Milestones struct {
+	ID              uint64         `db:"id"`                // INT8 PKEY
+	Provider        string         `db:"provider"`          // VARCHAR(50)
+	Host            string         `db:"host"`              // VARCHAR(255)
+	GitHubID        uint64         `db:"github_id"`         // BIGINT unique
+	CreatedAt       time.Time      `db:"created_at"`        // TIMESTAMPZ
+	UpdatedAt       time.Time      `db:"updated_at"`        // TIMESTAMPZ
+	GitHubUpdatedAt sql.NullTime   `db:"github_updated_at"` // TIMESTAMPZ
+	RepoName        string         `db:"repo_name"`         // VARCHAR(255) idx
+	RepoOwner       string         `db:"repo_owner"`        // VARCHAR(255) idx
+	Number          uint64         `db:"number"`            // BIGINT idx
+	Title           string         `db:"title"`             // VARCHAR(2000)
+	Description     sql.NullString `db:"description"`       // TEXT
+	State           string         `db:"state"`             // VARCHAR(50)
+	DueOn           sql.NullTime   `db:"due_on"`            // TIMESTAMPZ
+	ClosedAt        sql.NullTime   `db:"closed_at"`         // TIMESTAMPZ
+	OpenIssues      uint64         `db:"open_issues"`       // BIGINT
+	ClosedIssues    uint64         `db:"closed_issues"`     // BIGINT
+	HTMLURL         sql.NullString `db:"html_url"`          // VARCHAR(2000)
+}
+
+// Completion is the share of the milestone's issues that are closed, as a
+// percentage rounded to one decimal place.
+func (c Milestones) Completion() float64 {
+	total := c.OpenIssues + c.ClosedIssues
+
+	if total == 0 {
+		return 0
+	}
+
+	return math.Round(float64(c.ClosedIssues)/float64(total)*1000) / 10
+}
+
+func (c Milestones) ToMap() *fiber.Map {
+	return &fiber.Map{
+		"id":            c.ID,
+		"provider":      c.Provider,
+		"host":          c.Host,
+		"github_id":     c.GitHubID,
+		"created_at":    c.CreatedAt.Format(time.RFC3339),
+		"updated_at":    c.UpdatedAt.Format(time.RFC3339),
+		"repo_name":     c.RepoName,
+		"repo_owner":    c.RepoOwner,
+		"number":        c.Number,
+		"title":         c.Title,
+		"description":   nullString(c.Description),
+		"state":         c.State,
+		"due_on":        nullTime(c.DueOn),
+		"closed_at":     nullTime(c.ClosedAt),
+		"open_issues":   c.OpenIssues,
+		"closed_issues": c.ClosedIssues,
+		"completion":    c.Completion(),
+		"html_url":      nullString(c.HTMLURL),
+	}
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"database/sql"
+	"maps"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Reconciliations struct {
+	ID            uint64         `db:"id"`             // INT8 PKEY
+	Provider      string         `db:"provider"`       // VARCHAR(50)
+	Host          string         `db:"host"`           // VARCHAR(255)
+	RepoOwner     string         `db:"repo_owner"`     // VARCHAR(255) idx
+	RepoName      string         `db:"repo_name"`      // VARCHAR(255) idx
+	Status        string         `db:"status"`         // VARCHAR(32)
+	Since         time.Time      `db:"since"`          // TIMESTAMPZ
+	StartedAt     time.Time      `db:"started_at"`     // TIMESTAMPZ idx
+	FinishedAt    sql.NullTime   `db:"finished_at"`    // TIMESTAMPZ
+	DurationMs    sql.NullInt64  `db:"duration_ms"`    // INT8
+	IssuesChecked uint64         `db:"issues_checked"` // INT8
+	RowsFixed     uint64         `db:"rows_fixed"`     // INT8
+	RowsMissing   uint64         `db:"rows_missing"`   // INT8
+	LastError     sql.NullString `db:"last_error"`     // TEXT
+}
+
+func (c Reconciliations) ToMap() *fiber.Map {
+	json := fiber.Map{
+		"id":             c.ID,
+		"provider":       c.Provider,
+		"host":           c.Host,
+		"repo_owner":     c.RepoOwner,
+		"repo_name":      c.RepoName,
+		"status":         c.Status,
+		"since":          c.Since.Format(time.RFC3339),
+		"started_at":     c.StartedAt.Format(time.RFC3339),
+		"issues_checked": c.IssuesChecked,
+		"rows_fixed":     c.RowsFixed,
+		"rows_missing":   c.RowsMissing,
+	}
+
+	if c.FinishedAt.Valid {
+		maps.Copy(json, fiber.Map{
+			"finished_at": c.FinishedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	if c.DurationMs.Valid {
+		maps.Copy(json, fiber.Map{
+			"duration_ms": c.DurationMs.Int64,
+		})
+	}
+
+	if c.LastError.Valid {
+		maps.Copy(json, fiber.Map{
+			"last_error": c.LastError.String,
+		})
+	}
+
+	return &json
+}
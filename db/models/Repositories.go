@@ -0,0 +1,70 @@
+package models
+
+import (
+	"database/sql"
+	"maps"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	IngestionModeWebhook = "webhook"
+	IngestionModePoll    = "poll"
+)
+
+type Repositories struct {
+	ID                  uint64         `db:"id"`                    // INT8 PKEY
+	Provider            string         `db:"provider"`              // VARCHAR(50)
+	Host                string         `db:"host"`                  // VARCHAR(255)
+	RepoOwner           string         `db:"repo_owner"`            // VARCHAR(255) unique
+	RepoName            string         `db:"repo_name"`             // VARCHAR(255) unique
+	IngestionMode       string         `db:"ingestion_mode"`        // VARCHAR(32) idx
+	CreatedAt           time.Time      `db:"created_at"`            // TIMESTAMPZ
+	UpdatedAt           time.Time      `db:"updated_at"`            // TIMESTAMPZ
+	LastEventID         uint64         `db:"last_event_id"`         // INT8
+	PollIntervalSeconds uint64         `db:"poll_interval_seconds"` // INT
+	NextPollAt          sql.NullTime   `db:"next_poll_at"`          // TIMESTAMPZ idx
+	LastPolledAt        sql.NullTime   `db:"last_polled_at"`        // TIMESTAMPZ
+	LastError           sql.NullString `db:"last_error"`            // TEXT
+}
+
+func (c Repositories) ToMap() *fiber.Map {
+	json := fiber.Map{
+		"id":             c.ID,
+		"provider":       c.Provider,
+		"host":           c.Host,
+		"repo_owner":     c.RepoOwner,
+		"repo_name":      c.RepoName,
+		"ingestion_mode": c.IngestionMode,
+		"created_at":     c.CreatedAt.Format(time.RFC3339),
+		"updated_at":     c.UpdatedAt.Format(time.RFC3339),
+	}
+
+	if c.IngestionMode == IngestionModePoll {
+		maps.Copy(json, fiber.Map{
+			"last_event_id":         c.LastEventID,
+			"poll_interval_seconds": c.PollIntervalSeconds,
+		})
+	}
+
+	if c.NextPollAt.Valid {
+		maps.Copy(json, fiber.Map{
+			"next_poll_at": c.NextPollAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	if c.LastPolledAt.Valid {
+		maps.Copy(json, fiber.Map{
+			"last_polled_at": c.LastPolledAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	if c.LastError.Valid {
+		maps.Copy(json, fiber.Map{
+			"last_error": c.LastError.String,
+		})
+	}
+
+	return &json
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	types "github.com/jmoiron/sqlx/types"
+)
+
+type SearchIndexSettings struct {
+	ID        uint64         `db:"id"`         // INT8 PKEY
+	Provider  string         `db:"provider"`   // VARCHAR(50) unique
+	Host      string         `db:"host"`       // VARCHAR(255) unique
+	RepoOwner string         `db:"repo_owner"` // VARCHAR(255) unique
+	RepoName  string         `db:"repo_name"`  // VARCHAR(255) unique
+	Settings  types.JSONText `db:"settings"`   // JSONB
+	CreatedAt time.Time      `db:"created_at"` // TIMESTAMPZ
+	UpdatedAt time.Time      `db:"updated_at"` // TIMESTAMPZ
+}
+
+func (c SearchIndexSettings) ToMap() (*fiber.Map, error) {
+	var settings fiber.Map
+
+	if err := c.Settings.Unmarshal(&settings); err != nil {
+		return nil, err
+	}
+
+	json := fiber.Map{
+		"id":         c.ID,
+		"provider":   c.Provider,
+		"host":       c.Host,
+		"repo_owner": c.RepoOwner,
+		"repo_name":  c.RepoName,
+		"settings":   settings,
+		"created_at": c.CreatedAt.Format(time.RFC3339),
+		"updated_at": c.UpdatedAt.Format(time.RFC3339),
+	}
+
+	return &json, nil
+}
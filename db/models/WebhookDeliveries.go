@@ -0,0 +1,75 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"maps"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type WebhookDeliveries struct {
+	ID          uint64         `db:"id"`           // INT8 PKEY
+	Provider    string         `db:"provider"`     // VARCHAR(50)
+	DeliveryID  string         `db:"delivery_id"`  // VARCHAR(255) unique
+	Event       string         `db:"event"`        // VARCHAR(100)
+	ReceivedAt  time.Time      `db:"received_at"`  // TIMESTAMPZ idx
+	EnqueuedAt  sql.NullTime   `db:"enqueued_at"`  // TIMESTAMPZ
+	ProcessedAt sql.NullTime   `db:"processed_at"` // TIMESTAMPZ
+	Status      string         `db:"status"`       // VARCHAR(32) idx
+	Attempts    uint64         `db:"attempts"`     // INT
+	LastError   sql.NullString `db:"last_error"`   // TEXT
+	RepoOwner   sql.NullString `db:"repo_owner"`   // VARCHAR(255)
+	RepoName    sql.NullString `db:"repo_name"`    // VARCHAR(255)
+	RepoScoped  bool           `db:"repo_scoped"`  // BOOLEAN
+	Payload     []byte         `db:"payload"`      // BYTEA
+}
+
+func (c WebhookDeliveries) ToMap() *fiber.Map {
+	json := fiber.Map{
+		"id":          c.ID,
+		"provider":    c.Provider,
+		"delivery_id": c.DeliveryID,
+		"event":       c.Event,
+		"received_at": c.ReceivedAt.Format(time.RFC3339),
+		"status":      c.Status,
+		"attempts":    c.Attempts,
+		"repo_owner":  c.RepoOwner.String,
+		"repo_name":   c.RepoName.String,
+		"repo_scoped": c.RepoScoped,
+	}
+
+	if c.EnqueuedAt.Valid {
+		maps.Copy(json, fiber.Map{
+			"enqueued_at": c.EnqueuedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	if c.ProcessedAt.Valid {
+		maps.Copy(json, fiber.Map{
+			"processed_at": c.ProcessedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	if c.LastError.Valid {
+		maps.Copy(json, fiber.Map{
+			"last_error": c.LastError.String,
+		})
+	}
+
+	return &json
+}
+
+// ToDetailMap includes the raw payload exactly as GitHub sent it.
+func (c WebhookDeliveries) ToDetailMap() *fiber.Map {
+	detail := c.ToMap()
+
+	if json.Valid(c.Payload) {
+		(*detail)["payload"] = json.RawMessage(c.Payload)
+	} else {
+		(*detail)["payload"] = string(c.Payload)
+	}
+
+	return detail
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type WebhookSecrets struct {
+	ID        uint64    `db:"id"`         // INT8 PKEY
+	Provider  string    `db:"provider"`   // VARCHAR(50)
+	Host      string    `db:"host"`       // VARCHAR(255)
+	CreatedAt time.Time `db:"created_at"` // TIMESTAMPZ
+	RepoOwner string    `db:"repo_owner"` // VARCHAR(255) idx
+	RepoName  string    `db:"repo_name"`  // VARCHAR(255) idx
+	Secret    string    `db:"secret"`     // VARCHAR(255)
+}
+
+// ToMap never exposes the secret itself, only enough to tell rotations apart.
+func (c WebhookSecrets) ToMap() *fiber.Map {
+	hint := ""
+
+	if len(c.Secret) >= 4 {
+		hint = c.Secret[len(c.Secret)-4:]
+	}
+
+	return &fiber.Map{
+		"id":          c.ID,
+		"provider":    c.Provider,
+		"host":        c.Host,
+		"created_at":  c.CreatedAt.Format(time.RFC3339),
+		"repo_owner":  c.RepoOwner,
+		"repo_name":   c.RepoName,
+		"secret_hint": hint,
+	}
+}
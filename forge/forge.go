@@ -0,0 +1,175 @@
+package forge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	ProviderGithub = "github"
+	ProviderGitlab = "gitlab"
+	ProviderGitea  = "gitea"
+
+	defaultGithubHost = "github.com"
+)
+
+var ErrNotAnIssueEvent = errors.New("not an issue webhook event")
+
+// Adapter turns one forge's issue webhooks into the provider neutral model.
+type Adapter interface {
+	Provider() string
+	// Verify reports whether the request was signed with one of secrets.
+	Verify(headers http.Header, body []byte, secrets []string) bool
+	DeliveryID(headers http.Header, body []byte) string
+	Event(headers http.Header) string
+	// IsIssueEvent reports whether event is one IssueEvent can parse.
+	IsIssueEvent(event string) bool
+	// Repository reads the repository out of a payload, nil when it has none.
+	Repository(body []byte) *Repository
+	IssueEvent(event string, body []byte) (*IssueEvent, error)
+}
+
+var Adapters = map[string]Adapter{
+	ProviderGithub: Github{},
+	ProviderGitlab: Gitlab{},
+	ProviderGitea:  Gitea{},
+}
+
+// IssueEvent is an issue webhook, the user and label shaped fields keep the
+// GitHub layout since that's how they're stored and served.
+type IssueEvent struct {
+	Action  string                 `json:"action"`
+	Issue   *Issue                 `json:"issue"`
+	Repo    *Repository            `json:"repository"`
+	Changes *IssueChanges          `json:"changes"`
+	Sender  map[string]interface{} `json:"sender"`
+}
+
+type IssueChanges struct {
+	NewIssue      *Issue      `json:"new_issue"`
+	NewRepository *Repository `json:"new_repository"`
+}
+
+type Issue struct {
+	ID                uint64                 `json:"id"`
+	CreatedAt         string                 `json:"created_at"`
+	UpdatedAt         *string                `json:"updated_at"`
+	ClosedAt          *string                `json:"closed_at"`
+	Title             string                 `json:"title"`
+	Body              *string                `json:"body"`
+	HTMLURL           string                 `json:"html_url"`
+	Number            uint64                 `json:"number"`
+	Comments          uint64                 `json:"comments"`
+	State             string                 `json:"state"`
+	StateReason       *string                `json:"state_reason"`
+	Locked            bool                   `json:"locked"`
+	ActiveLockReason  *string                `json:"active_lock_reason"`
+	AuthorAssociation string                 `json:"author_association"`
+	User              map[string]interface{} `json:"user"`
+	ClosedBy          map[string]interface{} `json:"closed_by"`
+	Milestone         map[string]interface{} `json:"milestone"`
+	Reactions         map[string]interface{} `json:"reactions"`
+	Labels            []interface{}          `json:"labels"`
+	Assignees         []interface{}          `json:"assignees"`
+	PullRequest       map[string]interface{} `json:"pull_request"`
+	// Confidential is set when the forge made the issue private, it's hidden
+	// until a payload without it arrives.
+	Confidential bool `json:"-"`
+}
+
+// Repository is identified by provider, host and owner/name, so the same
+// owner/name on two forges are different repositories.
+type Repository struct {
+	Provider string          `json:"-"`
+	Host     string          `json:"-"`
+	Name     string          `json:"name"`
+	Owner    RepositoryOwner `json:"owner"`
+	HTMLURL  string          `json:"html_url"`
+	// RepoScoped is set when only this repository's own webhook secret
+	// verified the delivery naming it. Such a delivery may only change the
+	// repository's own issues.
+	RepoScoped bool `json:"-"`
+	// ActorsSeenAt is when the payload's user profiles were current. Stored
+	// profiles only move forward, and a zero time, as for imports and
+	// replays, never changes one.
+	ActorsSeenAt time.Time `json:"-"`
+}
+
+type RepositoryOwner struct {
+	Login string `json:"login"`
+}
+
+// UnmarshalJSON reads a GitHub shaped repository, taking the host from its
+// html_url so GitHub Enterprise repositories don't mix with github.com.
+func (r *Repository) UnmarshalJSON(data []byte) error {
+	type repository Repository
+
+	if err := json.Unmarshal(data, (*repository)(r)); err != nil {
+		return err
+	}
+
+	if r.Provider == "" {
+		r.Provider = ProviderGithub
+	}
+
+	if r.Host == "" {
+		r.Host = hostOf(r.HTMLURL, defaultGithubHost)
+	}
+
+	return nil
+}
+
+func hostOf(rawURL string, fallback string) string {
+	parsed, err := url.Parse(rawURL)
+
+	if err != nil || parsed.Host == "" {
+		return fallback
+	}
+
+	return strings.ToLower(parsed.Host)
+}
+
+var indexNameUnsafe = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// IssueIndexName is the Meilisearch index holding a repository's issues.
+// github.com keeps the original issues-owner-name scheme, every other forge
+// gets its provider and host in the name plus a hash so names can't collide.
+func IssueIndexName(provider string, host string, owner string, name string) string {
+	owner, name = strings.ToLower(owner), strings.ToLower(name)
+
+	if isGithubDotCom(provider, host) {
+		return "issues-" + owner + "-" + name
+	}
+
+	sum := sha256.Sum256([]byte(provider + "/" + host + "/" + owner + "/" + name))
+
+	parts := []string{"issues", provider, host, owner, name}
+
+	for i, part := range parts {
+		parts[i] = indexNameUnsafe.ReplaceAllString(strings.ToLower(part), "_")
+	}
+
+	return strings.Join(parts, "_") + "_" + hex.EncodeToString(sum[:])[:12]
+}
+
+// RepoTopic is the WebSocket topic a repository's changes are broadcast on.
+// github.com keeps the original repo-name-owner topic clients subscribe to,
+// every other forge gets one named after its issue index.
+func RepoTopic(provider string, host string, owner string, name string) string {
+	if isGithubDotCom(provider, host) {
+		return "repo-" + name + "-" + owner
+	}
+
+	return "repo:" + IssueIndexName(provider, host, owner, name)
+}
+
+func isGithubDotCom(provider string, host string) bool {
+	return (provider == "" || provider == ProviderGithub) && (host == "" || host == defaultGithubHost)
+}
@@ -0,0 +1,32 @@
+package forge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRepoTopic(t *testing.T) {
+	// Clients subscribed before other forges were supported rely on these
+	for _, test := range []struct{ provider, host string }{{"", ""}, {ProviderGithub, ""}, {ProviderGithub, "github.com"}} {
+		if topic := RepoTopic(test.provider, test.host, "Octo", "Hello"); topic != "repo-Hello-Octo" {
+			t.Errorf("RepoTopic(%q, %q) = %s, want repo-Hello-Octo", test.provider, test.host, topic)
+		}
+	}
+
+	gitlab := RepoTopic(ProviderGitlab, "gitlab.com", "octo", "hello")
+	enterprise := RepoTopic(ProviderGithub, "github.example.com", "octo", "hello")
+
+	if !strings.HasPrefix(gitlab, "repo:issues_gitlab_gitlab_com_octo_hello_") {
+		t.Errorf("gitlab topic = %s", gitlab)
+	}
+
+	if enterprise == gitlab || !strings.Contains(enterprise, "github_example_com") {
+		t.Errorf("enterprise topic = %s, want its own host in it", enterprise)
+	}
+}
+
+func TestIssueIndexName(t *testing.T) {
+	if name := IssueIndexName(ProviderGithub, "github.com", "Octo", "Hello"); name != "issues-octo-hello" {
+		t.Errorf("IssueIndexName() = %s, want issues-octo-hello", name)
+	}
+}
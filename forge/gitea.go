@@ -0,0 +1,105 @@
+package forge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Gitea also covers Forgejo, which sends the same payloads under both its own
+// and Gitea's header names.
+type Gitea struct{}
+
+func (Gitea) Provider() string {
+	return ProviderGitea
+}
+
+func (Gitea) Verify(headers http.Header, body []byte, secrets []string) bool {
+	return verifyHMAC(body, giteaHeader(headers, "Signature"), secrets)
+}
+
+func (Gitea) DeliveryID(headers http.Header, body []byte) string {
+	deliveryID := giteaHeader(headers, "Delivery")
+
+	if deliveryID == "" {
+		return ""
+	}
+
+	return ProviderGitea + "-" + deliveryID
+}
+
+func (Gitea) Event(headers http.Header) string {
+	return giteaHeader(headers, "Event")
+}
+
+func (Gitea) IsIssueEvent(event string) bool {
+	return event == "issues"
+}
+
+func (Gitea) Repository(body []byte) *Repository {
+	var webhook struct {
+		Repo *Repository `json:"repository"`
+	}
+
+	if err := json.Unmarshal(body, &webhook); err != nil || webhook.Repo == nil {
+		return nil
+	}
+
+	if !giteaRepository(webhook.Repo) {
+		return nil
+	}
+
+	return webhook.Repo
+}
+
+// IssueEvent reads an "issues" webhook. Gitea payloads follow GitHub's apart
+// from the lock flag and milestones, which have no number of their own.
+func (Gitea) IssueEvent(event string, body []byte) (*IssueEvent, error) {
+	var webhook IssueEvent
+	var extra struct {
+		Issue struct {
+			IsLocked bool `json:"is_locked"`
+		} `json:"issue"`
+	}
+
+	if event != "issues" {
+		return nil, fmt.Errorf("%s: %w", event, ErrNotAnIssueEvent)
+	}
+
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, &extra); err != nil {
+		return nil, err
+	}
+
+	if webhook.Repo == nil || webhook.Issue == nil || !giteaRepository(webhook.Repo) {
+		return nil, ErrNotAnIssueEvent
+	}
+
+	webhook.Issue.Locked = extra.Issue.IsLocked
+
+	if milestone := webhook.Issue.Milestone; milestone != nil && milestone["number"] == nil {
+		milestone["number"] = milestone["id"]
+	}
+
+	return &webhook, nil
+}
+
+// giteaRepository swaps the GitHub defaults for Gitea's, it needs the
+// repository's html_url to know which Gitea instance sent it.
+func giteaRepository(repo *Repository) bool {
+	repo.Provider = ProviderGitea
+	repo.Host = hostOf(repo.HTMLURL, "")
+
+	return repo.Host != ""
+}
+
+func giteaHeader(headers http.Header, name string) string {
+	if value := headers.Get("X-Forgejo-" + name); value != "" {
+		return value
+	}
+
+	return headers.Get("X-Gitea-" + name)
+}
@@ -0,0 +1,81 @@
+package forge
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+const giteaIssuesBody = `{
+	"action": "closed",
+	"issue": {
+		"id": 88, "number": 4, "title": "Crash on start", "body": "It crashes", "state": "closed",
+		"html_url": "https://Code.example.org/octo/hello/issues/4",
+		"created_at": "2024-03-01T10:00:00Z", "updated_at": "2024-03-02T10:00:00+01:00",
+		"is_locked": true,
+		"user": {"id": 3, "login": "octocat"},
+		"milestone": {"id": 6, "title": "v1"}
+	},
+	"repository": {"name": "hello", "owner": {"login": "octo"}, "html_url": "https://Code.example.org/octo/hello"},
+	"sender": {"id": 3, "login": "octocat"}
+}`
+
+func TestGiteaIssueEvent(t *testing.T) {
+	event, err := Gitea{}.IssueEvent("issues", []byte(giteaIssuesBody))
+
+	if err != nil {
+		t.Fatalf("IssueEvent() error = %v", err)
+	}
+
+	if event.Action != "closed" {
+		t.Errorf("action = %s, want closed", event.Action)
+	}
+
+	if repo := event.Repo; repo.Provider != ProviderGitea || repo.Host != "code.example.org" || repo.Owner.Login != "octo" || repo.Name != "hello" {
+		t.Errorf("repo = %s %s %s/%s, want gitea code.example.org octo/hello", repo.Provider, repo.Host, repo.Owner.Login, repo.Name)
+	}
+
+	if !event.Issue.Locked {
+		t.Error("issue isn't locked, want is_locked read into it")
+	}
+
+	// Milestones have no number of their own, the id stands in
+	if number := event.Issue.Milestone["number"]; number != float64(6) {
+		t.Errorf("milestone number = %v, want its id", number)
+	}
+
+	if _, err := (Gitea{}).IssueEvent("issue_comment", []byte(giteaIssuesBody)); !errors.Is(err, ErrNotAnIssueEvent) {
+		t.Errorf("IssueEvent(issue_comment) error = %v, want ErrNotAnIssueEvent", err)
+	}
+
+	// The host comes from html_url, a repository without one can't be placed
+	if _, err := (Gitea{}).IssueEvent("issues", []byte(`{"action": "opened", "issue": {"id": 1}, "repository": {"name": "hello"}}`)); !errors.Is(err, ErrNotAnIssueEvent) {
+		t.Errorf("IssueEvent() without html_url error = %v, want ErrNotAnIssueEvent", err)
+	}
+}
+
+func TestGiteaHeaders(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		headers         map[string]string
+		delivery, event string
+	}{
+		{"gitea", map[string]string{"X-Gitea-Delivery": "d1", "X-Gitea-Event": "issues"}, "gitea-d1", "issues"},
+		{"forgejo", map[string]string{"X-Forgejo-Delivery": "d2", "X-Forgejo-Event": "issues", "X-Gitea-Delivery": "d1"}, "gitea-d2", "issues"},
+		{"none", map[string]string{}, "", ""},
+	} {
+		headers := http.Header{}
+
+		for key, value := range test.headers {
+			headers.Set(key, value)
+		}
+
+		if delivery := (Gitea{}).DeliveryID(headers, []byte(giteaIssuesBody)); delivery != test.delivery {
+			t.Errorf("%s: DeliveryID() = %q, want %q", test.name, delivery, test.delivery)
+		}
+
+		if event := (Gitea{}).Event(headers); event != test.event {
+			t.Errorf("%s: Event() = %q, want %q", test.name, event, test.event)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package forge
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	githubSignaturePrefix = "sha256="
+)
+
+type Github struct{}
+
+func (Github) Provider() string {
+	return ProviderGithub
+}
+
+func (Github) Verify(headers http.Header, body []byte, secrets []string) bool {
+	return VerifyGithubSignature(body, headers.Get("X-Hub-Signature-256"), secrets)
+}
+
+func (Github) DeliveryID(headers http.Header, body []byte) string {
+	return headers.Get("X-GitHub-Delivery")
+}
+
+func (Github) Event(headers http.Header) string {
+	return headers.Get("X-GitHub-Event")
+}
+
+func (Github) IsIssueEvent(event string) bool {
+	return event == "issues"
+}
+
+func (Github) Repository(body []byte) *Repository {
+	var webhook struct {
+		Repo *Repository `json:"repository"`
+	}
+
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil
+	}
+
+	return webhook.Repo
+}
+
+// IssueEvent reads an "issues" webhook, GitHub payloads are already in the
+// neutral shape.
+func (Github) IssueEvent(event string, body []byte) (*IssueEvent, error) {
+	var webhook IssueEvent
+
+	if event != "issues" {
+		return nil, fmt.Errorf("%s: %w", event, ErrNotAnIssueEvent)
+	}
+
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// VerifyGithubSignature checks an X-Hub-Signature-256 header against every
+// active secret, so old and new secrets both pass while a key is rotated.
+func VerifyGithubSignature(body []byte, signature string, secrets []string) bool {
+	if !strings.HasPrefix(signature, githubSignaturePrefix) {
+		return false
+	}
+
+	return verifyHMAC(body, strings.TrimPrefix(signature, githubSignaturePrefix), secrets)
+}
+
+// verifyHMAC checks a hex encoded HMAC-SHA256 of body against every secret.
+func verifyHMAC(body []byte, signature string, secrets []string) bool {
+	expected, err := hex.DecodeString(signature)
+
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+
+	valid := false
+
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+
+		// Keep going after a match so timing doesn't leak which secret matched
+		if hmac.Equal(mac.Sum(nil), expected) {
+			valid = true
+		}
+	}
+
+	return valid
+}
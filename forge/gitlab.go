@@ -0,0 +1,310 @@
+package forge
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// gitlabTimeLayouts are the timestamp formats GitLab has used in webhooks,
+// older versions send "2013-12-03 17:15:43 UTC".
+var gitlabTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05 -0700",
+}
+
+// gitlabActions maps GitLab's issue actions onto GitHub's.
+var gitlabActions = map[string]string{
+	"open":   "opened",
+	"close":  "closed",
+	"reopen": "reopened",
+	"update": "edited",
+}
+
+type Gitlab struct{}
+
+type gitlabUser struct {
+	ID        uint64 `json:"id"`
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type gitlabProject struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+type gitlabLabel struct {
+	ID          uint64  `json:"id"`
+	Title       string  `json:"title"`
+	Color       string  `json:"color"`
+	Description *string `json:"description"`
+}
+
+type gitlabIssueHook struct {
+	ObjectKind string         `json:"object_kind"`
+	User       *gitlabUser    `json:"user"`
+	Project    *gitlabProject `json:"project"`
+	Attributes *struct {
+		ID               uint64  `json:"id"`
+		IID              uint64  `json:"iid"`
+		Title            string  `json:"title"`
+		Description      *string `json:"description"`
+		State            string  `json:"state"`
+		Action           string  `json:"action"`
+		URL              string  `json:"url"`
+		AuthorID         uint64  `json:"author_id"`
+		CreatedAt        string  `json:"created_at"`
+		UpdatedAt        string  `json:"updated_at"`
+		ClosedAt         *string `json:"closed_at"`
+		DiscussionLocked *bool   `json:"discussion_locked"`
+	} `json:"object_attributes"`
+	Labels    []gitlabLabel `json:"labels"`
+	Assignees []gitlabUser  `json:"assignees"`
+}
+
+func (Gitlab) Provider() string {
+	return ProviderGitlab
+}
+
+// Verify compares X-Gitlab-Token, GitLab sends the secret itself rather than
+// signing the body.
+func (Gitlab) Verify(headers http.Header, body []byte, secrets []string) bool {
+	token := []byte(headers.Get("X-Gitlab-Token"))
+
+	if len(token) == 0 {
+		return false
+	}
+
+	valid := false
+
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare(token, []byte(secret)) == 1 {
+			valid = true
+		}
+	}
+
+	return valid
+}
+
+// DeliveryID uses the event UUID, older GitLab versions don't send one so the
+// body hash stands in, which still catches the same delivery arriving twice.
+func (Gitlab) DeliveryID(headers http.Header, body []byte) string {
+	deliveryID := headers.Get("X-Gitlab-Event-UUID")
+
+	if deliveryID == "" {
+		sum := sha256.Sum256(body)
+		deliveryID = hex.EncodeToString(sum[:])
+	}
+
+	return ProviderGitlab + "-" + deliveryID
+}
+
+func (Gitlab) Event(headers http.Header) string {
+	return headers.Get("X-Gitlab-Event")
+}
+
+// IsIssueEvent takes confidential issue hooks too, they hide the issue so it
+// doesn't stay in search once it's made confidential.
+func (Gitlab) IsIssueEvent(event string) bool {
+	return event == "Issue Hook" || event == "Confidential Issue Hook"
+}
+
+func (Gitlab) Repository(body []byte) *Repository {
+	var webhook struct {
+		Project *gitlabProject `json:"project"`
+	}
+
+	if err := json.Unmarshal(body, &webhook); err != nil || webhook.Project == nil {
+		return nil
+	}
+
+	return gitlabRepository(webhook.Project)
+}
+
+func (Gitlab) IssueEvent(event string, body []byte) (*IssueEvent, error) {
+	var webhook gitlabIssueHook
+
+	if !(Gitlab{}).IsIssueEvent(event) {
+		return nil, fmt.Errorf("%s: %w", event, ErrNotAnIssueEvent)
+	}
+
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, err
+	}
+
+	if webhook.ObjectKind != "issue" || webhook.Attributes == nil || webhook.Project == nil {
+		return nil, ErrNotAnIssueEvent
+	}
+
+	repo := gitlabRepository(webhook.Project)
+
+	if repo == nil {
+		return nil, ErrNotAnIssueEvent
+	}
+
+	attributes := webhook.Attributes
+
+	createdAt, err := gitlabTime(attributes.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	updatedAt, err := gitlabTime(attributes.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var closedAt *string
+
+	if attributes.ClosedAt != nil && *attributes.ClosedAt != "" {
+		closed, err := gitlabTime(*attributes.ClosedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		closedAt = &closed
+	}
+
+	state := "open"
+
+	if attributes.State == "closed" {
+		state = "closed"
+	}
+
+	action, ok := gitlabActions[attributes.Action]
+
+	if !ok {
+		action = "edited"
+	}
+
+	sender := gitlabUserMap(webhook.User, repo.Host)
+
+	// The hook only names the author by id, the user is who triggered it. The
+	// stored author stands in when it's someone else, failing that the worker
+	// fetches the profile, see HandleForgeFetchActor.
+	author := map[string]interface{}{"id": attributes.AuthorID}
+
+	if webhook.User != nil && webhook.User.ID == attributes.AuthorID {
+		author = sender
+	}
+
+	labels := []interface{}{}
+
+	for _, label := range webhook.Labels {
+		labels = append(labels, map[string]interface{}{
+			"id":          label.ID,
+			"name":        label.Title,
+			"color":       strings.TrimPrefix(label.Color, "#"),
+			"description": label.Description,
+			"default":     false,
+		})
+	}
+
+	assignees := []interface{}{}
+
+	for i := range webhook.Assignees {
+		assignees = append(assignees, gitlabUserMap(&webhook.Assignees[i], repo.Host))
+	}
+
+	issue := &Issue{
+		ID:        attributes.ID,
+		CreatedAt: createdAt,
+		UpdatedAt: &updatedAt,
+		ClosedAt:  closedAt,
+		Title:     attributes.Title,
+		Body:      attributes.Description,
+		HTMLURL:   attributes.URL,
+		Number:    attributes.IID,
+		State:     state,
+		Locked:    attributes.DiscussionLocked != nil && *attributes.DiscussionLocked,
+		User:      author,
+		Labels:    labels,
+		Assignees: assignees,
+		// Its payload isn't stored, see Issue.Confidential
+		Confidential: event == "Confidential Issue Hook",
+	}
+
+	return &IssueEvent{
+		Action: action,
+		Issue:  issue,
+		Repo:   repo,
+		Sender: sender,
+	}, nil
+}
+
+// gitlabRepository splits a project path into owner and name, the owner is
+// the full namespace so nested groups stay distinct.
+func gitlabRepository(project *gitlabProject) *Repository {
+	host := hostOf(project.WebURL, "")
+	slash := strings.LastIndex(project.PathWithNamespace, "/")
+
+	if host == "" || slash <= 0 {
+		return nil
+	}
+
+	return &Repository{
+		Provider: ProviderGitlab,
+		Host:     host,
+		Name:     project.PathWithNamespace[slash+1:],
+		Owner:    RepositoryOwner{Login: project.PathWithNamespace[:slash]},
+		HTMLURL:  project.WebURL,
+	}
+}
+
+// GitlabUserURL is where a GitLab instance serves a user's public profile.
+func GitlabUserURL(host string, id uint64) string {
+	return fmt.Sprintf("https://%s/api/v4/users/%d", host, id)
+}
+
+// GitlabUser reads a profile from GitLab's users API in the GitHub layout.
+func GitlabUser(host string, body []byte) (map[string]interface{}, error) {
+	var user gitlabUser
+
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, err
+	}
+
+	if user.ID == 0 || user.Username == "" {
+		return nil, fmt.Errorf("gitlab user without an id or username")
+	}
+
+	return gitlabUserMap(&user, host), nil
+}
+
+func gitlabUserMap(user *gitlabUser, host string) map[string]interface{} {
+	if user == nil {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"id":         user.ID,
+		"login":      user.Username,
+		"avatar_url": user.AvatarURL,
+		"html_url":   "https://" + host + "/" + user.Username,
+		"type":       "User",
+	}
+}
+
+func gitlabTime(value string) (string, error) {
+	for _, layout := range gitlabTimeLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.UTC().Format(time.RFC3339), nil
+		}
+	}
+
+	return "", fmt.Errorf("unrecognised gitlab time %q", value)
+}
@@ -0,0 +1,192 @@
+package forge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// gitlabIssueHookBody is a trimmed "Issue Hook" payload, user 7 triggered it.
+func gitlabIssueHookBody(path string, action string, authorID uint64, createdAt string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"object_kind": "issue",
+		"user": {"id": 7, "username": "maintainer", "avatar_url": "https://gitlab.example.com/a/7.png"},
+		"project": {"path_with_namespace": %q, "web_url": "https://GitLab.example.com/%s"},
+		"object_attributes": {
+			"id": 301, "iid": 12, "title": "Crash on start", "description": "It crashes",
+			"state": "closed", "action": %q, "url": "https://gitlab.example.com/%s/-/issues/12",
+			"author_id": %d, "created_at": %q, "updated_at": %q, "closed_at": %q,
+			"discussion_locked": true
+		},
+		"labels": [{"id": 5, "title": "bug", "color": "#d73a4a"}],
+		"assignees": [{"id": 9, "username": "fixer"}]
+	}`, path, path, action, path, authorID, createdAt, createdAt, createdAt))
+}
+
+func TestGitlabIssueEventTimes(t *testing.T) {
+	for _, test := range []struct{ value, want string }{
+		{"2024-03-01T10:00:00Z", "2024-03-01T10:00:00Z"},
+		{"2024-03-01T12:00:00+02:00", "2024-03-01T10:00:00Z"},
+		{"2013-12-03 17:15:43 UTC", "2013-12-03T17:15:43Z"},
+		{"2024-03-01 12:00:00 +0200", "2024-03-01T10:00:00Z"},
+	} {
+		event, err := Gitlab{}.IssueEvent("Issue Hook", gitlabIssueHookBody("octo/hello", "close", 7, test.value))
+
+		if err != nil {
+			t.Errorf("IssueEvent(%q) error = %v", test.value, err)
+
+			continue
+		}
+
+		if event.Issue.CreatedAt != test.want || *event.Issue.UpdatedAt != test.want || *event.Issue.ClosedAt != test.want {
+			t.Errorf("IssueEvent(%q) times = %s, %s, %s, want %s", test.value,
+				event.Issue.CreatedAt, *event.Issue.UpdatedAt, *event.Issue.ClosedAt, test.want)
+		}
+	}
+
+	if _, err := (Gitlab{}).IssueEvent("Issue Hook", gitlabIssueHookBody("octo/hello", "close", 7, "03/01/2024")); err == nil {
+		t.Error("IssueEvent() with an unknown time format succeeded, want an error")
+	}
+}
+
+func TestGitlabIssueEventActions(t *testing.T) {
+	for _, test := range []struct {
+		event, action, want string
+		confidential        bool
+	}{
+		{"Issue Hook", "open", "opened", false},
+		{"Issue Hook", "close", "closed", false},
+		{"Issue Hook", "reopen", "reopened", false},
+		{"Issue Hook", "update", "edited", false},
+		{"Issue Hook", "", "edited", false},
+		{"Confidential Issue Hook", "update", "edited", true},
+		{"Confidential Issue Hook", "open", "opened", true},
+	} {
+		event, err := Gitlab{}.IssueEvent(test.event, gitlabIssueHookBody("octo/hello", test.action, 7, "2024-03-01T10:00:00Z"))
+
+		if err != nil {
+			t.Errorf("IssueEvent(%q, %q) error = %v", test.event, test.action, err)
+		} else if event.Action != test.want || event.Issue.Confidential != test.confidential {
+			t.Errorf("IssueEvent(%q, %q) action = %s, confidential = %v, want %s, %v", test.event, test.action,
+				event.Action, event.Issue.Confidential, test.want, test.confidential)
+		}
+	}
+
+	if _, err := (Gitlab{}).IssueEvent("Note Hook", gitlabIssueHookBody("octo/hello", "open", 7, "2024-03-01T10:00:00Z")); !errors.Is(err, ErrNotAnIssueEvent) {
+		t.Errorf("IssueEvent(Note Hook) error = %v, want ErrNotAnIssueEvent", err)
+	}
+}
+
+func TestGitlabIssueEventRepository(t *testing.T) {
+	for _, test := range []struct{ path, owner, name string }{
+		{"octo/hello", "octo", "hello"},
+		{"octo/tools/hello", "octo/tools", "hello"},
+		{"octo/tools/cli/hello", "octo/tools/cli", "hello"},
+	} {
+		event, err := Gitlab{}.IssueEvent("Issue Hook", gitlabIssueHookBody(test.path, "open", 7, "2024-03-01T10:00:00Z"))
+
+		if err != nil {
+			t.Errorf("IssueEvent(%q) error = %v", test.path, err)
+
+			continue
+		}
+
+		repo := event.Repo
+
+		if repo.Provider != ProviderGitlab || repo.Host != "gitlab.example.com" || repo.Owner.Login != test.owner || repo.Name != test.name {
+			t.Errorf("IssueEvent(%q) repo = %s %s %s/%s, want gitlab gitlab.example.com %s/%s", test.path,
+				repo.Provider, repo.Host, repo.Owner.Login, repo.Name, test.owner, test.name)
+		}
+	}
+
+	// A project path without a namespace can't be split
+	if _, err := (Gitlab{}).IssueEvent("Issue Hook", gitlabIssueHookBody("hello", "open", 7, "2024-03-01T10:00:00Z")); !errors.Is(err, ErrNotAnIssueEvent) {
+		t.Errorf("IssueEvent(hello) error = %v, want ErrNotAnIssueEvent", err)
+	}
+}
+
+func TestGitlabIssueEventIssue(t *testing.T) {
+	event, err := Gitlab{}.IssueEvent("Issue Hook", gitlabIssueHookBody("octo/hello", "close", 7, "2024-03-01T10:00:00Z"))
+
+	if err != nil {
+		t.Fatalf("IssueEvent() error = %v", err)
+	}
+
+	issue := event.Issue
+
+	if issue.ID != 301 || issue.Number != 12 || issue.State != "closed" || !issue.Locked || *issue.Body != "It crashes" {
+		t.Errorf("issue = %+v", issue)
+	}
+
+	if issue.User["login"] != "maintainer" || event.Sender["login"] != "maintainer" {
+		t.Errorf("author = %v, sender = %v, want both to be the maintainer", issue.User, event.Sender)
+	}
+
+	if label := issue.Labels[0].(map[string]interface{}); label["name"] != "bug" || label["color"] != "d73a4a" {
+		t.Errorf("label = %v, want bug without the # on its color", label)
+	}
+
+	if assignee := issue.Assignees[0].(map[string]interface{}); assignee["login"] != "fixer" || assignee["html_url"] != "https://gitlab.example.com/fixer" {
+		t.Errorf("assignee = %v", assignee)
+	}
+
+	// Someone other than the author triggered it, the hook only has the author's id
+	event, err = Gitlab{}.IssueEvent("Issue Hook", gitlabIssueHookBody("octo/hello", "close", 8, "2024-03-01T10:00:00Z"))
+
+	if err != nil {
+		t.Fatalf("IssueEvent() error = %v", err)
+	}
+
+	if event.Issue.User["id"] != uint64(8) || event.Issue.User["login"] != nil {
+		t.Errorf("author = %v, want only id 8", event.Issue.User)
+	}
+}
+
+func TestGitlabDeliveryID(t *testing.T) {
+	body := gitlabIssueHookBody("octo/hello", "open", 7, "2024-03-01T10:00:00Z")
+	other := gitlabIssueHookBody("octo/hello", "close", 7, "2024-03-01T10:00:00Z")
+
+	headers := http.Header{}
+	headers.Set("X-Gitlab-Event-UUID", "3f7d1c2e")
+
+	if id := (Gitlab{}).DeliveryID(headers, body); id != "gitlab-3f7d1c2e" {
+		t.Errorf("DeliveryID() = %s, want gitlab-3f7d1c2e", id)
+	}
+
+	// Without the UUID header the body hash stands in
+	first := Gitlab{}.DeliveryID(http.Header{}, body)
+
+	if !strings.HasPrefix(first, "gitlab-") || len(first) != len("gitlab-")+64 {
+		t.Errorf("DeliveryID() = %s, want gitlab- and a sha256 hex digest", first)
+	}
+
+	if again := (Gitlab{}).DeliveryID(http.Header{}, body); again != first {
+		t.Errorf("DeliveryID() of the same body = %s, then %s", first, again)
+	}
+
+	if changed := (Gitlab{}).DeliveryID(http.Header{}, other); changed == first {
+		t.Errorf("DeliveryID() of another body = %s, want a different id", changed)
+	}
+}
+
+func TestGitlabUser(t *testing.T) {
+	user, err := GitlabUser("gitlab.example.com", []byte(`{"id": 8, "username": "author", "avatar_url": "https://gitlab.example.com/a/8.png", "state": "active"}`))
+
+	if err != nil {
+		t.Fatalf("GitlabUser() error = %v", err)
+	}
+
+	if user["id"] != uint64(8) || user["login"] != "author" || user["html_url"] != "https://gitlab.example.com/author" {
+		t.Errorf("GitlabUser() = %v", user)
+	}
+
+	if _, err := GitlabUser("gitlab.example.com", []byte(`{"message": "404 User Not Found"}`)); err == nil {
+		t.Error("GitlabUser() of an error body succeeded, want an error")
+	}
+
+	if url := GitlabUserURL("gitlab.example.com", 8); url != "https://gitlab.example.com/api/v4/users/8" {
+		t.Errorf("GitlabUserURL() = %s", url)
+	}
+}
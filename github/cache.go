@@ -0,0 +1,96 @@
+package github
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
+
+// Conditionally requested pages are kept a day, a 304 for them doesn't count
+// against the quota
+const cacheTTL = 24 * time.Hour
+
+type cachedResponse struct {
+	ETag         string      `json:"etag"`
+	LastModified string      `json:"last_modified"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+func cacheKey(path string) string {
+	sum := sha256.Sum256([]byte(path))
+
+	return "github:cache:" + hex.EncodeToString(sum[:])
+}
+
+func (c *Client) cached(ctx context.Context, path string) (*cachedResponse, error) {
+	value, err := c.store.Get(ctx, cacheKey(path))
+
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	cached := cachedResponse{}
+
+	if err := json.Unmarshal(value, &cached); err != nil {
+		return nil, err
+	}
+
+	return &cached, nil
+}
+
+// cache keeps a successful response that GitHub can validate later.
+func (c *Client) cache(ctx context.Context, path string, resp *req.Response, body []byte) {
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+
+	if etag == "" && lastModified == "" {
+		return
+	}
+
+	value, err := json.Marshal(cachedResponse{
+		ETag:         etag,
+		LastModified: lastModified,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Body:         body,
+	})
+
+	if err == nil {
+		err = c.store.Set(ctx, cacheKey(path), value, cacheTTL)
+	}
+
+	if err != nil {
+		slog.Warn("💀 Could not cache github response",
+			slog.String("url", path),
+			slog.String("error", err.Error()))
+	}
+}
+
+// response answers a 304 with the cached copy, headers that came with the 304
+// (rate limits, X-Poll-Interval) win over the cached ones.
+func (c *cachedResponse) response(fresh http.Header) *Response {
+	header := c.Header.Clone()
+
+	if header == nil {
+		header = http.Header{}
+	}
+
+	for key, values := range fresh {
+		header[key] = values
+	}
+
+	return &Response{
+		StatusCode: c.StatusCode,
+		Header:     header,
+		Body:       c.Body,
+		Cached:     true,
+	}
+}
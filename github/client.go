@@ -0,0 +1,272 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/imroc/req/v3"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultBaseURL = "https://api.github.com"
+
+	// DefaultMaxWait is how long a request sleeps through a rate limit before
+	// giving up with a RateLimitedError.
+	DefaultMaxWait = time.Minute
+
+	// A request that keeps getting rate limited gives up after this many tries
+	maxAttempts = 5
+)
+
+type Config struct {
+	// BaseURL is the REST API root, e.g. https://host/api/v3 for Enterprise
+	// Server or a local stand-in server. Defaults to DefaultBaseURL.
+	BaseURL string
+	// Tokens are used round-robin, a rate limited token is skipped until it
+	// resets. Without tokens requests are anonymous.
+	Tokens []string
+	// Redis shares rate limit state and cached responses between replicas,
+	// without it they're kept in memory.
+	Redis   *redis.Client
+	MaxWait time.Duration
+}
+
+// Client is a GitHub REST API client that waits out rate limits and answers
+// repeated requests with conditional ones, so unchanged pages don't use quota.
+type Client struct {
+	client  *req.Client
+	host    string
+	store   store
+	tokens  []string
+	maxWait time.Duration
+}
+
+// Response is a successful GET. Cached is set when GitHub answered 304 and
+// the body is the copy we already had.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Cached     bool
+}
+
+// StatusError is any response that isn't a success, a 304 or a rate limit.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	URL        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("github responded %s for %s", e.Status, e.URL)
+}
+
+// Temporary reports whether asking again later might work.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500
+}
+
+// RateLimitedError is returned when every token is rate limited for longer
+// than the client is willing to wait.
+type RateLimitedError struct {
+	Until time.Time
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("github rate limited until %s", e.Until.Format(time.RFC3339))
+}
+
+func New(config Config) *Client {
+	baseURL := strings.TrimRight(config.BaseURL, "/")
+
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	maxWait := config.MaxWait
+
+	if maxWait == 0 {
+		maxWait = DefaultMaxWait
+	}
+
+	var s store = newMemoryStore()
+
+	if config.Redis != nil {
+		s = redisStore{rdb: config.Redis}
+	}
+
+	client := req.C().
+		SetBaseURL(baseURL).
+		SetUserAgent("issues-sync").
+		SetTimeout(30*time.Second).
+		SetCommonHeader("Accept", "application/vnd.github+json").
+		SetCommonHeader("X-GitHub-Api-Version", "2022-11-28")
+
+	return &Client{
+		client:  client,
+		host:    Host(baseURL),
+		store:   s,
+		tokens:  config.Tokens,
+		maxWait: maxWait,
+	}
+}
+
+// Host is the forge host an API base URL serves, github.com for
+// DefaultBaseURL and the base URL's own host for Enterprise Server.
+func Host(baseURL string) string {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	parsed, err := url.Parse(baseURL)
+
+	if err != nil {
+		return ""
+	}
+
+	host := strings.ToLower(parsed.Host)
+
+	if host == "api.github.com" {
+		return "github.com"
+	}
+
+	return host
+}
+
+// Host is the forge host the client talks to, repositories on any other host
+// can't be fetched with it.
+func (c *Client) Host() string {
+	return c.host
+}
+
+// NewFromEnv configures a client from GITHUB_API_URL and GITHUB_TOKENS (comma
+// separated) or GITHUB_TOKEN.
+func NewFromEnv(rdb *redis.Client) *Client {
+	tokens := []string{}
+
+	for _, token := range strings.Split(os.Getenv("GITHUB_TOKENS")+","+os.Getenv("GITHUB_TOKEN"), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return New(Config{
+		BaseURL: os.Getenv("GITHUB_API_URL"),
+		Tokens:  tokens,
+		Redis:   rdb,
+	})
+}
+
+// Get fetches path, relative to the base URL, or an absolute URL such as the
+// next page from a Link header.
+func (c *Client) Get(ctx context.Context, path string) (*Response, error) {
+	return c.get(ctx, path, false)
+}
+
+// GetConditional is Get for something asked for again and again, such as the
+// events feed. The response is cached and revalidated next time, so a 304
+// doesn't use quota and comes back with the cached body.
+func (c *Client) GetConditional(ctx context.Context, path string) (*Response, error) {
+	return c.get(ctx, path, true)
+}
+
+func (c *Client) get(ctx context.Context, path string, conditional bool) (*Response, error) {
+	var cached *cachedResponse
+
+	if conditional {
+		var err error
+
+		cached, err = c.cached(ctx, path)
+
+		if err != nil {
+			slog.Warn("💀 Could not read github response cache",
+				slog.String("url", path),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		token, err := c.token(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		request := c.client.R().SetContext(ctx)
+
+		if token != "" {
+			request.SetBearerAuthToken(token)
+		}
+
+		if cached != nil {
+			if cached.ETag != "" {
+				request.SetHeader("If-None-Match", cached.ETag)
+			}
+
+			if cached.LastModified != "" {
+				request.SetHeader("If-Modified-Since", cached.LastModified)
+			}
+		}
+
+		resp, err := request.Get(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		until, rejected := rateLimit(resp, attempt)
+
+		if !until.IsZero() {
+			c.limit(ctx, token, until)
+		}
+
+		switch {
+		case rejected:
+			continue
+		case resp.StatusCode == http.StatusNotModified && cached != nil:
+			return cached.response(resp.Header), nil
+		case resp.IsErrorState():
+			return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, URL: path}
+		}
+
+		body := resp.Bytes()
+
+		if conditional {
+			c.cache(ctx, path, resp, body)
+		}
+
+		return &Response{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       body,
+		}, nil
+	}
+
+	return nil, &RateLimitedError{Until: time.Now().Add(c.maxWait)}
+}
+
+// RepoPath is the API path of a repository.
+func RepoPath(owner string, name string) string {
+	return fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(name))
+}
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// NextPage reads the rel="next" URL out of a Link header.
+func NextPage(header http.Header) string {
+	for _, part := range strings.Split(header.Get("Link"), ",") {
+		if match := nextLink.FindStringSubmatch(part); match != nil {
+			return match[1]
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,194 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/macwilko/issues-sync/github/githubtest"
+)
+
+func TestGetConditionalRevalidates(t *testing.T) {
+	s := githubtest.New(t)
+	client := New(Config{BaseURL: s.URL})
+
+	first, err := client.GetConditional(context.Background(), "/repos/octo/hello/events")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Cached {
+		t.Error("first response is cached")
+	}
+
+	second, err := client.GetConditional(context.Background(), "/repos/octo/hello/events")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if match := s.Requests()[1].IfNoneMatch; match != `"v1"` {
+		t.Errorf("If-None-Match = %q, want the cached ETag", match)
+	}
+
+	if !second.Cached || string(second.Body) != `[{"id":"1"}]` {
+		t.Errorf("second response = %+v, want the cached body", second)
+	}
+
+	if second.StatusCode != http.StatusOK || second.Header.Get("X-Poll-Interval") != "60" {
+		t.Errorf("second response = %d %v, want the cached status and the 304's headers", second.StatusCode, second.Header)
+	}
+}
+
+func TestGetIsNotCached(t *testing.T) {
+	s := githubtest.New(t)
+	client := New(Config{BaseURL: s.URL})
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(context.Background(), "/repos/octo/hello")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Cached {
+			t.Errorf("response %d is cached", i)
+		}
+	}
+
+	for i, request := range s.Requests() {
+		if request.IfNoneMatch != "" {
+			t.Errorf("request %d sent If-None-Match %q", i, request.IfNoneMatch)
+		}
+	}
+}
+
+func TestGetStatusError(t *testing.T) {
+	s := githubtest.New(t)
+	client := New(Config{BaseURL: s.URL})
+
+	_, err := client.Get(context.Background(), "/repos/octo/missing")
+
+	var statusErr *StatusError
+
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || statusErr.Temporary() {
+		t.Errorf("err = %v, want a permanent 404 StatusError", err)
+	}
+}
+
+func TestTokensRoundRobin(t *testing.T) {
+	s := githubtest.New(t)
+	client := New(Config{BaseURL: s.URL, Tokens: []string{"a", "b", "c"}})
+
+	for i := 0; i < 6; i++ {
+		if _, err := client.Get(context.Background(), "/repos/octo/hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	used := map[string]int{}
+	requests := s.Requests()
+
+	for i, request := range requests {
+		used[request.Token]++
+
+		if i > 0 && request.Token == requests[i-1].Token {
+			t.Errorf("token %q used twice in a row", request.Token)
+		}
+	}
+
+	for _, token := range []string{"a", "b", "c"} {
+		if used[token] != 2 {
+			t.Errorf("token %q used %d times, want 2", token, used[token])
+		}
+	}
+}
+
+func TestRateLimitedTokenIsSkipped(t *testing.T) {
+	s := githubtest.New(t)
+	s.Limit("a")
+
+	client := New(Config{BaseURL: s.URL, Tokens: []string{"a", "b"}})
+
+	for i := 0; i < 4; i++ {
+		if _, err := client.Get(context.Background(), "/repos/octo/hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	used := 0
+
+	for _, request := range s.Requests() {
+		if request.Token == "a" {
+			used++
+		}
+	}
+
+	if used != 1 {
+		t.Errorf("limited token used %d times, want only the request that found out", used)
+	}
+}
+
+func TestRateLimitStateIsShared(t *testing.T) {
+	s := githubtest.New(t)
+	s.Limit("a")
+	s.Limit("b")
+
+	config := Config{BaseURL: s.URL, Tokens: []string{"a", "b"}, MaxWait: time.Second}
+	first := New(config)
+	second := New(config)
+
+	// Replicas share state through Redis, here both use the same store
+	second.store = first.store
+
+	_, err := first.Get(context.Background(), "/repos/octo/hello")
+
+	var limited *RateLimitedError
+
+	if !errors.As(err, &limited) || time.Until(limited.Until) < 30*time.Minute {
+		t.Fatalf("err = %v, want a RateLimitedError until the reset", err)
+	}
+
+	requests := len(s.Requests())
+
+	_, err = second.Get(context.Background(), "/repos/octo/hello")
+
+	if !errors.As(err, &limited) {
+		t.Fatalf("err = %v, want a RateLimitedError", err)
+	}
+
+	if made := len(s.Requests()) - requests; made != 0 {
+		t.Errorf("second client made %d requests with tokens the first found limited", made)
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	header := http.Header{}
+	header.Set("Link", `<https://api.github.com/repositories/1/issues?page=3>; rel="next", <https://api.github.com/repositories/1/issues?page=9>; rel="last"`)
+
+	if next := NextPage(header); next != "https://api.github.com/repositories/1/issues?page=3" {
+		t.Errorf("NextPage = %q", next)
+	}
+
+	if next := NextPage(http.Header{}); next != "" {
+		t.Errorf("NextPage without a Link header = %q, want none", next)
+	}
+}
+
+func TestHost(t *testing.T) {
+	hosts := map[string]string{
+		"":                               "github.com",
+		"https://api.github.com":         "github.com",
+		"https://GHE.example.com/api/v3": "ghe.example.com",
+		"http://127.0.0.1:8080":          "127.0.0.1:8080",
+	}
+
+	for baseURL, want := range hosts {
+		if got := New(Config{BaseURL: baseURL}).Host(); got != want {
+			t.Errorf("Host() for %q = %q, want %q", baseURL, got, want)
+		}
+	}
+}
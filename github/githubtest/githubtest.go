@@ -0,0 +1,120 @@
+// Package githubtest serves a stand-in GitHub API for tests: octo/hello, its
+// events and two pages of its issues, the first with a pull request on it.
+package githubtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Request is a request the stand-in got.
+type Request struct {
+	URI         string
+	Token       string
+	IfNoneMatch string
+}
+
+// Server records the requests it gets. Limited tokens, and every token on
+// issue pages after the first once LimitIssuePages is set, are answered with a
+// rate limit until the next hour.
+type Server struct {
+	URL string
+
+	mu              sync.Mutex
+	requests        []Request
+	limited         map[string]bool
+	limitIssuePages bool
+}
+
+// New starts a stand-in closed when the test ends.
+func New(t testing.TB) *Server {
+	s := &Server{limited: map[string]bool{}}
+	server := httptest.NewServer(s)
+
+	t.Cleanup(server.Close)
+
+	s.URL = server.URL
+
+	return s
+}
+
+// Limit answers requests made with the token with a rate limit.
+func (s *Server) Limit(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limited[token] = true
+}
+
+// LimitIssuePages answers requests for issue pages after the first with a
+// rate limit.
+func (s *Server) LimitIssuePages() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limitIssuePages = true
+}
+
+// Requests returns the requests so far, oldest first.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request{}, s.requests...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	firstPage := r.URL.Query().Get("page") == ""
+
+	s.requests = append(s.requests, Request{
+		URI:         r.URL.RequestURI(),
+		Token:       token,
+		IfNoneMatch: r.Header.Get("If-None-Match"),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.limited[token] || (s.limitIssuePages && r.URL.Path == "/repos/octo/hello/issues" && !firstPage) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message":"API rate limit exceeded"}`)
+
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/repos/octo/hello/events":
+		w.Header().Set("X-Poll-Interval", "60")
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `[{"id":"1"}]`)
+	case r.URL.Path == "/repos/octo/hello":
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"name":"Hello","owner":{"login":"Octo"},"html_url":"https://github.com/Octo/Hello"}`)
+	case r.URL.Path == "/repos/octo/hello/issues" && firstPage:
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s/repos/octo/hello/issues?page=2>; rel="next"`, r.Host))
+		fmt.Fprint(w, `[{"id":1,"number":1,"title":"one"},{"id":2,"number":2,"title":"two","pull_request":{"url":"x"}}]`)
+	case r.URL.Path == "/repos/octo/hello/issues":
+		fmt.Fprint(w, `[{"id":3,"number":3,"title":"three"}]`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"Not Found"}`)
+	}
+}
@@ -0,0 +1,153 @@
+package github
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
+
+const tokenCursorKey = "github:token-cursor"
+
+// tokenID names a token in shared state without storing the token itself.
+func tokenID(token string) string {
+	if token == "" {
+		return "anonymous"
+	}
+
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func rateLimitKey(token string) string {
+	return "github:rate-limit:" + tokenID(token)
+}
+
+// token picks the next token that isn't rate limited, round-robin across
+// replicas. When all of them are limited it sleeps until the first resets, or
+// returns a RateLimitedError if that's further away than maxWait.
+func (c *Client) token(ctx context.Context) (string, error) {
+	tokens := c.tokens
+
+	if len(tokens) == 0 {
+		tokens = []string{""}
+	}
+
+	for {
+		start, err := c.store.Incr(ctx, tokenCursorKey)
+
+		if err != nil {
+			slog.Warn("💀 Could not advance github token cursor",
+				slog.String("error", err.Error()))
+		}
+
+		var earliest time.Time
+
+		for i := range tokens {
+			token := tokens[(start+uint64(i))%uint64(len(tokens))]
+			until := c.limitedUntil(ctx, token)
+
+			if !until.After(time.Now()) {
+				return token, nil
+			}
+
+			if earliest.IsZero() || until.Before(earliest) {
+				earliest = until
+			}
+		}
+
+		wait := time.Until(earliest)
+
+		if wait > c.maxWait {
+			return "", &RateLimitedError{Until: earliest}
+		}
+
+		slog.Warn("❌ Every github token is rate limited, waiting",
+			slog.String("until", earliest.Format(time.RFC3339)))
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) limitedUntil(ctx context.Context, token string) time.Time {
+	value, err := c.store.Get(ctx, rateLimitKey(token))
+
+	if err != nil {
+		slog.Warn("💀 Could not read github rate limit state",
+			slog.String("error", err.Error()))
+
+		return time.Time{}
+	}
+
+	until, err := strconv.ParseInt(string(value), 10, 64)
+
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(until, 0)
+}
+
+// limit marks token as unusable until the given time on every replica.
+func (c *Client) limit(ctx context.Context, token string, until time.Time) {
+	ttl := time.Until(until)
+
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	err := c.store.Set(ctx, rateLimitKey(token), []byte(strconv.FormatInt(until.Unix(), 10)), ttl)
+
+	if err != nil {
+		slog.Warn("💀 Could not record github rate limit",
+			slog.String("error", err.Error()))
+	}
+
+	slog.Warn("❌ Github token rate limited",
+		slog.String("token", tokenID(token)),
+		slog.String("until", until.Format(time.RFC3339)))
+}
+
+// rateLimit reads when the token used for resp can next be used, zero if it
+// isn't limited, and whether GitHub turned this request down because of it.
+// Secondary limits without a Retry-After back off exponentially from a minute.
+func rateLimit(resp *req.Response, attempt int) (time.Time, bool) {
+	rejected := false
+
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+		rejected = resp.Header.Get("Retry-After") != "" ||
+			resp.Header.Get("X-RateLimit-Remaining") == "0" ||
+			strings.Contains(strings.ToLower(resp.String()), "rate limit")
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && rejected {
+		return time.Now().Add(time.Duration(seconds) * time.Second), true
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+
+		if err != nil {
+			return time.Now().Add(time.Minute), rejected
+		}
+
+		return time.Unix(reset, 0), rejected
+	}
+
+	if rejected {
+		return time.Now().Add(time.Minute << attempt), true
+	}
+
+	return time.Time{}, false
+}
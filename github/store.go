@@ -0,0 +1,94 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// store holds rate limit state and cached responses. With Redis every worker
+// replica shares them, without it they only live in this process.
+type store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Incr(ctx context.Context, key string) (uint64, error)
+}
+
+type redisStore struct {
+	rdb *redis.Client
+}
+
+func (s redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.rdb.Get(ctx, key).Bytes()
+
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+
+	return value, err
+}
+
+func (s redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+func (s redisStore) Incr(ctx context.Context, key string) (uint64, error) {
+	value, err := s.rdb.Incr(ctx, key).Result()
+
+	return uint64(value), err
+}
+
+type memoryItem struct {
+	value   []byte
+	expires time.Time
+}
+
+type memoryStore struct {
+	mu     sync.Mutex
+	items  map[string]memoryItem
+	counts map[string]uint64
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{items: map[string]memoryItem{}, counts: map[string]uint64{}}
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+
+	if !ok {
+		return nil, nil
+	}
+
+	if time.Now().After(item.expires) {
+		delete(s.items, key)
+
+		return nil, nil
+	}
+
+	return item.value, nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[key] = memoryItem{value: value, expires: time.Now().Add(ttl)}
+
+	return nil
+}
+
+func (s *memoryStore) Incr(ctx context.Context, key string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counts[key]++
+
+	return s.counts[key], nil
+}
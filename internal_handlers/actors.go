@@ -0,0 +1,160 @@
+package internal_handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+)
+
+const (
+	maxActorIssues = 100
+)
+
+func Actor(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	login, err := url.QueryUnescape(c.Params("login"))
+
+	if err != nil || len(login) == 0 || len(login) > 255 {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	login = strings.ToLower(login)
+
+	state := c.Query("state")
+
+	if state != "" && state != "open" && state != "closed" {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "state must be open or closed",
+		})
+	}
+
+	slog.Info("💡 Starting - fetch actor",
+		slog.String("login", login))
+
+	actor := models.Actors{}
+
+	err = db.GetContext(ctx, &actor, "SELECT * FROM actors WHERE lower(login)=$1 ORDER BY updated_at DESC LIMIT 1", login)
+
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("login", login),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	authored := []models.Issues{}
+
+	selectAuthored := `
+	SELECT * FROM issues
+	WHERE author_id=$1 AND deleted_at IS NULL AND ($2 = '' OR closed = ($2 = 'closed'))
+	ORDER BY updated_at DESC NULLS LAST
+	LIMIT $3
+	`
+
+	err = db.SelectContext(ctx, &authored, selectAuthored, actor.ID, state, maxActorIssues)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("login", login),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	assigned := []models.Issues{}
+
+	selectAssigned := `
+	SELECT i.* FROM issues i
+	JOIN issue_assignees ia ON ia.issue_id = i.id
+	WHERE ia.actor_id=$1 AND i.deleted_at IS NULL AND ($2 = '' OR i.closed = ($2 = 'closed'))
+	ORDER BY i.updated_at DESC NULLS LAST
+	LIMIT $3
+	`
+
+	err = db.SelectContext(ctx, &assigned, selectAssigned, actor.ID, state, maxActorIssues)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("login", login),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	authoredJson, err := issuesToJson(authored)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("login", login),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	assignedJson, err := issuesToJson(assigned)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("login", login),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - fetch actor",
+		slog.String("login", login))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{
+			"actor":           actor.ToMap(),
+			"authored_issues": authoredJson,
+			"assigned_issues": assignedJson,
+		})
+}
+
+func issuesToJson(issues []models.Issues) ([]interface{}, error) {
+	issuesJson := []interface{}{}
+
+	for _, issue := range issues {
+		json, err := issue.ToMap()
+
+		if err != nil {
+			return nil, err
+		}
+
+		issuesJson = append(issuesJson, json)
+	}
+
+	return issuesJson, nil
+}
@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+// defaultForgeHosts is the host assumed when ?host= is left out, Gitea has no
+// public default so it always needs one.
+var defaultForgeHosts = map[string]string{
+	forge.ProviderGithub: "github.com",
+	forge.ProviderGitlab: "gitlab.com",
+}
+
+// ForgeParams reads the ?provider= and ?host= query params naming the forge a
+// repository lives on, by default github.com.
+func ForgeParams(c *fiber.Ctx) (string, string, error) {
+	return ParseForge(utils.CopyString(c.Query("provider")), utils.CopyString(c.Query("host")))
+}
+
+// ParseForge checks a provider and host, filling in the defaults when they're
+// left empty.
+func ParseForge(provider string, host string) (string, string, error) {
+	provider = strings.ToLower(provider)
+	host = Truncate(strings.ToLower(host), 255)
+
+	if provider == "" {
+		provider = forge.ProviderGithub
+	}
+
+	if _, ok := forge.Adapters[provider]; !ok {
+		return "", "", errors.New("unknown provider")
+	}
+
+	if host == "" {
+		host = defaultForgeHosts[provider]
+	}
+
+	if host == "" {
+		return "", "", errors.New("host is required for provider " + provider)
+	}
+
+	return provider, host, nil
+}
@@ -0,0 +1,24 @@
+package helpers
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// NextLink is a Link header pointing at this request again with ?cursor= set
+// to the next page.
+func NextLink(c *fiber.Ctx, cursor string) string {
+	next, err := url.Parse(c.OriginalURL())
+
+	if err != nil {
+		return ""
+	}
+
+	query := next.Query()
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+
+	return fmt.Sprintf(`<%s%s>; rel="next"`, c.BaseURL(), next.String())
+}
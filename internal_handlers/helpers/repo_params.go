@@ -0,0 +1,40 @@
+package helpers
+
+import (
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// RepoParams unescapes and lowercases the :owner and :name route params.
+func RepoParams(c *fiber.Ctx) (string, string, error) {
+	escapedOwner := Truncate(strings.ToLower(utils.CopyString(c.Params("owner"))), 255)
+	escapedName := Truncate(strings.ToLower(utils.CopyString(c.Params("name"))), 255)
+
+	owner, err := url.QueryUnescape(escapedOwner)
+
+	if err != nil {
+		slog.Warn("❌ Unable to unescape query parameter",
+			slog.String("escaped_owner", escapedOwner),
+			slog.String("error", err.Error()),
+		)
+
+		return "", "", err
+	}
+
+	name, err := url.QueryUnescape(escapedName)
+
+	if err != nil {
+		slog.Warn("❌ Unable to unescape query parameter",
+			slog.String("escaped_name", escapedName),
+			slog.String("error", err.Error()),
+		)
+
+		return "", "", err
+	}
+
+	return owner, name, nil
+}
@@ -0,0 +1,154 @@
+package internal_handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	helpers "github.com/macwilko/issues-sync/internal_handlers/helpers"
+)
+
+const (
+	defaultCommentsPerPage = 30
+	maxCommentsPerPage     = 100
+)
+
+func IssueComments(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	number, err := c.ParamsInt("number")
+
+	if err != nil || number <= 0 {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+
+	if page < 1 {
+		page = 1
+	}
+
+	perPage := c.QueryInt("per_page", defaultCommentsPerPage)
+
+	if perPage < 1 || perPage > maxCommentsPerPage {
+		perPage = maxCommentsPerPage
+	}
+
+	slog.Info("💡 Starting - fetch issue comments",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Int("number", number))
+
+	var issueGithubID uint64
+
+	err = db.GetContext(ctx, &issueGithubID, "SELECT github_id FROM issues WHERE lower(repo_name)=lower($1) AND lower(repo_owner)=lower($2) AND issue_number=$3 AND provider=$4 AND host=$5 AND deleted_at IS NULL LIMIT 1",
+		name, owner, number, provider, host)
+
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	} else if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	comments := []models.IssueComments{}
+
+	err = db.SelectContext(ctx, &comments, `
+	SELECT * FROM issue_comments
+	WHERE issue_github_id=$1 AND provider=$2 AND host=$3 AND deleted_at IS NULL
+	ORDER BY created_at ASC, id ASC
+	LIMIT $4 OFFSET $5
+	`, issueGithubID, provider, host, perPage, (page-1)*perPage)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	var totalCount int64
+
+	err = db.GetContext(ctx, &totalCount, "SELECT count(*) FROM issue_comments WHERE issue_github_id=$1 AND provider=$2 AND host=$3 AND deleted_at IS NULL", issueGithubID, provider, host)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened, getting comments count",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	commentsJson := []interface{}{}
+
+	for _, comment := range comments {
+		json, err := comment.ToMap()
+
+		if err != nil {
+			slog.Error("💀 An internal error happened",
+				slog.String("owner", owner),
+				slog.String("name", name),
+				slog.String("error", err.Error()),
+			)
+
+			return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+				"message": "an internal error happened",
+			})
+		}
+
+		commentsJson = append(commentsJson, *json)
+	}
+
+	slog.Info("✅ Finished - fetch issue comments",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Int("number", number))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{
+			"comments":    commentsJson,
+			"page":        page,
+			"per_page":    perPage,
+			"total_count": totalCount,
+			"has_more":    int64(page*perPage) < totalCount,
+		})
+}
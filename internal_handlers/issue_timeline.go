@@ -0,0 +1,410 @@
+package internal_handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/macwilko/issues-sync/db/models"
+	helpers "github.com/macwilko/issues-sync/internal_handlers/helpers"
+)
+
+const (
+	defaultTimelinePerPage = 30
+	maxTimelinePerPage     = 100
+	defaultSnapshotPerPage = 100
+	maxSnapshotPerPage     = 500
+)
+
+// selectIssuesAsOf finds the issues that were in a repository at $3, following
+// issues transferred out since then back to where they were.
+const selectIssuesAsOf = `
+WITH moved AS (
+	SELECT DISTINCT ON (issue_id) issue_id, old_value
+	FROM issue_events
+	WHERE field = 'repository' AND occurred_at > $3
+	ORDER BY issue_id, occurred_at ASC, id ASC
+)
+SELECT i.* FROM issues i
+LEFT JOIN moved m ON m.issue_id = i.id
+WHERE lower(COALESCE(m.old_value->>'repo_owner', i.repo_owner)) = lower($1)
+	AND lower(COALESCE(m.old_value->>'repo_name', i.repo_name)) = lower($2)
+	AND i.created_at <= $3
+	AND (i.deleted_at IS NULL OR i.deleted_at > $3)
+	AND ($4 = 0 OR COALESCE((m.old_value->>'issue_number')::bigint, i.issue_number) = $4)
+	AND i.provider = $5 AND i.host = $6
+ORDER BY i.id ASC
+LIMIT $7 OFFSET $8
+`
+
+func IssueTimeline(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	number, err := c.ParamsInt("number")
+
+	if err != nil || number <= 0 {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+
+	if page < 1 {
+		page = 1
+	}
+
+	perPage := c.QueryInt("per_page", defaultTimelinePerPage)
+
+	if perPage < 1 || perPage > maxTimelinePerPage {
+		perPage = maxTimelinePerPage
+	}
+
+	slog.Info("💡 Starting - fetch issue timeline",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Int("number", number))
+
+	var issueID uint64
+
+	err = db.GetContext(ctx, &issueID, "SELECT id FROM issues WHERE lower(repo_name)=lower($1) AND lower(repo_owner)=lower($2) AND issue_number=$3 AND provider=$4 AND host=$5 AND deleted_at IS NULL LIMIT 1",
+		name, owner, number, provider, host)
+
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	} else if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	events := []models.IssueEvents{}
+
+	err = db.SelectContext(ctx, &events, `
+	SELECT * FROM issue_events
+	WHERE issue_id=$1
+	ORDER BY occurred_at ASC, id ASC
+	LIMIT $2 OFFSET $3
+	`, issueID, perPage, (page-1)*perPage)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	var totalCount int64
+
+	err = db.GetContext(ctx, &totalCount, "SELECT count(*) FROM issue_events WHERE issue_id=$1", issueID)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened, getting timeline count",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	eventsJson := []interface{}{}
+
+	for _, event := range events {
+		json, err := event.ToMap()
+
+		if err != nil {
+			slog.Error("💀 An internal error happened",
+				slog.String("owner", owner),
+				slog.String("name", name),
+				slog.String("error", err.Error()),
+			)
+
+			return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+				"message": "an internal error happened",
+			})
+		}
+
+		eventsJson = append(eventsJson, *json)
+	}
+
+	slog.Info("✅ Finished - fetch issue timeline",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Int("number", number))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{
+			"events":      eventsJson,
+			"page":        page,
+			"per_page":    perPage,
+			"total_count": totalCount,
+			"has_more":    int64(page*perPage) < totalCount,
+		})
+}
+
+// IssueSnapshot returns an issue as it was at the ?at= timestamp.
+func IssueSnapshot(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	number, err := c.ParamsInt("number")
+
+	if err != nil || number <= 0 {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	at, err := time.Parse(time.RFC3339, c.Query("at"))
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "at must be an RFC3339 timestamp",
+		})
+	}
+
+	slog.Info("💡 Starting - fetch issue snapshot",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Int("number", number),
+		slog.String("at", at.Format(time.RFC3339)))
+
+	issues, err := issuesAsOf(ctx, db, provider, host, owner, name, number, at, 1, 0)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	if len(issues) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	json, err := issues[0].ToMap()
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - fetch issue snapshot",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Int("number", number))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{
+			"at":    at.Format(time.RFC3339),
+			"issue": json,
+		})
+}
+
+// RepoSnapshot returns a page of a repository's issues as they were at the
+// ?at= timestamp.
+func RepoSnapshot(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	at, err := time.Parse(time.RFC3339, c.Query("at"))
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "at must be an RFC3339 timestamp",
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+
+	if page < 1 {
+		page = 1
+	}
+
+	perPage := c.QueryInt("per_page", defaultSnapshotPerPage)
+
+	if perPage < 1 || perPage > maxSnapshotPerPage {
+		perPage = maxSnapshotPerPage
+	}
+
+	slog.Info("💡 Starting - fetch repo snapshot",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.String("at", at.Format(time.RFC3339)))
+
+	// One extra row tells us whether there's another page
+	issues, err := issuesAsOf(ctx, db, provider, host, owner, name, 0, at, perPage+1, (page-1)*perPage)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	hasMore := len(issues) > perPage
+
+	if hasMore {
+		issues = issues[:perPage]
+	}
+
+	issuesJson, err := issuesToJson(issues)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - fetch repo snapshot",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{
+			"at":       at.Format(time.RFC3339),
+			"issues":   issuesJson,
+			"page":     page,
+			"per_page": perPage,
+			"has_more": hasMore,
+		})
+}
+
+// issuesAsOf loads the issues that existed in the repository at the given
+// time and rolls each one back through the events recorded after it.
+func issuesAsOf(ctx context.Context, db *sqlx.DB, provider string, host string, owner string, name string, number int, at time.Time, limit int, offset int) ([]models.Issues, error) {
+	issues := []models.Issues{}
+
+	err := db.SelectContext(ctx, &issues, selectIssuesAsOf, owner, name, at, number, provider, host, limit, offset)
+
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if len(issues) == 0 {
+		return issues, nil
+	}
+
+	issueIDs := []int64{}
+
+	for _, issue := range issues {
+		issueIDs = append(issueIDs, int64(issue.ID))
+	}
+
+	events := []models.IssueEvents{}
+
+	err = db.SelectContext(ctx, &events, `
+	SELECT * FROM issue_events
+	WHERE issue_id = ANY($1) AND occurred_at > $2
+	ORDER BY occurred_at DESC, id DESC
+	`, pq.Array(issueIDs), at)
+
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	byID := map[uint64]*models.Issues{}
+
+	for i := range issues {
+		byID[issues[i].ID] = &issues[i]
+	}
+
+	for _, event := range events {
+		if err := byID[event.IssueID].Revert(event); err != nil {
+			return nil, err
+		}
+	}
+
+	return issues, nil
+}
@@ -3,8 +3,7 @@ package internal_handlers
 import (
 	"context"
 	"database/sql"
-	"net/url"
-	"strings"
+	"strconv"
 
 	"log/slog"
 
@@ -12,77 +11,129 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/macwilko/issues-sync/db/models"
 	helpers "github.com/macwilko/issues-sync/internal_handlers/helpers"
-	"github.com/meilisearch/meilisearch-go"
+	"github.com/macwilko/issues-sync/search"
 )
 
-func Issues(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, meili *meilisearch.Client) error {
+const (
+	defaultIssuesPerPage = 25
+	maxIssuesPerPage     = 100
+)
 
-	q := helpers.Truncate(c.Query("q"), 100)
-	escapedOwner := helpers.Truncate(strings.ToLower(c.Params("owner")), 255)
-	escapedName := helpers.Truncate(strings.ToLower(c.Params("name")), 255)
+// Issues lists or searches a repository's issues a page at a time. Follow
+// next_cursor (or the Link header) for the next page.
+func Issues(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, backend search.Backend) error {
 
-	owner, err := url.QueryUnescape(escapedOwner)
+	owner, name, err := helpers.RepoParams(c)
 
 	if err != nil {
-		slog.Warn("❌ Unable to unescape query parameter",
-			slog.String("escaped_owner", escapedOwner),
-			slog.String("error", err.Error()),
-		)
-
 		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
 			"message": "not found",
 		})
 	}
 
-	name, err := url.QueryUnescape(escapedName)
+	provider, host, err := helpers.ForgeParams(c)
 
 	if err != nil {
-		slog.Warn("❌ Unable to unescape query parameter",
-			slog.String("escaped_name", escapedName),
-			slog.String("error", err.Error()),
-		)
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
 
-		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
-			"message": "not found",
+	query, err := search.Parse(helpers.Truncate(c.Query("q"), 256))
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "invalid query: " + err.Error(),
 		})
 	}
 
-	state := c.Query("state")
+	// Qualifiers win over ?sort=, ?direction= and ?state=
+	if query.Sort == nil && (c.Query("sort") != "" || c.Query("direction") != "") {
+		query.Sort, err = search.NewSort(c.Query("sort", search.SortCreated), c.Query("direction"))
+
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+				"message": err.Error(),
+			})
+		}
+	}
+
+	state := query.State
+
+	if state == "" {
+		state = c.Query("state")
+	}
+
+	perPage := c.QueryInt("per_page", defaultIssuesPerPage)
+
+	if perPage < 1 {
+		perPage = 1
+	} else if perPage > maxIssuesPerPage {
+		perPage = maxIssuesPerPage
+	}
+
+	facets, err := search.ParseFacets(c.Query("facets"))
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	var cursor *search.Cursor
+
+	if c.Query("cursor") != "" {
+		decoded, err := search.DecodeCursor(c.Query("cursor"))
+
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+				"message": err.Error(),
+			})
+		}
+
+		cursor = &decoded
+	}
 
 	slog.Info("💡 Starting - fetch issues",
 		slog.String("owner", owner),
 		slog.String("name", name))
 
 	issues := []models.Issues{}
-	var issuesJson []interface{}
+	issuesJson := []interface{}{}
 	var closedCount int64
 	var openCount int64
+	var nextCursor *search.Cursor
+	var facetCounts map[string]map[string]int64
+	var degraded bool
 
-	if len(q) > 0 {
+	if len(query.Text) > 0 {
 
-		meiliFilter := ""
-		meiliIndex := "issues-" + owner + "-" + name
-		openFilter := "closed = false AND "
-		closedFilter := "closed = true AND "
-		repoFilter := "repo_owner = '" + owner + "' AND repo_name = '" + name + "'"
+		var offset int64
 
-		switch state {
-		case "open":
-			meiliFilter = openFilter + repoFilter
-		case "closed":
-			meiliFilter = closedFilter + repoFilter
+		if cursor != nil {
+			offset = cursor.Offset
 		}
 
-		searchResponse, err := meili.Index(meiliIndex).Search(q, &meilisearch.SearchRequest{
-			Limit:                 25,
-			AttributesToHighlight: []string{"*"},
-			Filter:                meiliFilter,
+		// One extra hit tells us whether there's another page
+		result, err := backend.Search(ctx, search.Request{
+			Repo: search.Repo{
+				Provider: provider,
+				Host:     host,
+				Owner:    owner,
+				Name:     name,
+			},
+			Query:  query,
+			State:  state,
+			Offset: offset,
+			Limit:  int64(perPage) + 1,
+			Facets: facets,
 		})
 
 		if err != nil {
 			slog.Error("💀 An internal error happened",
 				slog.String("owner", owner),
 				slog.String("name", name),
+				slog.String("backend", backend.Name()),
 				slog.String("error", err.Error()),
 			)
 
@@ -91,37 +142,40 @@ func Issues(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, meili *meilisearch.C
 			})
 		}
 
-		slog.Info("💡 Search results info",
-			slog.String("query", q),
-			slog.String("filter", meiliFilter),
-			slog.Int64("estimated_hits", searchResponse.EstimatedTotalHits),
-			slog.Int64("hits", searchResponse.TotalHits))
+		openCount = result.OpenCount
+		closedCount = result.ClosedCount
+		facetCounts = result.Facets
+		degraded = result.Degraded
+		issuesJson = result.Hits
 
-		openSearchResponse, err := meili.Index(meiliIndex).Search(q, &meilisearch.SearchRequest{
-			Limit:  25,
-			Filter: openFilter + repoFilter,
-		})
+		if len(issuesJson) > perPage {
+			issuesJson = issuesJson[:perPage]
+			nextCursor = &search.Cursor{Offset: offset + int64(perPage)}
+		}
+	} else {
+		conditions, args := query.SQL(6)
+		listArgs := append([]interface{}{name, owner, state == "closed", provider, host}, args...)
+		after := ""
 
-		if err != nil {
-			slog.Error("💀 An internal error happened",
-				slog.String("owner", owner),
-				slog.String("name", name),
-				slog.String("error", err.Error()),
-			)
+		if cursor != nil {
+			var afterArgs []interface{}
 
-			return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
-				"message": "an internal error happened",
-			})
-		}
+			after, afterArgs, err = query.After(*cursor, len(listArgs)+1)
 
-		openCount = openSearchResponse.EstimatedTotalHits
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+					"message": err.Error(),
+				})
+			}
 
-		closedSearchResponse, err := meili.Index(meiliIndex).Search(q, &meilisearch.SearchRequest{
-			Limit:  25,
-			Filter: closedFilter + repoFilter,
-		})
+			listArgs = append(listArgs, afterArgs...)
+		}
 
-		if err != nil {
+		// One extra row tells us whether there's another page
+		err = db.Select(&issues, "SELECT * FROM issues WHERE lower(repo_name)=lower($1) AND lower(repo_owner)=lower($2) AND closed=$3 AND provider=$4 AND host=$5 AND deleted_at IS NULL"+conditions+after+" ORDER BY "+query.OrderBy()+" LIMIT "+strconv.Itoa(perPage+1),
+			listArgs...)
+
+		if err != nil && err != sql.ErrNoRows {
 			slog.Error("💀 An internal error happened",
 				slog.String("owner", owner),
 				slog.String("name", name),
@@ -133,23 +187,18 @@ func Issues(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, meili *meilisearch.C
 			})
 		}
 
-		closedCount = closedSearchResponse.EstimatedTotalHits
-
-		issuesJson = searchResponse.Hits
+		if len(issues) > perPage {
+			issues = issues[:perPage]
+			last := issues[perPage-1]
 
-	} else {
-		err = db.Select(&issues, "SELECT * FROM issues WHERE repo_name=$1 AND repo_owner=$2 AND closed=$3 ORDER BY created_at DESC LIMIT 25", name, owner, state == "closed")
+			updatedAt := last.CreatedAt
 
-		if err != nil && err != sql.ErrNoRows {
-			slog.Error("💀 An internal error happened",
-				slog.String("owner", owner),
-				slog.String("name", name),
-				slog.String("error", err.Error()),
-			)
+			if last.UpdatedAt.Valid {
+				updatedAt = last.UpdatedAt.Time
+			}
 
-			return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
-				"message": "an internal error happened",
-			})
+			next := query.CursorAfter(last.ID, last.CreatedAt, updatedAt, last.CommentsCount, last.ReactionsCount())
+			nextCursor = &next
 		}
 
 		for _, issue := range issues {
@@ -170,10 +219,21 @@ func Issues(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, meili *meilisearch.C
 			issuesJson = append(issuesJson, *json)
 		}
 
-		err = db.Get(&closedCount, "SELECT count(*) FROM issues WHERE repo_name=$1 AND repo_owner=$2 AND closed=$3", name, owner, 1)
+		stateConditions, stateArgs := query.SQL(5)
+
+		counts := struct {
+			Open   int64 `db:"open_count"`
+			Closed int64 `db:"closed_count"`
+		}{}
+
+		err = db.Get(&counts, `
+		SELECT count(*) FILTER (WHERE NOT closed) AS open_count, count(*) FILTER (WHERE closed) AS closed_count
+		FROM issues
+		WHERE lower(repo_name)=lower($1) AND lower(repo_owner)=lower($2) AND provider=$3 AND host=$4 AND deleted_at IS NULL`+stateConditions,
+			append([]interface{}{name, owner, provider, host}, stateArgs...)...)
 
 		if err != nil {
-			slog.Error("💀 An internal error happened, getting closed count",
+			slog.Error("💀 An internal error happened, getting open and closed counts",
 				slog.String("owner", owner),
 				slog.String("name", name),
 				slog.String("error", err.Error()),
@@ -184,18 +244,25 @@ func Issues(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, meili *meilisearch.C
 			})
 		}
 
-		err = db.Get(&openCount, "SELECT count(*) FROM issues WHERE repo_name=$1 AND repo_owner=$2 AND closed=$3", name, owner, 0)
+		openCount = counts.Open
+		closedCount = counts.Closed
 
-		if err != nil {
-			slog.Error("💀 An internal error happened, getting open count",
-				slog.String("owner", owner),
-				slog.String("name", name),
-				slog.String("error", err.Error()),
-			)
+		if len(facets) > 0 {
+			facetCounts, err = search.CountFacets(ctx, db, facets,
+				"lower(i.repo_name)=lower($1) AND lower(i.repo_owner)=lower($2) AND i.closed=$3 AND i.provider=$4 AND i.host=$5 AND i.deleted_at IS NULL"+conditions,
+				append([]interface{}{name, owner, state == "closed", provider, host}, args...))
 
-			return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
-				"message": "an internal error happened",
-			})
+			if err != nil {
+				slog.Error("💀 An internal error happened, getting facets",
+					slog.String("owner", owner),
+					slog.String("name", name),
+					slog.String("error", err.Error()),
+				)
+
+				return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+					"message": "an internal error happened",
+				})
+			}
 		}
 	}
 
@@ -203,6 +270,21 @@ func Issues(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, meili *meilisearch.C
 		"closed_count": closedCount,
 		"open_count":   openCount,
 		"issues":       issuesJson,
+		"per_page":     perPage,
+		"has_more":     nextCursor != nil,
+		"next_cursor":  nil,
+		"degraded":     degraded,
+	}
+
+	if facetCounts != nil {
+		responseJson["facets"] = facetCounts
+	}
+
+	if nextCursor != nil {
+		encoded := nextCursor.Encode()
+
+		responseJson["next_cursor"] = encoded
+		c.Set(fiber.HeaderLink, helpers.NextLink(c, encoded))
 	}
 
 	slog.Info("✅ Finished - fetch issues",
@@ -0,0 +1,390 @@
+package internal_handlers
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/macwilko/issues-sync/db/models"
+	helpers "github.com/macwilko/issues-sync/internal_handlers/helpers"
+)
+
+const (
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatCSV    = "csv"
+	ExportFormatJSON   = "json"
+
+	// Rows fetched from the cursor at a time, and flushed to the client
+	exportBatchSize = 500
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatNDJSON: "application/x-ndjson",
+	ExportFormatCSV:    "text/csv; charset=utf-8",
+	ExportFormatJSON:   fiber.MIMEApplicationJSONCharsetUTF8,
+}
+
+var exportCSVHeader = []string{
+	"id", "issue_number", "title", "state", "state_reason", "author", "labels", "assignees", "milestone",
+	"comments_count", "locked", "created_at", "updated_at", "closed_at", "html_url", "body",
+}
+
+// exportFilter narrows an export down, every field is optional.
+type exportFilter struct {
+	state  string
+	labels []string
+	since  sql.NullTime
+	until  sql.NullTime
+}
+
+// ExportIssues streams every issue of a repository as NDJSON, CSV or a JSON
+// array. Rows are read through a server side cursor a batch at a time, so
+// memory stays flat however big the repository is.
+//
+// ?state=open|closed|all, ?label=a,b (issues with all of them), ?since= and
+// ?until= (created_at, RFC3339 or YYYY-MM-DD) narrow it down.
+func ExportIssues(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	format := strings.ToLower(utils.CopyString(c.Query("format", ExportFormatNDJSON)))
+	contentType, ok := exportContentTypes[format]
+
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "format must be ndjson, csv or json",
+		})
+	}
+
+	filter, err := exportFilterParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	slog.Info("💡 Starting - export issues",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.String("format", format))
+
+	query, args := exportIssuesQuery(provider, host, owner, name, filter)
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-%s-issues.%s"`, owner, name, format))
+
+	// The fiber.Ctx is recycled once the handler returns, the writer only
+	// uses what was read from it above.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		exported, err := streamIssues(ctx, db, query, args, format, w)
+
+		if err != nil {
+			// The status is already sent, all we can do is stop
+			slog.Error("💀 Export stopped early",
+				slog.String("owner", owner),
+				slog.String("name", name),
+				slog.Int("exported", exported),
+				slog.String("error", err.Error()))
+
+			return
+		}
+
+		slog.Info("✅ Finished - export issues",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.Int("exported", exported))
+	})
+
+	return nil
+}
+
+func exportFilterParams(c *fiber.Ctx) (exportFilter, error) {
+	filter := exportFilter{
+		state: strings.ToLower(c.Query("state", "all")),
+	}
+
+	if filter.state != "open" && filter.state != "closed" && filter.state != "all" {
+		return filter, fmt.Errorf("state must be open, closed or all")
+	}
+
+	for _, label := range strings.Split(c.Query("label"), ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			filter.labels = append(filter.labels, strings.ToLower(utils.CopyString(label)))
+		}
+	}
+
+	var err error
+
+	if filter.since, err = exportDateParam(c, "since"); err != nil {
+		return filter, err
+	}
+
+	if filter.until, err = exportDateParam(c, "until"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func exportDateParam(c *fiber.Ctx, key string) (sql.NullTime, error) {
+	value := c.Query(key)
+
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return sql.NullTime{Time: t, Valid: true}, nil
+		}
+	}
+
+	return sql.NullTime{}, fmt.Errorf("%s must be an RFC3339 timestamp or a YYYY-MM-DD date", key)
+}
+
+// exportIssuesQuery filters on the labels JSON rather than issue_labels, so
+// labels without an id (imported ones) can be filtered on too.
+func exportIssuesQuery(provider string, host string, owner string, name string, filter exportFilter) (string, []interface{}) {
+	query := `
+	SELECT * FROM issues
+	WHERE provider=$1 AND host=$2 AND lower(repo_owner)=lower($3) AND lower(repo_name)=lower($4) AND deleted_at IS NULL
+		AND ($5 = 'all' OR closed = ($5 = 'closed'))
+		AND ($6::timestamptz IS NULL OR created_at >= $6)
+		AND ($7::timestamptz IS NULL OR created_at < $7)
+		AND (SELECT count(DISTINCT lower(l->>'name')) FROM jsonb_array_elements(labels) l WHERE lower(l->>'name') = ANY($8)) = cardinality($8::text[])
+	ORDER BY id ASC
+	`
+
+	labels := filter.labels
+
+	if labels == nil {
+		labels = []string{}
+	}
+
+	return query, []interface{}{provider, host, owner, name, filter.state, filter.since, filter.until, pq.Array(labels)}
+}
+
+// streamIssues runs the query through a cursor in a read only transaction and
+// writes each batch out as it arrives.
+func streamIssues(ctx context.Context, db *sqlx.DB, query string, args []interface{}, format string, w *bufio.Writer) (int, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DECLARE export_issues NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return 0, err
+	}
+
+	csvWriter := csv.NewWriter(w)
+	exported := 0
+
+	switch format {
+	case ExportFormatCSV:
+		err = csvWriter.Write(exportCSVHeader)
+	case ExportFormatJSON:
+		_, err = w.WriteString("[")
+	}
+
+	if err != nil {
+		return exported, err
+	}
+
+	for {
+		issues := []models.Issues{}
+
+		err := tx.SelectContext(ctx, &issues, "FETCH FORWARD "+strconv.Itoa(exportBatchSize)+" FROM export_issues")
+
+		if err != nil {
+			return exported, err
+		}
+
+		for _, issue := range issues {
+			if format == ExportFormatCSV {
+				err = csvWriter.Write(issueCSVRecord(issue))
+			} else {
+				err = writeIssueJSON(w, issue, format, exported)
+			}
+
+			if err != nil {
+				return exported, err
+			}
+
+			exported++
+		}
+
+		csvWriter.Flush()
+
+		if err := csvWriter.Error(); err != nil {
+			return exported, err
+		}
+
+		// A failed flush means the client went away
+		if err := w.Flush(); err != nil {
+			return exported, err
+		}
+
+		if len(issues) < exportBatchSize {
+			break
+		}
+	}
+
+	if format == ExportFormatJSON {
+		if _, err := w.WriteString("]\n"); err != nil {
+			return exported, err
+		}
+	}
+
+	return exported, w.Flush()
+}
+
+func writeIssueJSON(w *bufio.Writer, issue models.Issues, format string, position int) error {
+	issueJson, err := issue.ToMap()
+
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(issueJson)
+
+	if err != nil {
+		return err
+	}
+
+	if format == ExportFormatJSON && position > 0 {
+		w.WriteString(",")
+	}
+
+	w.Write(line)
+
+	if format == ExportFormatNDJSON {
+		w.WriteString("\n")
+	}
+
+	return nil
+}
+
+// issueCSVRecord flattens an issue into a row, labels and assignees become
+// ";" separated lists.
+func issueCSVRecord(issue models.Issues) []string {
+	state := "open"
+
+	if issue.Closed {
+		state = "closed"
+	}
+
+	var author struct {
+		Login string `json:"login"`
+	}
+
+	var labels []struct {
+		Name string `json:"name"`
+	}
+
+	var assignees []struct {
+		Login string `json:"login"`
+	}
+
+	var milestone struct {
+		Title string `json:"title"`
+	}
+
+	// Bad JSON in one column leaves that column empty rather than the row
+	issue.Author.Unmarshal(&author)
+	issue.Labels.Unmarshal(&labels)
+	issue.Assignees.Unmarshal(&assignees)
+
+	if issue.Milestone.Valid {
+		issue.Milestone.Unmarshal(&milestone)
+	}
+
+	labelNames := []string{}
+
+	for _, label := range labels {
+		labelNames = append(labelNames, label.Name)
+	}
+
+	assigneeLogins := []string{}
+
+	for _, assignee := range assignees {
+		assigneeLogins = append(assigneeLogins, assignee.Login)
+	}
+
+	updatedAt := issue.CreatedAt
+
+	if issue.UpdatedAt.Valid {
+		updatedAt = issue.UpdatedAt.Time
+	}
+
+	closedAt := ""
+
+	if issue.ClosedAt.Valid {
+		closedAt = issue.ClosedAt.Time.Format(time.RFC3339)
+	}
+
+	record := []string{
+		strconv.FormatUint(issue.ID, 10),
+		strconv.FormatUint(issue.IssueNumber, 10),
+		issue.Title,
+		state,
+		issue.StateReason.String,
+		author.Login,
+		strings.Join(labelNames, ";"),
+		strings.Join(assigneeLogins, ";"),
+		milestone.Title,
+		strconv.FormatUint(issue.CommentsCount, 10),
+		strconv.FormatBool(issue.Locked),
+		issue.CreatedAt.Format(time.RFC3339),
+		updatedAt.Format(time.RFC3339),
+		closedAt,
+		issue.HTMLURL.String,
+		issue.Body.String,
+	}
+
+	for i, cell := range record {
+		record[i] = escapeCSVFormula(cell)
+	}
+
+	return record
+}
+
+// escapeCSVFormula stops spreadsheets from running a cell as a formula, e.g. a
+// title of =HYPERLINK(...), by prefixing it with a quote.
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+
+	return cell
+}
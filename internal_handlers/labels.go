@@ -0,0 +1,92 @@
+package internal_handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"maps"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	helpers "github.com/macwilko/issues-sync/internal_handlers/helpers"
+)
+
+type labelWithCounts struct {
+	models.Labels
+	OpenCount   int64 `db:"open_count"`
+	ClosedCount int64 `db:"closed_count"`
+}
+
+func Labels(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	slog.Info("💡 Starting - fetch labels",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	labels := []labelWithCounts{}
+
+	selectLabels := `
+	SELECT
+		lb.*,
+		count(i.id) FILTER (WHERE i.closed = false) AS open_count,
+		count(i.id) FILTER (WHERE i.closed = true) AS closed_count
+	FROM labels lb
+	LEFT JOIN issue_labels il ON il.label_id = lb.id
+	LEFT JOIN issues i ON i.id = il.issue_id AND i.deleted_at IS NULL
+	WHERE lb.repo_owner=$1 AND lb.repo_name=$2 AND lb.provider=$3 AND lb.host=$4
+	GROUP BY lb.id
+	ORDER BY lb.name ASC
+	`
+
+	err = db.SelectContext(ctx, &labels, selectLabels, owner, name, provider, host)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	labelsJson := []interface{}{}
+
+	for _, label := range labels {
+		json := label.ToMap()
+
+		maps.Copy(*json, fiber.Map{
+			"open_count":   label.OpenCount,
+			"closed_count": label.ClosedCount,
+		})
+
+		labelsJson = append(labelsJson, *json)
+	}
+
+	slog.Info("✅ Finished - fetch labels",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"labels": labelsJson})
+}
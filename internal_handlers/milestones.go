@@ -0,0 +1,226 @@
+package internal_handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	helpers "github.com/macwilko/issues-sync/internal_handlers/helpers"
+)
+
+const (
+	defaultMilestoneIssuesPerPage = 30
+	maxMilestoneIssuesPerPage     = 100
+)
+
+func Milestones(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	state := c.Query("state", "all")
+
+	if state != "open" && state != "closed" && state != "all" {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "state must be open, closed or all",
+		})
+	}
+
+	slog.Info("💡 Starting - fetch milestones",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	milestones := []models.Milestones{}
+
+	selectMilestones := `
+	SELECT * FROM milestones
+	WHERE repo_owner=$1 AND repo_name=$2 AND provider=$3 AND host=$4 AND ($5 = 'all' OR state = $5)
+	ORDER BY due_on ASC NULLS LAST, number ASC
+	`
+
+	err = db.SelectContext(ctx, &milestones, selectMilestones, owner, name, provider, host, state)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	milestonesJson := []interface{}{}
+
+	for _, milestone := range milestones {
+		milestonesJson = append(milestonesJson, *milestone.ToMap())
+	}
+
+	slog.Info("✅ Finished - fetch milestones",
+		slog.String("owner", owner),
+		slog.String("name", name))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"milestones": milestonesJson})
+}
+
+func MilestoneIssues(c *fiber.Ctx, ctx context.Context, db *sqlx.DB) error {
+
+	owner, name, err := helpers.RepoParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	provider, host, err := helpers.ForgeParams(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	number, err := c.ParamsInt("number")
+
+	if err != nil || number <= 0 {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	}
+
+	state := c.Query("state", "all")
+
+	if state != "open" && state != "closed" && state != "all" {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"message": "state must be open, closed or all",
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+
+	if page < 1 {
+		page = 1
+	}
+
+	perPage := c.QueryInt("per_page", defaultMilestoneIssuesPerPage)
+
+	if perPage < 1 || perPage > maxMilestoneIssuesPerPage {
+		perPage = maxMilestoneIssuesPerPage
+	}
+
+	slog.Info("💡 Starting - fetch milestone issues",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Int("number", number))
+
+	milestone := models.Milestones{}
+
+	err = db.GetContext(ctx, &milestone, "SELECT * FROM milestones WHERE repo_owner=$1 AND repo_name=$2 AND number=$3 AND provider=$4 AND host=$5 LIMIT 1",
+		owner, name, number, provider, host)
+
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(&fiber.Map{
+			"message": "not found",
+		})
+	} else if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	issues := []models.Issues{}
+
+	selectIssues := `
+	SELECT * FROM issues
+	WHERE milestone_id=$1 AND deleted_at IS NULL AND ($2 = 'all' OR closed = ($2 = 'closed'))
+	ORDER BY issue_number DESC
+	LIMIT $3 OFFSET $4
+	`
+
+	err = db.SelectContext(ctx, &issues, selectIssues, milestone.ID, state, perPage, (page-1)*perPage)
+
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	var totalCount int64
+
+	err = db.GetContext(ctx, &totalCount, "SELECT count(*) FROM issues WHERE milestone_id=$1 AND deleted_at IS NULL AND ($2 = 'all' OR closed = ($2 = 'closed'))", milestone.ID, state)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened, getting milestone issues count",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	issuesJson, err := issuesToJson(issues)
+
+	if err != nil {
+		slog.Error("💀 An internal error happened",
+			slog.String("owner", owner),
+			slog.String("name", name),
+			slog.String("error", err.Error()),
+		)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"message": "an internal error happened",
+		})
+	}
+
+	slog.Info("✅ Finished - fetch milestone issues",
+		slog.String("owner", owner),
+		slog.String("name", name),
+		slog.Int("number", number))
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{
+			"milestone":   milestone.ToMap(),
+			"issues":      issuesJson,
+			"page":        page,
+			"per_page":    perPage,
+			"total_count": totalCount,
+			"has_more":    int64(page*perPage) < totalCount,
+		})
+}
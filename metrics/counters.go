@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	countersKey = "metrics:counters"
+)
+
+const (
+	WebhookInvalidSignature   = "webhooks.invalid_signature"
+	WebhookUnhandledEvent     = "webhooks.unhandled_event"
+	IssueStaleUpdateSkipped   = "issues.stale_update_skipped"
+	CommentStaleUpdateSkipped = "comments.stale_update_skipped"
+)
+
+// Incr bumps a named counter shared by every api and worker replica.
+// Counting is best effort, a redis failure is logged and never returned.
+func Incr(ctx context.Context, rdb *redis.Client, name string) {
+	if err := rdb.HIncrBy(ctx, countersKey, name, 1).Err(); err != nil {
+		slog.Warn("💀 Could not increment counter",
+			slog.String("counter", name),
+			slog.String("error", err.Error()))
+	}
+}
+
+func Counters(ctx context.Context, rdb *redis.Client) (map[string]int64, error) {
+	values, err := rdb.HGetAll(ctx, countersKey).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[string]int64, len(values))
+
+	for name, value := range values {
+		count, err := strconv.ParseInt(value, 10, 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		counters[name] = count
+	}
+
+	return counters, nil
+}
@@ -0,0 +1,95 @@
+package search
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+const (
+	BackendMeilisearch = "meilisearch"
+	BackendPostgres    = "postgres"
+)
+
+// Document is an issue as sent to a backend, see tasks.issueSearchDocuments.
+// It needs at least the issue's id and the text of its comments.
+type Document = map[string]interface{}
+
+// Repo names the repository a search or a document belongs to.
+type Repo struct {
+	Provider string
+	Host     string
+	Owner    string
+	Name     string
+}
+
+// Request is a free text search of a repository's issues. State is open,
+// closed or empty for both, the counts in the result ignore it.
+type Request struct {
+	Repo   Repo
+	Query  Query
+	State  string
+	Offset int64
+	Limit  int64
+	Facets []string
+}
+
+type Result struct {
+	Hits        []interface{}
+	OpenCount   int64
+	ClosedCount int64
+	// Only set when facets were asked for
+	Facets map[string]map[string]int64
+	// Degraded is set when the primary backend couldn't answer and the
+	// result came from the fallback
+	Degraded bool
+}
+
+// RequestError is a backend refusing a request, such as a bad filter. The
+// backend is up, so it doesn't count towards failing over.
+type RequestError struct {
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Backend searches issues and keeps its copy of them up to date.
+type Backend interface {
+	Name() string
+	Search(ctx context.Context, request Request) (*Result, error)
+	// Index adds or replaces documents
+	Index(ctx context.Context, repo Repo, documents []Document) error
+	Delete(ctx context.Context, repo Repo, issueID uint64) error
+	// Rebuild replaces everything held for the repository with the batches
+	// next returns, until it returns an empty one. Searches keep working
+	// while it runs.
+	Rebuild(ctx context.Context, repo Repo, next func() ([]Document, error)) (int, error)
+	// ApplySettings brings the repository's index in line with its stored
+	// settings, see LoadIndexSettings
+	ApplySettings(ctx context.Context, repo Repo, settings IndexSettings) error
+}
+
+// NewBackend picks the backend from SEARCH_BACKEND. By default that's
+// meilisearch with Postgres as the fallback, or Postgres alone when there's no
+// meilisearch client or SEARCH_BACKEND=postgres.
+func NewBackend(db *sqlx.DB, meili *meilisearch.Client) Backend {
+	postgres := NewPostgres(db)
+
+	if meili == nil || strings.ToLower(os.Getenv("SEARCH_BACKEND")) == BackendPostgres {
+		slog.Info("💡 Searching with Postgres only")
+
+		return postgres
+	}
+
+	return NewFailover(NewMeili(meili, db), postgres, NewBreaker(defaultBreakerFailures, defaultBreakerCooldown), db)
+}
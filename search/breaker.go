@@ -0,0 +1,91 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailures = 3
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// Breaker is a circuit breaker. After enough failures in a row it opens and
+// callers skip what's failing, once the cooldown has passed one call is let
+// through to check whether it's back.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow reports whether to make the call.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+
+	b.probing = true
+
+	return true
+}
+
+// Record counts the outcome of an allowed call. A caller giving up, such as a
+// cancelled request, or a refused request says nothing about what it called.
+func (b *Breaker) Record(err error) {
+	var requestErr *RequestError
+
+	if errors.Is(err, context.Canceled) || errors.As(err, &requestErr) {
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if err == nil {
+		if b.failures >= b.threshold {
+			slog.Info("✅ Circuit closed, primary search backend is back")
+		}
+
+		b.failures = 0
+
+		return
+	}
+
+	b.failures++
+
+	if b.failures >= b.threshold {
+		if b.failures == b.threshold {
+			slog.Warn("💀 Circuit open, failing over to the fallback search backend",
+				slog.String("error", err.Error()))
+		}
+
+		b.openedAt = time.Now()
+	}
+}
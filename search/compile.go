@@ -0,0 +1,141 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Search document attributes, see tasks.issueSearchDocuments.
+const (
+	AttributeCreatedAt = "created_at_unix"
+	AttributeUpdatedAt = "updated_at_unix"
+	AttributeComments  = "comments_count"
+	AttributeReactions = "reactions_count"
+)
+
+var meiliAttributes = map[string]string{
+	qualifierLabel:     "labels.name",
+	qualifierAuthor:    "author.login",
+	qualifierAssignee:  "assignees.login",
+	qualifierMilestone: "milestone.title",
+	qualifierCreated:   AttributeCreatedAt,
+	qualifierUpdated:   AttributeUpdatedAt,
+	qualifierComments:  AttributeComments,
+}
+
+var meiliMissing = map[string]string{
+	qualifierLabel:     "labels IS EMPTY",
+	qualifierAssignee:  "assignees IS EMPTY",
+	qualifierMilestone: "milestone IS NULL",
+}
+
+// MeiliFilter compiles the filters, not the state, to a meilisearch filter
+// expression. Values are always quoted, never pasted in.
+func (q Query) MeiliFilter() string {
+	conditions := []string{}
+
+	for _, filter := range q.Filters {
+		var condition string
+
+		switch filter.Qualifier {
+		case qualifierNo:
+			condition = meiliMissing[filter.Value]
+		case qualifierCreated, qualifierUpdated:
+			condition = fmt.Sprintf("%s %s %d", meiliAttributes[filter.Qualifier], filter.Op, filter.Time.Unix())
+		case qualifierComments:
+			condition = fmt.Sprintf("%s %s %d", meiliAttributes[filter.Qualifier], filter.Op, filter.Number)
+		default:
+			condition = meiliAttributes[filter.Qualifier] + " = " + Quote(filter.Value)
+		}
+
+		if filter.Negated {
+			condition = "NOT " + condition
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+var meiliSortAttributes = map[string]string{
+	SortCreated:   AttributeCreatedAt,
+	SortUpdated:   AttributeUpdatedAt,
+	SortComments:  AttributeComments,
+	SortReactions: AttributeReactions,
+}
+
+// MeiliSort is the sort to search with, nil for relevance. Ties are broken on
+// the id like OrderBy does.
+func (q Query) MeiliSort() []string {
+	if q.Sort == nil {
+		return nil
+	}
+
+	direction := ":asc"
+
+	if q.Sort.Desc {
+		direction = ":desc"
+	}
+
+	return []string{meiliSortAttributes[q.Sort.Field] + direction, "id" + direction}
+}
+
+// Quote makes a meilisearch filter string out of any value.
+func Quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+var sqlConditions = map[string]string{
+	qualifierLabel:     "EXISTS (SELECT 1 FROM jsonb_array_elements(labels) l WHERE lower(l->>'name') = lower(%s))",
+	qualifierAuthor:    "COALESCE(lower(author->>'login') = lower(%s), false)",
+	qualifierAssignee:  "EXISTS (SELECT 1 FROM jsonb_array_elements(assignees) a WHERE lower(a->>'login') = lower(%s))",
+	qualifierMilestone: "COALESCE(lower(milestone->>'title') = lower(%s), false)",
+	qualifierCreated:   "created_at %s %s",
+	qualifierUpdated:   "COALESCE(updated_at, created_at) %s %s",
+	qualifierComments:  "comments_count %s %s",
+}
+
+var sqlMissing = map[string]string{
+	qualifierLabel:     "jsonb_array_length(labels) = 0",
+	qualifierAssignee:  "jsonb_array_length(assignees) = 0",
+	qualifierMilestone: "(milestone IS NULL OR milestone = 'null'::jsonb)",
+}
+
+// SQL compiles the filters, not the state, to conditions on the issues table,
+// each prefixed with AND. Placeholders are numbered from firstParam so they
+// can follow the caller's own.
+func (q Query) SQL(firstParam int) (string, []interface{}) {
+	conditions := strings.Builder{}
+	args := []interface{}{}
+
+	placeholder := func(arg interface{}) string {
+		args = append(args, arg)
+
+		return "$" + strconv.Itoa(firstParam+len(args)-1)
+	}
+
+	for _, filter := range q.Filters {
+		var condition string
+
+		switch filter.Qualifier {
+		case qualifierNo:
+			condition = sqlMissing[filter.Value]
+		case qualifierCreated, qualifierUpdated:
+			condition = fmt.Sprintf(sqlConditions[filter.Qualifier], filter.Op, placeholder(filter.Time))
+		case qualifierComments:
+			condition = fmt.Sprintf(sqlConditions[filter.Qualifier], filter.Op, placeholder(filter.Number))
+		default:
+			condition = fmt.Sprintf(sqlConditions[filter.Qualifier], placeholder(filter.Value))
+		}
+
+		if filter.Negated {
+			condition = "NOT " + condition
+		}
+
+		conditions.WriteString(" AND " + condition)
+	}
+
+	return conditions.String(), args
+}
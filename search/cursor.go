@@ -0,0 +1,119 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Cursor is where a page of results left off, handed to clients as an opaque
+// string. Listings from Postgres carry the sort key of the last row, searches
+// an offset.
+type Cursor struct {
+	Sort   string `json:"s,omitempty"`
+	Desc   bool   `json:"d,omitempty"`
+	Micros int64  `json:"t,omitempty"`
+	Number uint64 `json:"n,omitempty"`
+	ID     uint64 `json:"i,omitempty"`
+	Offset int64  `json:"o,omitempty"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func (c Cursor) Encode() string {
+	encoded, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func DecodeCursor(value string) (Cursor, error) {
+	cursor := Cursor{}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(decoded, &cursor); err != nil || cursor.Offset < 0 {
+		return cursor, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+var sortColumns = map[string]string{
+	SortCreated:   "created_at",
+	SortUpdated:   "COALESCE(updated_at, created_at)",
+	SortComments:  "comments_count",
+	SortReactions: "COALESCE((reactions->>'total_count')::bigint, 0)",
+}
+
+// sortKey is the query's sort, newest first by default.
+func (q Query) sortKey() (string, bool) {
+	if q.Sort == nil {
+		return SortCreated, true
+	}
+
+	return q.Sort.Field, q.Sort.Desc
+}
+
+// OrderBy is the ORDER BY for the query's sort. The id breaks ties, so every
+// row has a place a cursor can point at.
+func (q Query) OrderBy() string {
+	field, desc := q.sortKey()
+
+	if desc {
+		return sortColumns[field] + " DESC, id DESC"
+	}
+
+	return sortColumns[field] + " ASC, id ASC"
+}
+
+// After is the condition, prefixed with AND, for rows past the cursor in the
+// query's order. A cursor from a differently sorted listing is refused.
+func (q Query) After(cursor Cursor, firstParam int) (string, []interface{}, error) {
+	field, desc := q.sortKey()
+
+	if cursor.Sort != field || cursor.Desc != desc {
+		return "", nil, fmt.Errorf("%w: it belongs to a differently sorted listing", ErrInvalidCursor)
+	}
+
+	var value interface{} = time.UnixMicro(cursor.Micros).UTC()
+
+	if field == SortComments || field == SortReactions {
+		value = cursor.Number
+	}
+
+	op := ">"
+
+	if desc {
+		op = "<"
+	}
+
+	condition := fmt.Sprintf(" AND (%s, id) %s ($%d, $%d)", sortColumns[field], op, firstParam, firstParam+1)
+
+	return condition, []interface{}{value, cursor.ID}, nil
+}
+
+// CursorAfter points past a row with these sort keys.
+func (q Query) CursorAfter(id uint64, createdAt time.Time, updatedAt time.Time, comments uint64, reactions uint64) Cursor {
+	field, desc := q.sortKey()
+
+	cursor := Cursor{Sort: field, Desc: desc, ID: id}
+
+	switch field {
+	case SortCreated:
+		cursor.Micros = createdAt.UnixMicro()
+	case SortUpdated:
+		cursor.Micros = updatedAt.UnixMicro()
+	case SortComments:
+		cursor.Number = comments
+	case SortReactions:
+		cursor.Number = reactions
+	}
+
+	return cursor
+}
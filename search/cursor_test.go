@@ -0,0 +1,118 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursors := []Cursor{
+		{},
+		{Offset: 50},
+		{Sort: SortCreated, Desc: true, Micros: 1704067200123456, ID: 42},
+		{Sort: SortComments, Number: 7, ID: 3},
+	}
+
+	for _, cursor := range cursors {
+		decoded, err := DecodeCursor(cursor.Encode())
+
+		if err != nil {
+			t.Errorf("DecodeCursor(%+v) failed: %v", cursor, err)
+
+			continue
+		}
+
+		if decoded != cursor {
+			t.Errorf("DecodeCursor(Encode()) = %+v, want %+v", decoded, cursor)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	values := []string{
+		"not base64!",
+		"bm90IGpzb24",               // "not json"
+		Cursor{Offset: -1}.Encode(), // a negative offset
+	}
+
+	for _, value := range values {
+		if _, err := DecodeCursor(value); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q) = %v, want ErrInvalidCursor", value, err)
+		}
+	}
+}
+
+func TestCursorAfter(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	updatedAt := createdAt.Add(time.Hour)
+
+	tests := []struct {
+		sort *Sort
+		want Cursor
+	}{
+		{sort: nil, want: Cursor{Sort: SortCreated, Desc: true, Micros: createdAt.UnixMicro(), ID: 9}},
+		{sort: &Sort{Field: SortUpdated}, want: Cursor{Sort: SortUpdated, Micros: updatedAt.UnixMicro(), ID: 9}},
+		{sort: &Sort{Field: SortComments, Desc: true}, want: Cursor{Sort: SortComments, Desc: true, Number: 4, ID: 9}},
+		{sort: &Sort{Field: SortReactions}, want: Cursor{Sort: SortReactions, Number: 2, ID: 9}},
+	}
+
+	for _, test := range tests {
+		got := Query{Sort: test.sort}.CursorAfter(9, createdAt, updatedAt, 4, 2)
+
+		if got != test.want {
+			t.Errorf("CursorAfter() with sort %+v = %+v, want %+v", test.sort, got, test.want)
+		}
+	}
+}
+
+func TestAfter(t *testing.T) {
+	query := Query{Sort: &Sort{Field: SortComments}}
+
+	condition, args, err := query.After(Cursor{Sort: SortComments, Number: 4, ID: 9}, 6)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if condition != " AND (comments_count, id) > ($6, $7)" {
+		t.Errorf("After() = %s", condition)
+	}
+
+	if !reflect.DeepEqual(args, []interface{}{uint64(4), uint64(9)}) {
+		t.Errorf("After() args = %v", args)
+	}
+
+	micros := int64(1704067200123456)
+
+	condition, args, err = Query{}.After(Cursor{Sort: SortCreated, Desc: true, Micros: micros, ID: 9}, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if condition != " AND (created_at, id) < ($2, $3)" || !args[0].(time.Time).Equal(time.UnixMicro(micros)) {
+		t.Errorf("After() = %s %v", condition, args)
+	}
+}
+
+func TestAfterRefusesAnotherSort(t *testing.T) {
+	cursor := Query{}.CursorAfter(9, time.Now(), time.Now(), 0, 0)
+
+	for _, sort := range []*Sort{{Field: SortCreated}, {Field: SortUpdated, Desc: true}} {
+		if _, _, err := (Query{Sort: sort}).After(cursor, 1); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("After() with sort %+v = %v, want ErrInvalidCursor", sort, err)
+		}
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	if got := (Query{}).OrderBy(); got != "created_at DESC, id DESC" {
+		t.Errorf("OrderBy() = %s", got)
+	}
+
+	if got := (Query{Sort: &Sort{Field: SortUpdated}}).OrderBy(); got != "COALESCE(updated_at, created_at) ASC, id ASC" {
+		t.Errorf("OrderBy() = %s", got)
+	}
+}
@@ -0,0 +1,84 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// markDirty records that the repository's primary index missed a write. A
+// later mark moves marked_at, so a rebuild already underway doesn't clear it.
+func markDirty(ctx context.Context, db *sqlx.DB, repo Repo) error {
+	_, err := db.ExecContext(ctx, `
+	INSERT INTO search_dirty_repos
+		(provider, host, repo_owner, repo_name)
+	VALUES
+		($1, $2, lower($3), lower($4))
+	ON CONFLICT (provider, host, repo_owner, repo_name) DO UPDATE
+	SET marked_at=now()
+	`, repo.Provider, repo.Host, repo.Owner, repo.Name)
+
+	return err
+}
+
+// dirtyMark reads the repository's mark, it's invalid when there's none.
+func dirtyMark(ctx context.Context, db *sqlx.DB, repo Repo) (sql.NullTime, error) {
+	markedAt := sql.NullTime{}
+
+	err := db.GetContext(ctx, &markedAt, `
+	SELECT marked_at FROM search_dirty_repos
+	WHERE provider=$1 AND host=$2 AND repo_owner=lower($3) AND repo_name=lower($4)
+	`, repo.Provider, repo.Host, repo.Owner, repo.Name)
+
+	if err == sql.ErrNoRows {
+		return markedAt, nil
+	}
+
+	return markedAt, err
+}
+
+// clearDirty forgets the repository's mark unless it moved past markedAt, a
+// value read by dirtyMark. Both sides are Postgres' clock, so the worker's
+// can't clear a mark made after the read.
+func clearDirty(ctx context.Context, db *sqlx.DB, repo Repo, markedAt sql.NullTime) error {
+	if !markedAt.Valid {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, `
+	DELETE FROM search_dirty_repos
+	WHERE provider=$1 AND host=$2 AND repo_owner=lower($3) AND repo_name=lower($4) AND marked_at <= $5
+	`, repo.Provider, repo.Host, repo.Owner, repo.Name, markedAt.Time)
+
+	return err
+}
+
+// DirtyRepos lists the repositories whose primary index missed writes, oldest
+// first, see Failover.Index.
+func DirtyRepos(ctx context.Context, db *sqlx.DB) ([]Repo, error) {
+	rows := []struct {
+		Provider  string `db:"provider"`
+		Host      string `db:"host"`
+		RepoOwner string `db:"repo_owner"`
+		RepoName  string `db:"repo_name"`
+	}{}
+
+	err := db.SelectContext(ctx, &rows, `
+	SELECT provider, host, repo_owner, repo_name FROM search_dirty_repos
+	ORDER BY marked_at ASC
+	LIMIT 500
+	`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	repos := []Repo{}
+
+	for _, row := range rows {
+		repos = append(repos, Repo{Provider: row.Provider, Host: row.Host, Owner: row.RepoOwner, Name: row.RepoName})
+	}
+
+	return repos, nil
+}
@@ -0,0 +1,117 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	FacetLabels    = "labels"
+	FacetAuthor    = "author"
+	FacetAssignees = "assignees"
+	FacetMilestone = "milestone"
+
+	// Like meilisearch's maxValuesPerFacet, the most common values only
+	maxFacetValues = 100
+)
+
+// The meilisearch attribute each facet counts
+var meiliFacetAttributes = map[string]string{
+	FacetLabels:    "labels.name",
+	FacetAuthor:    "author.login",
+	FacetAssignees: "assignees.login",
+	FacetMilestone: "milestone.title",
+}
+
+// The rows each facet counts, one per value an issue has
+var sqlFacetValues = map[string]string{
+	FacetLabels:    "SELECT l->>'name' FROM jsonb_array_elements(i.labels) l",
+	FacetAuthor:    "SELECT i.author->>'login'",
+	FacetAssignees: "SELECT a->>'login' FROM jsonb_array_elements(i.assignees) a",
+	FacetMilestone: "SELECT i.milestone->>'title'",
+}
+
+// ParseFacets reads a comma separated list of facets, e.g. labels,author.
+func ParseFacets(value string) ([]string, error) {
+	facets := []string{}
+
+	for _, facet := range strings.Split(value, ",") {
+		facet = strings.ToLower(strings.TrimSpace(facet))
+
+		if facet == "" {
+			continue
+		}
+
+		if _, ok := meiliFacetAttributes[facet]; !ok {
+			return nil, fmt.Errorf("facets must be from labels, author, assignees and milestone")
+		}
+
+		facets = append(facets, facet)
+	}
+
+	return facets, nil
+}
+
+// MeiliFacets are the attributes to ask meilisearch to count for facets.
+func MeiliFacets(facets []string) []string {
+	attributes := []string{}
+
+	for _, facet := range facets {
+		attributes = append(attributes, meiliFacetAttributes[facet])
+	}
+
+	return attributes
+}
+
+// MeiliFacetDistribution turns meilisearch's facetDistribution back into
+// counts keyed by facet name.
+func MeiliFacetDistribution(facets []string, distribution interface{}) map[string]map[string]int64 {
+	counts := map[string]map[string]int64{}
+	attributes, _ := distribution.(map[string]interface{})
+
+	for _, facet := range facets {
+		counts[facet] = map[string]int64{}
+		values, _ := attributes[meiliFacetAttributes[facet]].(map[string]interface{})
+
+		for value, count := range values {
+			if number, ok := count.(float64); ok {
+				counts[facet][value] = int64(number)
+			}
+		}
+	}
+
+	return counts
+}
+
+// MeiliStateCounts reads the open and closed counts out of a
+// facetDistribution that includes the closed attribute.
+func MeiliStateCounts(distribution interface{}) (int64, int64) {
+	attributes, _ := distribution.(map[string]interface{})
+	values, _ := attributes["closed"].(map[string]interface{})
+
+	open, _ := values["false"].(float64)
+	closed, _ := values["true"].(float64)
+
+	return int64(open), int64(closed)
+}
+
+// FacetsSQL counts the facets over the issues matching where, which is a
+// condition on the issues table aliased as i. The result has facet, value
+// and count columns.
+func FacetsSQL(facets []string, where string) string {
+	parts := []string{}
+
+	for _, facet := range facets {
+		parts = append(parts, fmt.Sprintf(`(
+	SELECT '%s' AS facet, v.value, count(*) AS count
+	FROM issues i
+	CROSS JOIN LATERAL (%s) AS v(value)
+	WHERE %s AND v.value IS NOT NULL
+	GROUP BY v.value
+	ORDER BY count DESC, v.value ASC
+	LIMIT %d
+	)`, facet, sqlFacetValues[facet], where, maxFacetValues))
+	}
+
+	return strings.Join(parts, "\n\tUNION ALL\n\t")
+}
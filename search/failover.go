@@ -0,0 +1,141 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Failover searches the primary backend while its breaker is closed and the
+// fallback otherwise. Writes go to both, so the fallback is never behind, and
+// the repositories the primary misses writes for are rebuilt once it's back.
+type Failover struct {
+	primary  Backend
+	fallback Backend
+	breaker  *Breaker
+	db       *sqlx.DB
+}
+
+func NewFailover(primary Backend, fallback Backend, breaker *Breaker, db *sqlx.DB) *Failover {
+	return &Failover{
+		primary:  primary,
+		fallback: fallback,
+		breaker:  breaker,
+		db:       db,
+	}
+}
+
+func (f *Failover) Name() string {
+	return f.primary.Name() + "+" + f.fallback.Name()
+}
+
+func (f *Failover) Search(ctx context.Context, request Request) (*Result, error) {
+	if f.breaker.Allow() {
+		result, err := f.primary.Search(ctx, request)
+
+		f.breaker.Record(err)
+
+		var requestErr *RequestError
+
+		// Refused, not down, the caller gets the error
+		if err == nil || errors.As(err, &requestErr) {
+			return result, err
+		}
+
+		slog.Warn("💀 Primary search backend failed, using the fallback",
+			slog.String("backend", f.primary.Name()),
+			slog.String("error", err.Error()))
+	}
+
+	result, err := f.fallback.Search(ctx, request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.Degraded = true
+
+	return result, nil
+}
+
+// Index writes to the fallback first. A primary write that fails, or is
+// skipped while the circuit is open, marks the repository dirty rather than
+// failing the task, as a long outage would archive the task before the
+// primary came back. The worker rebuilds dirty repositories, see DirtyRepos.
+func (f *Failover) Index(ctx context.Context, repo Repo, documents []Document) error {
+	if err := f.fallback.Index(ctx, repo, documents); err != nil {
+		return err
+	}
+
+	return f.writePrimary(ctx, repo, func() error {
+		return f.primary.Index(ctx, repo, documents)
+	})
+}
+
+func (f *Failover) Delete(ctx context.Context, repo Repo, issueID uint64) error {
+	if err := f.fallback.Delete(ctx, repo, issueID); err != nil {
+		return err
+	}
+
+	return f.writePrimary(ctx, repo, func() error {
+		return f.primary.Delete(ctx, repo, issueID)
+	})
+}
+
+func (f *Failover) writePrimary(ctx context.Context, repo Repo, write func() error) error {
+	if f.breaker.Allow() {
+		err := write()
+
+		f.breaker.Record(err)
+
+		var requestErr *RequestError
+
+		// Refused or given up on, not down, the caller gets the error
+		if err == nil || errors.As(err, &requestErr) || errors.Is(err, context.Canceled) {
+			return err
+		}
+
+		slog.Warn("💀 Primary search backend missed a write, marking the repository for a rebuild",
+			slog.String("backend", f.primary.Name()),
+			slog.String("owner", repo.Owner),
+			slog.String("name", repo.Name),
+			slog.String("error", err.Error()))
+	}
+
+	return markDirty(ctx, f.db, repo)
+}
+
+// Rebuild rebuilds the primary, writing every batch to the fallback as it
+// passes through. A finished rebuild catches up on the writes the primary
+// missed before it started.
+func (f *Failover) Rebuild(ctx context.Context, repo Repo, next func() ([]Document, error)) (int, error) {
+	// Writes missed after this read mark the repository again
+	markedAt, err := dirtyMark(ctx, f.db, repo)
+
+	if err != nil {
+		return 0, err
+	}
+
+	indexed, err := f.primary.Rebuild(ctx, repo, func() ([]Document, error) {
+		documents, err := next()
+
+		if err == nil && len(documents) > 0 {
+			err = f.fallback.Index(ctx, repo, documents)
+		}
+
+		return documents, err
+	})
+
+	if err != nil {
+		return indexed, err
+	}
+
+	return indexed, clearDirty(ctx, f.db, repo, markedAt)
+}
+
+// ApplySettings only applies to the primary, the fallback has no settings.
+func (f *Failover) ApplySettings(ctx context.Context, repo Repo, settings IndexSettings) error {
+	return f.primary.ApplySettings(ctx, repo, settings)
+}
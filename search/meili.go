@@ -0,0 +1,683 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// id is filterable so a rebuild can look up the live copies of a batch
+var issueFilterableAttributes = []string{
+	"id", "repo_owner", "repo_name", "closed", "labels", "author", "assignees", "milestone",
+	AttributeComments, AttributeCreatedAt, AttributeUpdatedAt,
+}
+
+var issueSortableAttributes = []string{
+	"id", AttributeComments, AttributeReactions, AttributeCreatedAt, AttributeUpdatedAt,
+}
+
+// Ordered by importance, a match in the title ranks above one in the body
+var issueSearchableAttributes = []string{"title", "issue_number", "body", "comments", "labels", "milestone", "author", "assignees"}
+
+// The fields models.Issues.ToMap serves, hits leave out the folded in comments
+// and the numbers search filters and sorts on, as the Postgres backend does
+var issueRetrievedAttributes = []string{
+	"id", "provider", "host", "created_at", "updated_at", "title", "body", "html_url", "issue_number", "comments_count",
+	"repo_name", "repo_owner", "author", "author_association", "labels", "assignees", "milestone", "closed", "closed_at",
+	"closed_by", "state_reason", "locked", "active_lock_reason", "reactions",
+}
+
+// How long a process trusts what it last saw of a shadow index. A rebuild
+// waits this long after creating one, so every writer has seen it before the
+// first batch is read.
+const shadowStateTTL = 10 * time.Second
+
+// Meili keeps each repository's issues in their own index, see
+// forge.IssueIndexName.
+type Meili struct {
+	client *meilisearch.Client
+	db     *sqlx.DB
+	// Indexes whose settings this process has applied, by name
+	configured sync.Map
+	// Whether each index has a shadow index, by name, see shadowState
+	shadows sync.Map
+}
+
+type shadowState struct {
+	exists    bool
+	checkedAt time.Time
+}
+
+func NewMeili(client *meilisearch.Client, db *sqlx.DB) *Meili {
+	return &Meili{client: client, db: db}
+}
+
+func (m *Meili) Name() string {
+	return BackendMeilisearch
+}
+
+func indexName(repo Repo) string {
+	return forge.IssueIndexName(repo.Provider, repo.Host, repo.Owner, repo.Name)
+}
+
+// shadowIndexName is where a rebuild puts the new copy of an index. Index
+// names all start with "issues", so the prefix can't collide with one.
+func shadowIndexName(indexName string) string {
+	return "reindex-" + indexName
+}
+
+// indexes is the live index plus, while a rebuild is filling it, the shadow
+// index. Writing to both means changes made during a rebuild survive the swap.
+func (m *Meili) indexes(repo Repo) ([]*meilisearch.Index, error) {
+	name := indexName(repo)
+	indexes := []*meilisearch.Index{m.client.Index(name)}
+
+	hasShadow, err := m.hasShadow(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if hasShadow {
+		indexes = append(indexes, m.client.Index(shadowIndexName(name)))
+	}
+
+	return indexes, nil
+}
+
+// hasShadow asks meilisearch whether the index has a shadow index at most
+// once per shadowStateTTL, rather than on every write. When it can't tell,
+// the write fails rather than maybe missing the shadow and being lost at the
+// swap.
+func (m *Meili) hasShadow(name string) (bool, error) {
+	if cached, ok := m.shadows.Load(name); ok && time.Since(cached.(shadowState).checkedAt) < shadowStateTTL {
+		return cached.(shadowState).exists, nil
+	}
+
+	_, err := m.client.GetIndex(shadowIndexName(name))
+
+	var meiliErr *meilisearch.Error
+
+	if err != nil && !(errors.As(err, &meiliErr) && meiliErr.MeilisearchApiError.Code == "index_not_found") {
+		return false, err
+	}
+
+	m.shadows.Store(name, shadowState{exists: err == nil, checkedAt: time.Now()})
+
+	return err == nil, nil
+}
+
+// meiliSettings is the whole of an index's settings, the attributes search
+// filters and sorts on are always there.
+func meiliSettings(settings IndexSettings) *meilisearch.Settings {
+	meiliSettings := &meilisearch.Settings{
+		FilterableAttributes: issueFilterableAttributes,
+		SortableAttributes:   issueSortableAttributes,
+		SearchableAttributes: issueSearchableAttributes,
+		RankingRules:         builtinRankingRules,
+		Synonyms:             settings.Synonyms,
+		StopWords:            settings.StopWords,
+		DistinctAttribute:    settings.DistinctAttribute,
+		TypoTolerance: &meilisearch.TypoTolerance{
+			Enabled: true,
+			MinWordSizeForTypos: meilisearch.MinWordSizeForTypos{
+				OneTypo:  5,
+				TwoTypos: 9,
+			},
+		},
+	}
+
+	if len(settings.SearchableAttributes) > 0 {
+		meiliSettings.SearchableAttributes = settings.SearchableAttributes
+	}
+
+	if len(settings.RankingRules) > 0 {
+		meiliSettings.RankingRules = settings.RankingRules
+	}
+
+	if settings.DistinctAttribute != nil && *settings.DistinctAttribute == "" {
+		meiliSettings.DistinctAttribute = nil
+	}
+
+	if typo := settings.TypoTolerance; typo != nil {
+		if typo.MinWordSizeForOneTypo > 0 {
+			meiliSettings.TypoTolerance.MinWordSizeForTypos.OneTypo = typo.MinWordSizeForOneTypo
+		}
+
+		if typo.MinWordSizeForTwoTypos > 0 {
+			meiliSettings.TypoTolerance.MinWordSizeForTypos.TwoTypos = typo.MinWordSizeForTwoTypos
+		}
+
+		meiliSettings.TypoTolerance.DisableOnWords = typo.DisableOnWords
+		meiliSettings.TypoTolerance.DisableOnAttributes = typo.DisableOnAttributes
+
+		// The client drops enabled: false, turning typos off on every
+		// attribute does the same
+		if typo.Enabled != nil && !*typo.Enabled {
+			meiliSettings.TypoTolerance.DisableOnAttributes = issueSearchableAttributes
+		}
+	}
+
+	return meiliSettings
+}
+
+// ApplySettings brings the repository's indexes in line with settings.
+func (m *Meili) ApplySettings(ctx context.Context, repo Repo, settings IndexSettings) error {
+	indexes, err := m.indexes(repo)
+
+	if err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if err := m.applySettings(index, settings); err != nil {
+			return err
+		}
+
+		m.configured.Store(index.UID, true)
+	}
+
+	return nil
+}
+
+// applySettings updates the index's settings. Empty settings are left out of
+// an update, so the ones that were set before are reset first.
+func (m *Meili) applySettings(index *meilisearch.Index, settings IndexSettings) error {
+	desired := meiliSettings(settings)
+
+	// An index that doesn't exist yet has nothing to reset
+	current, err := index.GetSettings()
+
+	if err != nil {
+		current = &meilisearch.Settings{}
+	}
+
+	resets := []func() (*meilisearch.TaskInfo, error){}
+
+	if len(desired.StopWords) == 0 && len(current.StopWords) > 0 {
+		resets = append(resets, index.ResetStopWords)
+	}
+
+	if len(desired.Synonyms) == 0 && len(current.Synonyms) > 0 {
+		resets = append(resets, index.ResetSynonyms)
+	}
+
+	if desired.DistinctAttribute == nil && current.DistinctAttribute != nil {
+		resets = append(resets, index.ResetDistinctAttribute)
+	}
+
+	if current.TypoTolerance != nil &&
+		((len(desired.TypoTolerance.DisableOnWords) == 0 && len(current.TypoTolerance.DisableOnWords) > 0) ||
+			(len(desired.TypoTolerance.DisableOnAttributes) == 0 && len(current.TypoTolerance.DisableOnAttributes) > 0)) {
+		resets = append(resets, index.ResetTypoTolerance)
+	}
+
+	for _, reset := range resets {
+		taskInfo, err := reset()
+
+		if err != nil {
+			return err
+		}
+
+		if err := m.wait(taskInfo); err != nil {
+			return err
+		}
+	}
+
+	taskInfo, err := index.UpdateSettings(desired)
+
+	if err != nil {
+		return err
+	}
+
+	return m.wait(taskInfo)
+}
+
+// ensureSettings applies the stored settings to indexes this process hasn't
+// seen yet, such as a new repository's.
+func (m *Meili) ensureSettings(ctx context.Context, repo Repo) error {
+	if _, ok := m.configured.Load(indexName(repo)); ok {
+		return nil
+	}
+
+	settings, err := LoadIndexSettings(ctx, m.db, repo)
+
+	if err != nil {
+		return err
+	}
+
+	return m.ApplySettings(ctx, repo, settings)
+}
+
+// meiliRequestError marks the errors meilisearch answered with a 4xx, it's up
+// and refused the request. Transport errors and 5xx are left as they are.
+func meiliRequestError(err error) error {
+	var meiliErr *meilisearch.Error
+
+	if errors.As(err, &meiliErr) && meiliErr.StatusCode >= 400 && meiliErr.StatusCode < 500 {
+		return &RequestError{Err: err}
+	}
+
+	return err
+}
+
+// wait waits for an enqueued task and turns a failed one into an error,
+// WaitForTask only errors when it can't find out.
+func (m *Meili) wait(taskInfo *meilisearch.TaskInfo) error {
+	task, err := m.client.WaitForTask(taskInfo.TaskUID)
+
+	if err != nil {
+		return err
+	}
+
+	if task.Status == meilisearch.TaskStatusFailed {
+		// Meilisearch ran it, the task itself was wrong
+		return &RequestError{Err: fmt.Errorf("meilisearch task %d (%s) failed: %s", task.UID, task.Type, task.Error.Message)}
+	}
+
+	return nil
+}
+
+// Search runs the search and, when it's narrowed to one state, a second one
+// for the open and closed counts, in a single multi-search request.
+func (m *Meili) Search(ctx context.Context, request Request) (*Result, error) {
+	name := indexName(request.Repo)
+
+	repoFilter := "repo_owner = " + Quote(request.Repo.Owner) + " AND repo_name = " + Quote(request.Repo.Name)
+
+	if qualifiers := request.Query.MeiliFilter(); qualifiers != "" {
+		repoFilter += " AND " + qualifiers
+	}
+
+	filter := repoFilter
+
+	switch request.State {
+	case StateOpen:
+		filter = "closed = false AND " + repoFilter
+	case StateClosed:
+		filter = "closed = true AND " + repoFilter
+	}
+
+	searchRequest := meilisearch.SearchRequest{
+		IndexUID:              name,
+		Query:                 request.Query.Text,
+		Offset:                request.Offset,
+		Limit:                 request.Limit,
+		AttributesToRetrieve:  issueRetrievedAttributes,
+		AttributesToHighlight: issueRetrievedAttributes,
+		Filter:                filter,
+		Sort:                  request.Query.MeiliSort(),
+		Facets:                append(MeiliFacets(request.Facets), "closed"),
+	}
+
+	queries := []meilisearch.SearchRequest{searchRequest}
+
+	if filter != repoFilter {
+		searchRequest.Facets = MeiliFacets(request.Facets)
+
+		queries = []meilisearch.SearchRequest{searchRequest, {
+			IndexUID: name,
+			Query:    request.Query.Text,
+			Limit:    1,
+			Filter:   repoFilter,
+			Facets:   []string{"closed"},
+		}}
+	}
+
+	response, err := m.client.MultiSearch(&meilisearch.MultiSearchRequest{
+		Queries: queries,
+	})
+
+	var meiliErr *meilisearch.Error
+
+	// Nothing was ever indexed for the repository
+	if errors.As(err, &meiliErr) && meiliErr.MeilisearchApiError.Code == "index_not_found" {
+		return &Result{Hits: []interface{}{}}, nil
+	}
+
+	if err != nil {
+		return nil, meiliRequestError(err)
+	}
+
+	searchResponse := response.Results[0]
+
+	slog.Info("💡 Search results info",
+		slog.String("query", request.Query.Text),
+		slog.String("filter", filter),
+		slog.Int64("estimated_hits", searchResponse.EstimatedTotalHits),
+		slog.Int64("hits", searchResponse.TotalHits))
+
+	result := &Result{
+		Hits: searchResponse.Hits,
+	}
+
+	result.OpenCount, result.ClosedCount = MeiliStateCounts(response.Results[len(queries)-1].FacetDistribution)
+
+	if len(request.Facets) > 0 {
+		result.Facets = MeiliFacetDistribution(request.Facets, searchResponse.FacetDistribution)
+	}
+
+	return result, nil
+}
+
+func (m *Meili) Index(ctx context.Context, repo Repo, documents []Document) error {
+	return meiliRequestError(m.index(ctx, repo, documents))
+}
+
+func (m *Meili) index(ctx context.Context, repo Repo, documents []Document) error {
+	if err := m.ensureSettings(ctx, repo); err != nil {
+		return err
+	}
+
+	indexes, err := m.indexes(repo)
+
+	if err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		taskInfo, err := index.UpdateDocuments(documents, "id")
+
+		if err != nil {
+			return err
+		}
+
+		if err := m.wait(taskInfo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Meili) Delete(ctx context.Context, repo Repo, issueID uint64) error {
+	return meiliRequestError(m.delete(repo, issueID))
+}
+
+func (m *Meili) delete(repo Repo, issueID uint64) error {
+	indexes, err := m.indexes(repo)
+
+	if err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		taskInfo, err := index.DeleteDocument(strconv.FormatUint(issueID, 10))
+
+		if err != nil {
+			return err
+		}
+
+		if err := m.wait(taskInfo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rebuild fills a shadow index and swaps it with the live one in one step,
+// the live index keeps serving searches until then. Writes made meanwhile go
+// to both, and a batch read from Postgres before such a write doesn't replace
+// it, see addRebuildBatch.
+func (m *Meili) Rebuild(ctx context.Context, repo Repo, next func() ([]Document, error)) (int, error) {
+	name := indexName(repo)
+	shadowName := shadowIndexName(name)
+
+	settings, err := LoadIndexSettings(ctx, m.db, repo)
+
+	if err != nil {
+		return 0, err
+	}
+
+	indexed, err := m.buildShadowIndex(ctx, repo, shadowName, settings, next)
+
+	if err != nil {
+		return indexed, err
+	}
+
+	m.shadows.Store(name, shadowState{exists: false, checkedAt: time.Now()})
+
+	// Until every writer has seen the swap, some still write the shadow name.
+	// Deleting it earlier lets one of those writes create it again.
+	select {
+	case <-ctx.Done():
+		// The next rebuild starts by deleting it anyway
+		return indexed, nil
+	case <-time.After(shadowStateTTL):
+	}
+
+	// After the swap the shadow name holds the old documents
+	deleteShadow, err := m.client.DeleteIndex(shadowName)
+
+	if err == nil {
+		err = m.wait(deleteShadow)
+	}
+
+	if err != nil {
+		// The next rebuild starts by deleting it anyway
+		slog.Warn("💀 Couldn't delete the old index",
+			slog.String("index", shadowName),
+			slog.String("error", err.Error()))
+	}
+
+	return indexed, nil
+}
+
+func (m *Meili) buildShadowIndex(ctx context.Context, repo Repo, shadowName string, settings IndexSettings, next func() ([]Document, error)) (int, error) {
+	name := indexName(repo)
+
+	// Left over from a rebuild that didn't finish
+	deleteShadow, err := m.client.DeleteIndex(shadowName)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := m.client.WaitForTask(deleteShadow.TaskUID); err != nil {
+		return 0, err
+	}
+
+	createShadow, err := m.client.CreateIndex(&meilisearch.IndexConfig{
+		Uid:        shadowName,
+		PrimaryKey: "id",
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.wait(createShadow); err != nil {
+		return 0, err
+	}
+
+	shadow := m.client.Index(shadowName)
+
+	if err := m.applySettings(shadow, settings); err != nil {
+		return 0, err
+	}
+
+	// Batches are checked against the live copies by id, which needs an id
+	// filter on the live index too. It's created here when there's none yet.
+	if err := m.applySettings(m.client.Index(name), settings); err != nil {
+		return 0, err
+	}
+
+	m.shadows.Store(name, shadowState{exists: true, checkedAt: time.Now()})
+
+	// Until every writer has seen the shadow, some only write the live index
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(shadowStateTTL):
+	}
+
+	indexed := 0
+
+	for {
+		documents, err := next()
+
+		if err != nil {
+			return indexed, err
+		}
+
+		if len(documents) == 0 {
+			break
+		}
+
+		if err := m.addRebuildBatch(ctx, repo, shadow, documents); err != nil {
+			return indexed, err
+		}
+
+		indexed += len(documents)
+
+		slog.Info("💡 Reindexed batch of issues",
+			slog.String("index", shadowName),
+			slog.Int("indexed", indexed))
+	}
+
+	// Swapping needs both indexes, a repository that was never indexed has
+	// no live one yet. Creating one that exists fails harmlessly.
+	createLive, err := m.client.CreateIndex(&meilisearch.IndexConfig{
+		Uid:        name,
+		PrimaryKey: "id",
+	})
+
+	if err != nil {
+		return indexed, err
+	}
+
+	if _, err := m.client.WaitForTask(createLive.TaskUID); err != nil {
+		return indexed, err
+	}
+
+	swap, err := m.client.SwapIndexes([]meilisearch.SwapIndexesParams{
+		{Indexes: []string{name, shadowName}},
+	})
+
+	if err != nil {
+		return indexed, err
+	}
+
+	if err := m.wait(swap); err != nil {
+		return indexed, err
+	}
+
+	return indexed, nil
+}
+
+// addRebuildBatch adds a batch to the shadow index without undoing the writes
+// made since the batch was read, which went to the shadow index too. Documents
+// the live index holds a newer copy of are left out, and documents deleted or
+// transferred meanwhile are taken back out.
+func (m *Meili) addRebuildBatch(ctx context.Context, repo Repo, shadow *meilisearch.Index, documents []Document) error {
+	ids := []string{}
+
+	for _, document := range documents {
+		ids = append(ids, documentNumber(document["id"]))
+	}
+
+	live := meilisearch.DocumentsResult{}
+
+	err := m.client.Index(indexName(repo)).GetDocuments(&meilisearch.DocumentsQuery{
+		Limit:  int64(len(ids)),
+		Fields: []string{"id", AttributeUpdatedAt},
+		Filter: "id IN [" + strings.Join(ids, ", ") + "]",
+	}, &live)
+
+	if err != nil {
+		return err
+	}
+
+	liveUpdatedAt := map[string]string{}
+
+	for _, document := range live.Results {
+		liveUpdatedAt[documentNumber(document["id"])] = documentNumber(document[AttributeUpdatedAt])
+	}
+
+	batch := []Document{}
+
+	for _, document := range documents {
+		updatedAt, ok := liveUpdatedAt[documentNumber(document["id"])]
+
+		if ok && newerNumber(updatedAt, documentNumber(document[AttributeUpdatedAt])) {
+			continue
+		}
+
+		batch = append(batch, document)
+	}
+
+	if skipped := len(documents) - len(batch); skipped > 0 {
+		slog.Info("💡 Kept newer live copies over the rebuild batch",
+			slog.String("index", shadow.UID),
+			slog.Int("skipped", skipped))
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	taskInfo, err := shadow.AddDocuments(batch, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if err := m.wait(taskInfo); err != nil {
+		return err
+	}
+
+	// A delete from here on reaches the shadow index after the batch did
+	gone := []string{}
+
+	err = m.db.SelectContext(ctx, &gone, `
+	SELECT id::text FROM unnest($1::bigint[]) AS batch(id)
+	WHERE NOT EXISTS (
+		SELECT 1 FROM issues i
+		WHERE i.id = batch.id AND i.provider=$2 AND i.host=$3 AND lower(i.repo_owner)=lower($4) AND lower(i.repo_name)=lower($5) AND i.deleted_at IS NULL
+	)
+	`, pq.Array(ids), repo.Provider, repo.Host, repo.Owner, repo.Name)
+
+	if err != nil || len(gone) == 0 {
+		return err
+	}
+
+	taskInfo, err = shadow.DeleteDocuments(gone)
+
+	if err != nil {
+		return err
+	}
+
+	return m.wait(taskInfo)
+}
+
+// documentNumber is a numeric attribute as digits, whether it came from
+// Postgres as an integer or back from meilisearch as a float.
+func documentNumber(value interface{}) string {
+	switch number := value.(type) {
+	case float64:
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(number)
+	}
+}
+
+// newerNumber reports whether a is a larger integer than b, both as digits.
+func newerNumber(a string, b string) bool {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+
+	return errA == nil && errB == nil && x > y
+}
@@ -0,0 +1,64 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/macwilko/issues-sync/db/models"
+)
+
+func TestDocumentNumber(t *testing.T) {
+	values := map[interface{}]string{
+		uint64(1234567890123):  "1234567890123",
+		int64(1704067200):      "1704067200",
+		float64(1234567890123): "1234567890123",
+		nil:                    "",
+	}
+
+	for value, want := range values {
+		if got := documentNumber(value); got != want {
+			t.Errorf("documentNumber(%v) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestNewerNumber(t *testing.T) {
+	if !newerNumber("1704067201", "1704067200") {
+		t.Error("a later updated_at isn't newer")
+	}
+
+	if newerNumber("1704067200", "1704067200") || newerNumber("", "1704067200") {
+		t.Error("an equal or missing updated_at is newer")
+	}
+}
+
+func TestIssueRetrievedAttributes(t *testing.T) {
+	issue := models.Issues{
+		Author:    types.JSONText(`{}`),
+		Labels:    types.JSONText(`[]`),
+		Assignees: types.JSONText(`[]`),
+		Reactions: types.JSONText(`{}`),
+	}
+
+	served, err := issue.ToMap()
+
+	if err != nil {
+		t.Fatalf("ToMap() error = %v", err)
+	}
+
+	retrieved := map[string]bool{}
+
+	for _, attribute := range issueRetrievedAttributes {
+		retrieved[attribute] = true
+
+		if _, ok := (*served)[attribute]; !ok {
+			t.Errorf("%s is retrieved but Issues.ToMap doesn't serve it", attribute)
+		}
+	}
+
+	for attribute := range *served {
+		if !retrieved[attribute] {
+			t.Errorf("Issues.ToMap serves %s but search hits leave it out", attribute)
+		}
+	}
+}
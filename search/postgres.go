@@ -0,0 +1,211 @@
+package search
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/macwilko/issues-sync/db/models"
+)
+
+// Postgres searches the issues table itself. Matching is full text over the
+// vectors kept in issue_search_documents, with a trigram match on the title
+// catching typos.
+type Postgres struct {
+	db *sqlx.DB
+}
+
+func NewPostgres(db *sqlx.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) Name() string {
+	return BackendPostgres
+}
+
+// Title weighs most, then the body and labels, then the comments
+const searchVectorSQL = `setweight(to_tsvector('english', i.title), 'A') ||
+	setweight(to_tsvector('english', COALESCE(i.body, '') || ' ' || COALESCE((SELECT string_agg(l->>'name', ' ') FROM jsonb_array_elements(i.labels) l), '')), 'B') ||
+	setweight(to_tsvector('english', d.comments), 'C')`
+
+func (p *Postgres) Search(ctx context.Context, request Request) (*Result, error) {
+	repoWhere := "i.provider=$1 AND i.host=$2 AND lower(i.repo_owner)=lower($3) AND lower(i.repo_name)=lower($4) AND i.deleted_at IS NULL"
+	args := []interface{}{request.Repo.Provider, request.Repo.Host, request.Repo.Owner, request.Repo.Name}
+	rank := ""
+
+	if request.Query.Text != "" {
+		args = append(args, request.Query.Text)
+		repoWhere += ` AND (i.id IN (SELECT issue_id FROM issue_search_documents WHERE search_vector @@ websearch_to_tsquery('english', $5)) OR $5 <% i.title)`
+		// Issues not indexed yet have no vector, they rank on the title alone
+		rank = `COALESCE(ts_rank(d.search_vector, websearch_to_tsquery('english', $5)), 0) + word_similarity($5, i.title) DESC, `
+	}
+
+	conditions, conditionArgs := request.Query.SQL(len(args) + 1)
+	repoWhere += conditions
+	args = append(args, conditionArgs...)
+
+	where := repoWhere
+
+	switch request.State {
+	case StateOpen:
+		where += " AND NOT i.closed"
+	case StateClosed:
+		where += " AND i.closed"
+	}
+
+	orderBy := rank + "i.id DESC"
+
+	if request.Query.Sort != nil {
+		orderBy = request.Query.OrderBy()
+	}
+
+	issues := []models.Issues{}
+
+	err := p.db.SelectContext(ctx, &issues, `
+	SELECT i.* FROM issues i
+	LEFT JOIN issue_search_documents d ON d.issue_id = i.id
+	WHERE `+where+`
+	ORDER BY `+orderBy+`
+	LIMIT `+strconv.FormatInt(request.Limit, 10)+` OFFSET `+strconv.FormatInt(request.Offset, 10),
+		args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Hits: []interface{}{},
+	}
+
+	for _, issue := range issues {
+		json, err := issue.ToMap()
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.Hits = append(result.Hits, *json)
+	}
+
+	counts := struct {
+		Open   int64 `db:"open_count"`
+		Closed int64 `db:"closed_count"`
+	}{}
+
+	err = p.db.GetContext(ctx, &counts, `
+	SELECT count(*) FILTER (WHERE NOT i.closed) AS open_count, count(*) FILTER (WHERE i.closed) AS closed_count
+	FROM issues i
+	WHERE `+repoWhere, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.OpenCount = counts.Open
+	result.ClosedCount = counts.Closed
+
+	if len(request.Facets) > 0 {
+		result.Facets, err = CountFacets(ctx, p.db, request.Facets, where, args)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Index rebuilds the documents' vectors from the issues table, only the
+// comments are taken from the documents.
+func (p *Postgres) Index(ctx context.Context, repo Repo, documents []Document) error {
+	if len(documents) == 0 {
+		return nil
+	}
+
+	ids := []int64{}
+	comments := []string{}
+
+	for _, document := range documents {
+		id, _ := document["id"].(uint64)
+		text, _ := document["comments"].([]string)
+
+		ids = append(ids, int64(id))
+		comments = append(comments, strings.Join(text, "\n"))
+	}
+
+	_, err := p.db.ExecContext(ctx, `
+	INSERT INTO issue_search_documents (issue_id, search_vector, indexed_at)
+	SELECT i.id, `+searchVectorSQL+`, NOW()
+	FROM unnest($1::bigint[], $2::text[]) AS d(issue_id, comments)
+	JOIN issues i ON i.id = d.issue_id
+	ON CONFLICT (issue_id) DO UPDATE SET search_vector=EXCLUDED.search_vector, indexed_at=EXCLUDED.indexed_at
+	`, pq.Array(ids), pq.Array(comments))
+
+	return err
+}
+
+func (p *Postgres) Delete(ctx context.Context, repo Repo, issueID uint64) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM issue_search_documents WHERE issue_id=$1", issueID)
+
+	return err
+}
+
+// Rebuild overwrites every document in place, searches see each batch as
+// soon as it's written.
+func (p *Postgres) Rebuild(ctx context.Context, repo Repo, next func() ([]Document, error)) (int, error) {
+	indexed := 0
+
+	for {
+		documents, err := next()
+
+		if err != nil {
+			return indexed, err
+		}
+
+		if len(documents) == 0 {
+			return indexed, nil
+		}
+
+		if err := p.Index(ctx, repo, documents); err != nil {
+			return indexed, err
+		}
+
+		indexed += len(documents)
+	}
+}
+
+// ApplySettings does nothing, the settings are meilisearch's and Postgres
+// ranks with its own text search configuration.
+func (p *Postgres) ApplySettings(ctx context.Context, repo Repo, settings IndexSettings) error {
+	return nil
+}
+
+// CountFacets counts the facets over the issues matching where, see
+// FacetsSQL.
+func CountFacets(ctx context.Context, db *sqlx.DB, facets []string, where string, args []interface{}) (map[string]map[string]int64, error) {
+	rows := []struct {
+		Facet string `db:"facet"`
+		Value string `db:"value"`
+		Count int64  `db:"count"`
+	}{}
+
+	err := db.SelectContext(ctx, &rows, FacetsSQL(facets, where), args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]map[string]int64{}
+
+	for _, facet := range facets {
+		counts[facet] = map[string]int64{}
+	}
+
+	for _, row := range rows {
+		counts[row.Facet][row.Value] = row.Count
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,375 @@
+// Package search parses GitHub style issue search queries, e.g.
+// `crash is:open label:bug -label:wontfix created:>2024-01-01`, and compiles
+// them to meilisearch filters or to parameterized SQL.
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	StateOpen   = "open"
+	StateClosed = "closed"
+
+	SortCreated   = "created"
+	SortUpdated   = "updated"
+	SortComments  = "comments"
+	SortReactions = "reactions"
+)
+
+// Qualifiers the parser understands, anything else with a colon is text.
+const (
+	qualifierIs        = "is"
+	qualifierLabel     = "label"
+	qualifierAuthor    = "author"
+	qualifierAssignee  = "assignee"
+	qualifierMilestone = "milestone"
+	qualifierNo        = "no"
+	qualifierCreated   = "created"
+	qualifierUpdated   = "updated"
+	qualifierComments  = "comments"
+	qualifierSort      = "sort"
+)
+
+// Query is a parsed search. Text is what's left once the qualifiers are
+// taken out, State is empty unless the query has is:open or is:closed.
+type Query struct {
+	Text    string
+	State   string
+	Filters []Filter
+	Sort    *Sort
+}
+
+// Filter is a single condition. Strings compare on Value, created and updated
+// on Time, comments on Number.
+type Filter struct {
+	Qualifier string
+	Negated   bool
+	Op        string
+	Value     string
+	Time      time.Time
+	Number    uint64
+}
+
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// ParseError points at the part of a query that couldn't be understood.
+type ParseError struct {
+	Token   string
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	if e.Token == "" {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%q: %s", e.Token, e.Message)
+}
+
+// Parse reads a query. Values with spaces are quoted, label:"good first issue",
+// and a leading - negates label, author, assignee and milestone.
+func Parse(input string) (Query, error) {
+	q := Query{}
+
+	tokens, err := tokenize(input)
+
+	if err != nil {
+		return q, err
+	}
+
+	text := []string{}
+
+	for _, token := range tokens {
+		key, value, negated, ok := splitQualifier(token)
+
+		if !ok {
+			// Quoted text stays quoted, it's a phrase to meilisearch
+			text = append(text, token.literal)
+
+			continue
+		}
+
+		if value == "" {
+			return q, &ParseError{Token: token.literal, Message: "qualifier needs a value"}
+		}
+
+		if negated && key != qualifierLabel && key != qualifierAuthor && key != qualifierAssignee && key != qualifierMilestone {
+			return q, &ParseError{Token: token.literal, Message: key + ": can't be negated"}
+		}
+
+		switch key {
+		case qualifierIs:
+			switch strings.ToLower(value) {
+			case StateOpen, StateClosed:
+				if q.State != "" && q.State != strings.ToLower(value) {
+					return q, &ParseError{Token: token.literal, Message: "is:open and is:closed can't be combined"}
+				}
+
+				q.State = strings.ToLower(value)
+			case "issue":
+				// Everything here is an issue
+			default:
+				return q, &ParseError{Token: token.literal, Message: "expected is:open or is:closed"}
+			}
+		case qualifierLabel, qualifierAuthor, qualifierAssignee, qualifierMilestone:
+			q.Filters = append(q.Filters, Filter{Qualifier: key, Negated: negated, Op: "=", Value: value})
+		case qualifierNo:
+			switch strings.ToLower(value) {
+			case qualifierLabel, qualifierAssignee, qualifierMilestone:
+				q.Filters = append(q.Filters, Filter{Qualifier: key, Op: "=", Value: strings.ToLower(value)})
+			default:
+				return q, &ParseError{Token: token.literal, Message: "expected no:label, no:assignee or no:milestone"}
+			}
+		case qualifierCreated, qualifierUpdated:
+			filters, err := parseRange(key, value, parseDate)
+
+			if err != nil {
+				return q, &ParseError{Token: token.literal, Message: err.Error()}
+			}
+
+			q.Filters = append(q.Filters, filters...)
+		case qualifierComments:
+			filters, err := parseRange(key, value, parseNumber)
+
+			if err != nil {
+				return q, &ParseError{Token: token.literal, Message: err.Error()}
+			}
+
+			q.Filters = append(q.Filters, filters...)
+		case qualifierSort:
+			sort, err := parseSort(value)
+
+			if err != nil {
+				return q, &ParseError{Token: token.literal, Message: err.Error()}
+			}
+
+			q.Sort = sort
+		}
+	}
+
+	q.Text = strings.Join(text, " ")
+
+	return q, nil
+}
+
+// token is a word of the query as typed (literal) and with its quotes
+// removed (text).
+type token struct {
+	literal string
+	text    string
+}
+
+// tokenize splits on spaces outside double quotes.
+func tokenize(input string) ([]token, error) {
+	tokens := []token{}
+	literal := strings.Builder{}
+	text := strings.Builder{}
+	inQuotes := false
+
+	flush := func() {
+		if literal.Len() > 0 {
+			tokens = append(tokens, token{literal: literal.String(), text: text.String()})
+		}
+
+		literal.Reset()
+		text.Reset()
+	}
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			literal.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuotes:
+			flush()
+		default:
+			literal.WriteRune(r)
+			text.WriteRune(r)
+		}
+	}
+
+	if inQuotes {
+		return nil, &ParseError{Message: "unterminated quote"}
+	}
+
+	flush()
+
+	return tokens, nil
+}
+
+var qualifiers = map[string]bool{
+	qualifierIs:        true,
+	qualifierLabel:     true,
+	qualifierAuthor:    true,
+	qualifierAssignee:  true,
+	qualifierMilestone: true,
+	qualifierNo:        true,
+	qualifierCreated:   true,
+	qualifierUpdated:   true,
+	qualifierComments:  true,
+	qualifierSort:      true,
+}
+
+// splitQualifier reads a qualifier's key off the literal, so "label:bug" in
+// quotes stays text, and its value off the unquoted text.
+func splitQualifier(t token) (string, string, bool, bool) {
+	key, _, found := strings.Cut(t.literal, ":")
+
+	if !found {
+		return "", "", false, false
+	}
+
+	_, value, _ := strings.Cut(t.text, ":")
+
+	negated := strings.HasPrefix(key, "-")
+	key = strings.ToLower(strings.TrimPrefix(key, "-"))
+
+	if !qualifiers[key] {
+		return "", "", false, false
+	}
+
+	return key, value, negated, true
+}
+
+// parseRange reads >x, >=x, <x, <=x, x..y (either side can be *) or a plain
+// value. A plain date covers the whole day.
+func parseRange(key string, value string, parse func(string) (Filter, error)) ([]Filter, error) {
+	if low, high, found := strings.Cut(value, ".."); found {
+		filters := []Filter{}
+
+		if low != "*" {
+			filter, err := parse(low)
+
+			if err != nil {
+				return nil, err
+			}
+
+			filter.Qualifier, filter.Op = key, ">="
+			filters = append(filters, filter)
+		}
+
+		if high != "*" {
+			filter, err := parse(high)
+
+			if err != nil {
+				return nil, err
+			}
+
+			filter.Qualifier, filter.Op = key, "<="
+
+			if !filter.Time.IsZero() && len(high) == len(time.DateOnly) {
+				filter.Op = "<"
+				filter.Time = filter.Time.AddDate(0, 0, 1)
+			}
+
+			filters = append(filters, filter)
+		}
+
+		if len(filters) == 0 {
+			return nil, fmt.Errorf("range needs at least one end")
+		}
+
+		return filters, nil
+	}
+
+	op := "="
+
+	for _, prefix := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(value, prefix) {
+			op = prefix
+			value = strings.TrimPrefix(value, prefix)
+
+			break
+		}
+	}
+
+	filter, err := parse(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter.Qualifier, filter.Op = key, op
+
+	// A day rather than an instant
+	if !filter.Time.IsZero() && len(value) == len(time.DateOnly) {
+		switch op {
+		case "=":
+			next := filter
+			next.Op = "<"
+			next.Time = filter.Time.AddDate(0, 0, 1)
+			filter.Op = ">="
+
+			return []Filter{filter, next}, nil
+		case ">":
+			filter.Op = ">="
+			filter.Time = filter.Time.AddDate(0, 0, 1)
+		case "<=":
+			filter.Op = "<"
+			filter.Time = filter.Time.AddDate(0, 0, 1)
+		}
+	}
+
+	return []Filter{filter}, nil
+}
+
+func parseDate(value string) (Filter, error) {
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return Filter{Time: t}, nil
+		}
+	}
+
+	return Filter{}, fmt.Errorf("expected a date like 2024-01-01")
+}
+
+func parseNumber(value string) (Filter, error) {
+	number, err := strconv.ParseUint(value, 10, 64)
+
+	if err != nil {
+		return Filter{}, fmt.Errorf("expected a number")
+	}
+
+	return Filter{Number: number}, nil
+}
+
+var sortFields = map[string]bool{
+	SortCreated:   true,
+	SortUpdated:   true,
+	SortComments:  true,
+	SortReactions: true,
+}
+
+// parseSort reads a sort: qualifier, a field with an optional -asc or -desc.
+func parseSort(value string) (*Sort, error) {
+	field, direction, _ := strings.Cut(value, "-")
+
+	return NewSort(field, direction)
+}
+
+// NewSort checks a sort field, created, updated, comments or reactions, and a
+// direction, asc or desc. Newest and most commented first by default.
+func NewSort(field string, direction string) (*Sort, error) {
+	field = strings.ToLower(field)
+
+	if !sortFields[field] {
+		return nil, fmt.Errorf("sort must be created, updated, comments or reactions")
+	}
+
+	switch strings.ToLower(direction) {
+	case "", "desc":
+		return &Sort{Field: field, Desc: true}, nil
+	case "asc":
+		return &Sort{Field: field}, nil
+	}
+
+	return nil, fmt.Errorf("direction must be asc or desc")
+}
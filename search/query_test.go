@@ -0,0 +1,178 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func day(value string) time.Time {
+	t, _ := time.Parse(time.DateOnly, value)
+
+	return t
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Query
+	}{
+		{
+			input: "crash on start",
+			want:  Query{Text: "crash on start"},
+		},
+		{
+			input: `crash is:open label:bug -label:"won't fix" author:octo`,
+			want: Query{
+				Text:  "crash",
+				State: StateOpen,
+				Filters: []Filter{
+					{Qualifier: qualifierLabel, Op: "=", Value: "bug"},
+					{Qualifier: qualifierLabel, Negated: true, Op: "=", Value: "won't fix"},
+					{Qualifier: qualifierAuthor, Op: "=", Value: "octo"},
+				},
+			},
+		},
+		{
+			input: `"label:bug" is:issue`,
+			want:  Query{Text: `"label:bug"`},
+		},
+		{
+			input: "no:milestone no:Label",
+			want: Query{
+				Filters: []Filter{
+					{Qualifier: qualifierNo, Op: "=", Value: qualifierMilestone},
+					{Qualifier: qualifierNo, Op: "=", Value: qualifierLabel},
+				},
+			},
+		},
+		{
+			input: "created:2024-01-01",
+			want: Query{
+				Filters: []Filter{
+					{Qualifier: qualifierCreated, Op: ">=", Time: day("2024-01-01")},
+					{Qualifier: qualifierCreated, Op: "<", Time: day("2024-01-02")},
+				},
+			},
+		},
+		{
+			input: "updated:>2024-01-01 created:<=2024-02-01",
+			want: Query{
+				Filters: []Filter{
+					{Qualifier: qualifierUpdated, Op: ">=", Time: day("2024-01-02")},
+					{Qualifier: qualifierCreated, Op: "<", Time: day("2024-02-02")},
+				},
+			},
+		},
+		{
+			input: "created:2024-01-01..* comments:10..20",
+			want: Query{
+				Filters: []Filter{
+					{Qualifier: qualifierCreated, Op: ">=", Time: day("2024-01-01")},
+					{Qualifier: qualifierComments, Op: ">=", Number: 10},
+					{Qualifier: qualifierComments, Op: "<=", Number: 20},
+				},
+			},
+		},
+		{
+			input: "comments:>=5 sort:comments-asc",
+			want: Query{
+				Filters: []Filter{
+					{Qualifier: qualifierComments, Op: ">=", Number: 5},
+				},
+				Sort: &Sort{Field: SortComments},
+			},
+		},
+		{
+			input: "sort:updated",
+			want:  Query{Sort: &Sort{Field: SortUpdated, Desc: true}},
+		},
+		{
+			input: "fix:this",
+			want:  Query{Text: "fix:this"},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := Parse(test.input)
+
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", test.input, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		`label:"bug`,
+		"label:",
+		"is:open is:closed",
+		"is:draft",
+		"-is:open",
+		"no:author",
+		"created:yesterday",
+		"created:*..*",
+		"comments:many",
+		"sort:stars",
+		"sort:created-sideways",
+	}
+
+	for _, input := range tests {
+		_, err := Parse(input)
+
+		var parseErr *ParseError
+
+		if !errors.As(err, &parseErr) {
+			t.Errorf("Parse(%q) = %v, want a ParseError", input, err)
+		}
+	}
+}
+
+func TestMeiliFilter(t *testing.T) {
+	query, err := Parse(`-label:"C:\temp" no:assignee comments:>3 created:>=2024-01-01`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `NOT labels.name = "C:\\temp" AND assignees IS EMPTY AND comments_count > 3 AND created_at_unix >= 1704067200`
+
+	if got := query.MeiliFilter(); got != want {
+		t.Errorf("MeiliFilter() = %s, want %s", got, want)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := Quote(`say "hi" \o/`); got != `"say \"hi\" \\o/"` {
+		t.Errorf("Quote() = %s", got)
+	}
+}
+
+func TestSQL(t *testing.T) {
+	query, err := Parse("label:bug -author:octo comments:<2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conditions, args := query.SQL(6)
+
+	want := " AND EXISTS (SELECT 1 FROM jsonb_array_elements(labels) l WHERE lower(l->>'name') = lower($6))" +
+		" AND NOT COALESCE(lower(author->>'login') = lower($7), false)" +
+		" AND comments_count < $8"
+
+	if conditions != want {
+		t.Errorf("SQL(6) = %s, want %s", conditions, want)
+	}
+
+	if !reflect.DeepEqual(args, []interface{}{"bug", "octo", uint64(2)}) {
+		t.Errorf("SQL(6) args = %v", args)
+	}
+}
@@ -0,0 +1,217 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+)
+
+const (
+	maxSettingsWords = 1000
+	maxWordLength    = 255
+)
+
+// Meilisearch's own ranking rules, attribute:asc and attribute:desc rules can
+// follow them for the sortable attributes
+var builtinRankingRules = []string{"words", "typo", "proximity", "attribute", "sort", "exactness"}
+
+// A distinct attribute keeps one hit per value, so only attributes naming a
+// single issue are allowed, anything else would hide matching issues
+var issueDistinctAttributes = []string{"id", "issue_number", "html_url"}
+
+// IndexSettings are the tunable search settings of a repository, or the
+// defaults for every repository. Fields left nil inherit, from the defaults
+// for a repository and from meilisearch for the defaults, an empty list
+// clears.
+type IndexSettings struct {
+	SearchableAttributes []string            `json:"searchable_attributes"`
+	Synonyms             map[string][]string `json:"synonyms"`
+	StopWords            []string            `json:"stop_words"`
+	RankingRules         []string            `json:"ranking_rules"`
+	TypoTolerance        *TypoTolerance      `json:"typo_tolerance"`
+	DistinctAttribute    *string             `json:"distinct_attribute"`
+}
+
+// TypoTolerance is replaced as a whole. Enabled defaults to true and a word
+// size of 0 to meilisearch's.
+type TypoTolerance struct {
+	Enabled                *bool    `json:"enabled"`
+	MinWordSizeForOneTypo  int64    `json:"min_word_size_for_one_typo"`
+	MinWordSizeForTwoTypos int64    `json:"min_word_size_for_two_typos"`
+	DisableOnWords         []string `json:"disable_on_words"`
+	DisableOnAttributes    []string `json:"disable_on_attributes"`
+}
+
+// Merge lays overrides over s.
+func (s IndexSettings) Merge(overrides IndexSettings) IndexSettings {
+	if overrides.SearchableAttributes != nil {
+		s.SearchableAttributes = overrides.SearchableAttributes
+	}
+
+	if overrides.Synonyms != nil {
+		s.Synonyms = overrides.Synonyms
+	}
+
+	if overrides.StopWords != nil {
+		s.StopWords = overrides.StopWords
+	}
+
+	if overrides.RankingRules != nil {
+		s.RankingRules = overrides.RankingRules
+	}
+
+	if overrides.TypoTolerance != nil {
+		s.TypoTolerance = overrides.TypoTolerance
+	}
+
+	if overrides.DistinctAttribute != nil {
+		s.DistinctAttribute = overrides.DistinctAttribute
+	}
+
+	return s
+}
+
+// Validate checks the settings against the attributes issue documents have.
+func (s IndexSettings) Validate() error {
+	seen := map[string]bool{}
+
+	for _, attribute := range s.SearchableAttributes {
+		if !slices.Contains(issueSearchableAttributes, attribute) {
+			return fmt.Errorf("searchable_attributes must be from %s", strings.Join(issueSearchableAttributes, ", "))
+		}
+
+		if seen[attribute] {
+			return fmt.Errorf("searchable_attributes has %s twice", attribute)
+		}
+
+		seen[attribute] = true
+	}
+
+	if len(s.Synonyms) > maxSettingsWords {
+		return fmt.Errorf("synonyms can have at most %d words", maxSettingsWords)
+	}
+
+	for word, synonyms := range s.Synonyms {
+		if err := validateWords("synonyms", append([]string{word}, synonyms...)); err != nil {
+			return err
+		}
+	}
+
+	if err := validateWords("stop_words", s.StopWords); err != nil {
+		return err
+	}
+
+	// Without the sort rule meilisearch ignores sort:, and ?sort= with it
+	if len(s.RankingRules) > 0 && !slices.Contains(s.RankingRules, "sort") {
+		return fmt.Errorf("ranking_rules must include sort")
+	}
+
+	for _, rule := range s.RankingRules {
+		if slices.Contains(builtinRankingRules, rule) {
+			continue
+		}
+
+		attribute, order, _ := strings.Cut(rule, ":")
+
+		if !slices.Contains(issueSortableAttributes, attribute) || (order != "asc" && order != "desc") {
+			return fmt.Errorf("ranking_rules must be from %s or attribute:asc and attribute:desc, for %s",
+				strings.Join(builtinRankingRules, ", "), strings.Join(issueSortableAttributes, ", "))
+		}
+	}
+
+	if typo := s.TypoTolerance; typo != nil {
+		if typo.MinWordSizeForOneTypo < 0 || typo.MinWordSizeForTwoTypos < 0 || typo.MinWordSizeForOneTypo > 255 || typo.MinWordSizeForTwoTypos > 255 {
+			return fmt.Errorf("typo_tolerance word sizes must be from 0 to 255")
+		}
+
+		if typo.MinWordSizeForOneTypo > 0 && typo.MinWordSizeForTwoTypos > 0 && typo.MinWordSizeForOneTypo > typo.MinWordSizeForTwoTypos {
+			return fmt.Errorf("typo_tolerance min_word_size_for_one_typo can't be above min_word_size_for_two_typos")
+		}
+
+		if err := validateWords("typo_tolerance disable_on_words", typo.DisableOnWords); err != nil {
+			return err
+		}
+
+		for _, attribute := range typo.DisableOnAttributes {
+			if !slices.Contains(issueSearchableAttributes, attribute) {
+				return fmt.Errorf("typo_tolerance disable_on_attributes must be from %s", strings.Join(issueSearchableAttributes, ", "))
+			}
+		}
+	}
+
+	if s.DistinctAttribute != nil && *s.DistinctAttribute != "" && !slices.Contains(issueDistinctAttributes, *s.DistinctAttribute) {
+		return fmt.Errorf("distinct_attribute must be from %s", strings.Join(issueDistinctAttributes, ", "))
+	}
+
+	return nil
+}
+
+func validateWords(setting string, words []string) error {
+	if len(words) > maxSettingsWords {
+		return fmt.Errorf("%s can have at most %d words", setting, maxSettingsWords)
+	}
+
+	for _, word := range words {
+		if strings.TrimSpace(word) == "" || len(word) > maxWordLength {
+			return fmt.Errorf("%s can't have empty words or words over %d bytes", setting, maxWordLength)
+		}
+	}
+
+	return nil
+}
+
+// ParseIndexSettings reads settings as stored or sent to the admin API,
+// unknown fields are refused so a misspelt one isn't silently ignored.
+func ParseIndexSettings(data []byte) (IndexSettings, error) {
+	settings := IndexSettings{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&settings); err != nil {
+		return settings, err
+	}
+
+	return settings, nil
+}
+
+// LoadIndexSettings is the repository's settings laid over the defaults. The
+// defaults are the row with an empty provider, host and repository.
+func LoadIndexSettings(ctx context.Context, db *sqlx.DB, repo Repo) (IndexSettings, error) {
+	rows := []struct {
+		RepoName string         `db:"repo_name"`
+		Settings types.JSONText `db:"settings"`
+	}{}
+
+	err := db.SelectContext(ctx, &rows, `
+	SELECT repo_name, settings FROM search_index_settings
+	WHERE (provider='' AND host='' AND repo_owner='' AND repo_name='')
+		OR (provider=$1 AND host=$2 AND repo_owner=lower($3) AND repo_name=lower($4))
+	ORDER BY repo_name ASC
+	`, repo.Provider, repo.Host, repo.Owner, repo.Name)
+
+	if err != nil {
+		return IndexSettings{}, err
+	}
+
+	settings := IndexSettings{}
+
+	// The defaults sort first
+	for _, row := range rows {
+		overrides := IndexSettings{}
+
+		if err := row.Settings.Unmarshal(&overrides); err != nil {
+			return IndexSettings{}, err
+		}
+
+		settings = settings.Merge(overrides)
+	}
+
+	return settings, nil
+}
@@ -0,0 +1,266 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+type GitHubWebhookUser struct {
+	ID        uint64 `json:"id"`
+	Login     string `json:"login"`
+	AvatarURL string `json:"avatar_url"`
+	HTMLURL   string `json:"html_url"`
+	Type      string `json:"type"`
+	SiteAdmin bool   `json:"site_admin"`
+}
+
+// githubUser reads a typed user out of a raw payload object, it returns nil
+// when there's no user to store.
+func githubUser(raw map[string]interface{}) (*GitHubWebhookUser, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	marshalled, err := json.Marshal(raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var user GitHubWebhookUser
+
+	if err := json.Unmarshal(marshalled, &user); err != nil {
+		return nil, err
+	}
+
+	if user.ID == 0 || user.Login == "" {
+		return nil, nil
+	}
+
+	return &user, nil
+}
+
+func githubUsers(raw []interface{}) ([]GitHubWebhookUser, error) {
+	users := []GitHubWebhookUser{}
+
+	marshalled, err := json.Marshal(raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(marshalled, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// upsertGithubActor stores a user and returns its actor id. The profile is
+// only overwritten from a payload at least as new as the one it came from, see
+// forge.Repository.ActorsSeenAt, and updated_at only moves when the profile
+// changed, which is what HandlePropagateActors watches.
+func upsertGithubActor(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, user GitHubWebhookUser) (uint64, error) {
+	seenAt := sql.NullTime{Time: repo.ActorsSeenAt, Valid: !repo.ActorsSeenAt.IsZero()}
+
+	upsertActor := `
+	INSERT INTO actors
+		(github_id, login, avatar_url, html_url, type, site_admin, provider, host, profile_seen_at)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (provider, host, github_id) DO UPDATE
+	SET login=EXCLUDED.login, avatar_url=EXCLUDED.avatar_url, html_url=EXCLUDED.html_url, type=EXCLUDED.type, site_admin=EXCLUDED.site_admin,
+		profile_seen_at=EXCLUDED.profile_seen_at,
+		updated_at=CASE
+			WHEN (actors.login, actors.avatar_url, actors.html_url, actors.type, actors.site_admin)
+				IS DISTINCT FROM (EXCLUDED.login, EXCLUDED.avatar_url, EXCLUDED.html_url, EXCLUDED.type, EXCLUDED.site_admin)
+			THEN now()
+			ELSE actors.updated_at
+		END
+	WHERE EXCLUDED.profile_seen_at IS NOT NULL
+		AND (actors.profile_seen_at IS NULL OR actors.profile_seen_at <= EXCLUDED.profile_seen_at)
+	RETURNING
+		id
+	`
+
+	var actorID uint64
+
+	err := tx.
+		QueryRowxContext(
+			ctx,
+			upsertActor,
+			user.ID,
+			user.Login,
+			nullIfEmpty(user.AvatarURL),
+			nullIfEmpty(user.HTMLURL),
+			nullIfEmpty(user.Type),
+			user.SiteAdmin,
+			repo.Provider,
+			repo.Host,
+			seenAt,
+		).
+		Scan(&actorID)
+
+	// The stored profile is newer, the actor is linked as it is
+	if err == sql.ErrNoRows {
+		err = tx.GetContext(ctx, &actorID, "SELECT id FROM actors WHERE provider=$1 AND host=$2 AND github_id=$3",
+			repo.Provider, repo.Host, user.ID)
+	}
+
+	return actorID, err
+}
+
+// fillGithubIssueAuthor completes an author the payload only names by id,
+// GitLab hooks do that when someone other than the author triggered them. The
+// stored actor's profile stands in, ghIssue is returned as it is when there's
+// none.
+func fillGithubIssueAuthor(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, ghIssue *forge.Issue) (*forge.Issue, error) {
+	if ghIssue.User == nil || ghIssue.User["login"] != nil {
+		return ghIssue, nil
+	}
+
+	marshalled, err := json.Marshal(ghIssue.User)
+
+	if err != nil {
+		return ghIssue, err
+	}
+
+	var author GitHubWebhookUser
+
+	if err := json.Unmarshal(marshalled, &author); err != nil || author.ID == 0 {
+		return ghIssue, err
+	}
+
+	actor := models.Actors{}
+
+	err = tx.GetContext(ctx, &actor, "SELECT * FROM actors WHERE provider=$1 AND host=$2 AND github_id=$3",
+		repo.Provider, repo.Host, author.ID)
+
+	if err == sql.ErrNoRows {
+		return ghIssue, nil
+	} else if err != nil {
+		return ghIssue, err
+	}
+
+	filled := *ghIssue
+	filled.User = *actor.ToProfileMap()
+
+	return &filled, nil
+}
+
+// upsertGithubSender stores whoever triggered a webhook, if anyone.
+func upsertGithubSender(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, raw map[string]interface{}) error {
+	sender, err := githubUser(raw)
+
+	if err == nil && sender != nil {
+		_, err = upsertGithubActor(ctx, tx, repo, *sender)
+	}
+
+	if err != nil {
+		slog.Error("❌ Couldn't upsert sender, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+	}
+
+	return err
+}
+
+// syncIssueActors links the issue to its author and assignees.
+func syncIssueActors(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, issueID uint64, ghIssue *forge.Issue) error {
+	author, err := githubUser(ghIssue.User)
+
+	if err == nil && author != nil {
+		var authorID uint64
+
+		authorID, err = upsertGithubActor(ctx, tx, repo, *author)
+
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "UPDATE issues SET author_id=$1 WHERE id=$2", authorID, issueID)
+		}
+	}
+
+	if err != nil {
+		slog.Error("❌ Couldn't link issue author, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	closedBy, err := githubUser(ghIssue.ClosedBy)
+
+	if err == nil && closedBy != nil {
+		_, err = upsertGithubActor(ctx, tx, repo, *closedBy)
+	}
+
+	if err != nil {
+		slog.Error("❌ Couldn't upsert closed_by, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	assignees, err := githubUsers(ghIssue.Assignees)
+
+	if err != nil {
+		slog.Error("❌ Couldn't read issue assignees, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	actorIDs := []int64{}
+
+	for _, assignee := range assignees {
+		if assignee.ID == 0 {
+			continue
+		}
+
+		actorID, err := upsertGithubActor(ctx, tx, repo, assignee)
+
+		if err != nil {
+			slog.Error("❌ Couldn't upsert assignee, will retry 💀",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return err
+		}
+
+		actorIDs = append(actorIDs, int64(actorID))
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM issue_assignees WHERE issue_id=$1 AND NOT (actor_id = ANY($2))", issueID, pq.Array(actorIDs))
+
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO issue_assignees (issue_id, actor_id)
+		SELECT $1, unnest($2::bigint[])
+		ON CONFLICT DO NOTHING
+		`, issueID, pq.Array(actorIDs))
+	}
+
+	if err != nil {
+		slog.Error("❌ Couldn't link issue assignees, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/search"
+)
+
+const (
+	ApplySearchSettings = "search:apply-settings"
+)
+
+// ApplySearchSettingsPayload names one repository, or none for every
+// repository, as after the defaults change.
+type ApplySearchSettingsPayload struct {
+	Provider  string
+	Host      string
+	RepoOwner string
+	RepoName  string
+}
+
+func NewApplySearchSettings(Provider string, Host string, RepoOwner string, RepoName string) (*asynq.Task, error) {
+	payload, err := json.Marshal(ApplySearchSettingsPayload{
+		Provider:  Provider,
+		Host:      Host,
+		RepoOwner: RepoOwner,
+		RepoName:  RepoName,
+	})
+
+	slog.Info("Scheduling apply search settings")
+
+	if err != nil {
+		slog.Error("Unable to schedule apply search settings",
+			slog.String("error", err.Error()))
+
+		return nil, err
+	}
+
+	return asynq.NewTask(ApplySearchSettings, payload), nil
+}
+
+// HandleApplySearchSettings reconciles the stored search settings onto the
+// repositories' indexes.
+func HandleApplySearchSettings(ctx context.Context, t *asynq.Task, db *sqlx.DB, backend search.Backend) error {
+	slog.Info("🏃 Starting applying search settings")
+
+	var p ApplySearchSettingsPayload
+
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		slog.Error("Could not apply search settings",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	repos := []search.Repo{{
+		Provider: p.Provider,
+		Host:     p.Host,
+		Owner:    p.RepoOwner,
+		Name:     p.RepoName,
+	}}
+
+	if p.RepoName == "" {
+		repos = []search.Repo{}
+
+		err := db.SelectContext(ctx, &repos, `
+		SELECT provider, host, lower(repo_owner) AS owner, lower(repo_name) AS name FROM issues
+		WHERE deleted_at IS NULL
+		GROUP BY 1, 2, 3, 4
+		`)
+
+		if err != nil {
+			slog.Error("💀 An internal error happened",
+				slog.String("error", err.Error()),
+			)
+
+			return err
+		}
+	}
+
+	for _, repo := range repos {
+		settings, err := search.LoadIndexSettings(ctx, db, repo)
+
+		if err == nil {
+			err = backend.ApplySettings(ctx, repo, settings)
+		}
+
+		if err != nil {
+			slog.Error("💀 Couldn't apply search settings",
+				slog.String("backend", backend.Name()),
+				slog.String("repo_owner", repo.Owner),
+				slog.String("repo_name", repo.Name),
+				slog.String("error", err.Error()),
+			)
+
+			return err
+		}
+	}
+
+	slog.Info("✅ Completed applying search settings",
+		slog.Int("repositories", len(repos)))
+
+	return nil
+}
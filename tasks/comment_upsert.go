@@ -0,0 +1,161 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+var errStaleCommentUpdate = errors.New("comment update is older than the stored comment")
+
+// upsertGithubComment stores a comment in a single statement, the conflict
+// clause only lets through payloads at least as new as the stored row and
+// never revives a deleted comment. A deleted comment we never saw is kept
+// as a tombstone, and a repo scoped delivery can't take over another
+// repository's comment.
+func upsertGithubComment(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, issueGithubID uint64, comment *GitHubWebhookComment, deleted bool) (uint64, error) {
+	createdAt, err := time.Parse(time.RFC3339, comment.CreatedAt)
+
+	if err != nil {
+		slog.Error("❌ Couldn't parse comment created_at, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return 0, err
+	}
+
+	updatedAt, err := parseGithubTime(comment.UpdatedAt)
+
+	if err != nil {
+		slog.Error("❌ Couldn't parse comment updated_at, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return 0, err
+	}
+
+	if !updatedAt.Valid {
+		updatedAt = sql.NullTime{Time: createdAt, Valid: true}
+	}
+
+	author, err := json.Marshal(comment.User)
+
+	if err != nil {
+		slog.Error("❌ Couldn't marshal comment author, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return 0, err
+	}
+
+	authorID := sql.NullInt64{}
+
+	commentAuthor, err := githubUser(comment.User)
+
+	if err == nil && commentAuthor != nil {
+		var actorID uint64
+
+		actorID, err = upsertGithubActor(ctx, tx, repo, *commentAuthor)
+
+		authorID = sql.NullInt64{Int64: int64(actorID), Valid: err == nil}
+	}
+
+	if err != nil {
+		slog.Error("❌ Couldn't upsert comment author, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return 0, err
+	}
+
+	reactions := []byte("{}")
+
+	if comment.Reactions != nil {
+		reactions, err = json.Marshal(comment.Reactions)
+
+		if err != nil {
+			slog.Error("❌ Couldn't marshal comment reactions, will retry 💀",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return 0, err
+		}
+	}
+
+	deletedAt := sql.NullTime{}
+
+	if deleted {
+		deletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	upsertComment := `
+	INSERT INTO issue_comments
+		(github_id, issue_github_id, created_at, updated_at, deleted_at, repo_name, repo_owner, body, html_url, author, author_association, reactions, author_id,
+		 provider, host)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	ON CONFLICT (provider, host, github_id) DO UPDATE
+	SET issue_github_id=EXCLUDED.issue_github_id, updated_at=EXCLUDED.updated_at, deleted_at=EXCLUDED.deleted_at,
+		repo_name=EXCLUDED.repo_name, repo_owner=EXCLUDED.repo_owner, body=EXCLUDED.body, html_url=EXCLUDED.html_url,
+		author=EXCLUDED.author, author_association=EXCLUDED.author_association, reactions=EXCLUDED.reactions, author_id=EXCLUDED.author_id
+	WHERE issue_comments.deleted_at IS NULL
+		AND (EXCLUDED.deleted_at IS NOT NULL OR issue_comments.updated_at IS NULL OR issue_comments.updated_at <= EXCLUDED.updated_at)
+		AND (NOT $16 OR (lower(issue_comments.repo_owner) = lower(EXCLUDED.repo_owner) AND lower(issue_comments.repo_name) = lower(EXCLUDED.repo_name)))
+	RETURNING
+		id
+	`
+
+	var commentID uint64
+
+	err = tx.
+		QueryRowxContext(
+			ctx,
+			upsertComment,
+			comment.ID,
+			issueGithubID,
+			createdAt,
+			updatedAt,
+			deletedAt,
+			repo.Name,
+			repo.Owner.Login,
+			comment.Body,
+			nullIfEmpty(comment.HTMLURL),
+			author,
+			nullIfEmpty(comment.AuthorAssociation),
+			reactions,
+			authorID,
+			repo.Provider,
+			repo.Host,
+			repo.RepoScoped,
+		).
+		Scan(&commentID)
+
+	if err == sql.ErrNoRows {
+		slog.Info("💡 Skipping stale or foreign comment update",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.Uint64("github_id", comment.ID))
+
+		return 0, errStaleCommentUpdate
+	} else if err != nil {
+		slog.Error("❌ Couldn't upsert comment, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return 0, err
+	}
+
+	return commentID, nil
+}
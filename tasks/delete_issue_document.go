@@ -0,0 +1,78 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/hibiken/asynq"
+	"github.com/macwilko/issues-sync/search"
+)
+
+const (
+	DeleteIssueDocument = "search:delete-issue"
+)
+
+type DeleteIssueDocumentPayload struct {
+	IssueID   uint64
+	Provider  string
+	Host      string
+	RepoOwner string
+	RepoName  string
+}
+
+func NewDeleteIssueDocument(IssueID uint64, Provider string, Host string, RepoOwner string, RepoName string) (*asynq.Task, error) {
+	payload, err := json.Marshal(DeleteIssueDocumentPayload{
+		IssueID:   IssueID,
+		Provider:  Provider,
+		Host:      Host,
+		RepoOwner: RepoOwner,
+		RepoName:  RepoName,
+	})
+
+	slog.Info("Scheduling delete issue document")
+
+	if err != nil {
+		slog.Error("Unable to schedule delete issue document",
+			slog.String("error", err.Error()))
+
+		return nil, err
+	}
+
+	return asynq.NewTask(DeleteIssueDocument, payload), nil
+}
+
+func HandleDeleteIssueDocument(ctx context.Context, t *asynq.Task, backend search.Backend) error {
+	slog.Info("🏃 Starting deleting issue document")
+
+	var p DeleteIssueDocumentPayload
+
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		slog.Error("Could not delete issue document",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	err := backend.Delete(ctx, search.Repo{
+		Provider: p.Provider,
+		Host:     p.Host,
+		Owner:    p.RepoOwner,
+		Name:     p.RepoName,
+	}, p.IssueID)
+
+	if err != nil {
+		slog.Error("💀 Couldn't delete issue document",
+			slog.String("backend", backend.Name()),
+			slog.Uint64("issue_id", p.IssueID),
+			slog.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	slog.Info("Completed deleting issue document ✅")
+
+	return nil
+}
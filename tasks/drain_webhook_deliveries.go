@@ -0,0 +1,57 @@
+package tasks
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+)
+
+const (
+	DrainWebhookDeliveries = "webhooks:drain-deliveries"
+)
+
+func NewDrainWebhookDeliveries() *asynq.Task {
+	return asynq.NewTask(DrainWebhookDeliveries, nil)
+}
+
+// HandleDrainWebhookDeliveries enqueues deliveries that were stored but never
+// made it onto the queue (e.g. redis was down), and deliveries that were queued
+// long ago but never finished (e.g. redis lost its data).
+func HandleDrainWebhookDeliveries(ctx context.Context, t *asynq.Task, db *sqlx.DB, queue *asynq.Client) error {
+	slog.Info("🏃 Starting draining webhook deliveries")
+
+	deliveries := []models.WebhookDeliveries{}
+
+	err := db.SelectContext(ctx, &deliveries, `
+	SELECT delivery_id, provider, event FROM webhook_deliveries
+	WHERE (status=$1 AND received_at < now() - interval '30 seconds')
+	   OR (status=$2 AND enqueued_at < now() - interval '1 hour')
+	ORDER BY received_at ASC
+	LIMIT 500
+	`, WebhookDeliveryPending, WebhookDeliveryEnqueued)
+
+	if err != nil {
+		slog.Error("💀 Couldn't fetch pending deliveries, will retry",
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		if err := EnqueueWebhookDelivery(ctx, db, queue, delivery.Provider, delivery.Event, delivery.DeliveryID, false); err != nil {
+			slog.Error("💀 Couldn't enqueue pending delivery, will retry",
+				slog.String("delivery", delivery.DeliveryID),
+				slog.String("error", err.Error()))
+
+			return err
+		}
+	}
+
+	slog.Info("✅ Completed draining webhook deliveries",
+		slog.Int("enqueued", len(deliveries)))
+
+	return nil
+}
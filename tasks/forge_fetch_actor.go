@@ -0,0 +1,211 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/imroc/req/v3"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+const (
+	ForgeFetchActor = "forge:fetch-actor"
+)
+
+type ForgeFetchActorPayload struct {
+	Provider string
+	Host     string
+	GithubID uint64
+}
+
+func NewForgeFetchActor(Provider string, Host string, GithubID uint64) (*asynq.Task, error) {
+	payload, err := json.Marshal(ForgeFetchActorPayload{
+		Provider: Provider,
+		Host:     Host,
+		GithubID: GithubID,
+	})
+
+	if err != nil {
+		slog.Error("Unable to schedule fetching of actor",
+			slog.String("error", err.Error()))
+
+		return nil, err
+	}
+
+	return asynq.NewTask(ForgeFetchActor, payload, asynq.MaxRetry(5)), nil
+}
+
+// unresolvedAuthorID is the id of an author stored without a login. GitLab
+// hooks only name the author by id when someone else triggered them, and an
+// issue we haven't seen its author for can't be filled in from actors.
+func unresolvedAuthorID(issue models.Issues) (uint64, bool) {
+	var author GitHubWebhookUser
+
+	if err := json.Unmarshal(issue.Author, &author); err != nil || author.ID == 0 || author.Login != "" {
+		return 0, false
+	}
+
+	return author.ID, true
+}
+
+// enqueueFetchIssueAuthor asks the worker for the profile of an author the
+// issue only has the id of.
+func enqueueFetchIssueAuthor(queue *asynq.Client, issue models.Issues) {
+	authorID, ok := unresolvedAuthorID(issue)
+
+	if !ok || issue.Provider != forge.ProviderGitlab {
+		return
+	}
+
+	task, err := NewForgeFetchActor(issue.Provider, issue.Host, authorID)
+
+	if err == nil {
+		_, err = queue.Enqueue(task, asynq.Unique(time.Hour), asynq.Queue("low"))
+	}
+
+	if err != nil && !errors.Is(err, asynq.ErrDuplicateTask) {
+		slog.Warn("💀 Could not enqueue fetching of issue author",
+			slog.Uint64("issue_id", issue.ID),
+			slog.String("error", err.Error()))
+	}
+}
+
+// HandleForgeFetchActor loads a GitLab user's profile, stores the actor and
+// puts it on the issues that only had its id, then reindexes them.
+func HandleForgeFetchActor(ctx context.Context, t *asynq.Task, db *sqlx.DB, queue *asynq.Client) error {
+	var p ForgeFetchActorPayload
+
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		slog.Error("❌ Could not process fetch actor payload",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	if p.Provider != forge.ProviderGitlab {
+		return fmt.Errorf("can't fetch %s actors: %w", p.Provider, asynq.SkipRetry)
+	}
+
+	slog.Info("🏃 Starting fetching actor",
+		slog.String("provider", p.Provider),
+		slog.String("host", p.Host),
+		slog.Uint64("github_id", p.GithubID))
+
+	resp, err := req.C().
+		SetTimeout(30 * time.Second).
+		R().
+		SetContext(ctx).
+		Get(forge.GitlabUserURL(p.Host, p.GithubID))
+
+	if err != nil {
+		return err
+	}
+
+	// Blocked or private users have no public profile, the id is all there is
+	if resp.StatusCode == http.StatusNotFound {
+		slog.Info("💡 Actor has no public profile, nothing to do",
+			slog.String("host", p.Host),
+			slog.Uint64("github_id", p.GithubID))
+
+		return nil
+	}
+
+	if !resp.IsSuccessState() {
+		return fmt.Errorf("gitlab users API returned %d", resp.StatusCode)
+	}
+
+	profile, err := forge.GitlabUser(p.Host, resp.Bytes())
+
+	if err != nil {
+		return fmt.Errorf("gitlab user: %v: %w", err, asynq.SkipRetry)
+	}
+
+	user, err := githubUser(profile)
+
+	if err != nil || user == nil {
+		return fmt.Errorf("gitlab user %d isn't usable: %w", p.GithubID, asynq.SkipRetry)
+	}
+
+	issueIDs, err := resolveIssueAuthor(ctx, db, p, *user)
+
+	if err != nil {
+		slog.Error("❌ Couldn't store fetched actor, will retry 💀",
+			slog.String("host", p.Host),
+			slog.Uint64("github_id", p.GithubID),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	enqueueReindexIssues(queue, issueIDs)
+
+	slog.Info("✅ Completed fetching actor",
+		slog.String("login", user.Login),
+		slog.Int("issues", len(issueIDs)))
+
+	return nil
+}
+
+// resolveIssueAuthor stores the actor and replaces the id-only authors of its
+// issues with its profile, as it's stored, returning the issues it changed.
+func resolveIssueAuthor(ctx context.Context, db *sqlx.DB, p ForgeFetchActorPayload, user GitHubWebhookUser) ([]uint64, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		ReadOnly: false,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	repo := &forge.Repository{Provider: p.Provider, Host: p.Host, ActorsSeenAt: time.Now()}
+
+	actorID, err := upsertGithubActor(ctx, tx, repo, user)
+
+	if err != nil {
+		tx.Rollback()
+
+		return nil, err
+	}
+
+	actor := models.Actors{}
+
+	if err := tx.GetContext(ctx, &actor, "SELECT * FROM actors WHERE id=$1", actorID); err != nil {
+		tx.Rollback()
+
+		return nil, err
+	}
+
+	profile, err := json.Marshal(actor.ToProfileMap())
+
+	if err != nil {
+		tx.Rollback()
+
+		return nil, err
+	}
+
+	issueIDs := []uint64{}
+
+	err = tx.SelectContext(ctx, &issueIDs, `
+	UPDATE issues SET author=$1, author_id=$2
+	WHERE provider=$3 AND host=$4 AND (author->>'id')::bigint=$5 AND author->>'login' IS NULL
+	RETURNING
+		id
+	`, profile, actorID, p.Provider, p.Host, p.GithubID)
+
+	if err != nil {
+		tx.Rollback()
+
+		return nil, err
+	}
+
+	return issueIDs, tx.Commit()
+}
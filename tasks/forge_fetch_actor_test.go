@@ -0,0 +1,46 @@
+package tasks
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+func TestUnresolvedAuthorID(t *testing.T) {
+	// A new issue whose hook was triggered by user 7, its author is user 8
+	body := []byte(`{
+		"object_kind": "issue",
+		"user": {"id": 7, "username": "maintainer"},
+		"project": {"path_with_namespace": "octo/hello", "web_url": "https://gitlab.com/octo/hello"},
+		"object_attributes": {"id": 301, "iid": 12, "title": "Crash", "state": "opened", "action": "update",
+			"author_id": 8, "created_at": "2024-03-01T10:00:00Z", "updated_at": "2024-03-01T10:00:00Z"}
+	}`)
+
+	event, err := forge.Gitlab{}.IssueEvent("Issue Hook", body)
+
+	if err != nil {
+		t.Fatalf("IssueEvent() error = %v", err)
+	}
+
+	// As upsertGithubIssue stores it when there's no actor to fill it from
+	author, _ := json.Marshal(event.Issue.User)
+	issue := models.Issues{Provider: forge.ProviderGitlab, Host: "gitlab.com", Author: author}
+
+	if id, ok := unresolvedAuthorID(issue); !ok || id != 8 {
+		t.Errorf("unresolvedAuthorID() = %d, %v, want 8, true", id, ok)
+	}
+
+	issue.Author = []byte(`{"id": 8, "login": "author"}`)
+
+	if _, ok := unresolvedAuthorID(issue); ok {
+		t.Error("unresolvedAuthorID() of an author with a login is unresolved")
+	}
+
+	issue.Author = []byte(`{}`)
+
+	if _, ok := unresolvedAuthorID(issue); ok {
+		t.Error("unresolvedAuthorID() of an author without an id is unresolved")
+	}
+}
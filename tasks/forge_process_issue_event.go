@@ -0,0 +1,60 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ForgeProcessIssueEvent = "forge:issue-event"
+)
+
+// HandleForgeProcessIssueEvent processes issue webhooks from GitLab and Gitea,
+// the adapter named by the delivery turns them into the same issue event the
+// github issue update task applies.
+func HandleForgeProcessIssueEvent(ctx context.Context, t *asynq.Task, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client) error {
+	slog.Info("🏃 Starting processing forge issue event")
+
+	var payload WebhookDeliveryPayload
+
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		slog.Error("❌ Could not process forge payload",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	adapter, ok := forge.Adapters[payload.Provider]
+
+	if !ok {
+		slog.Error("❌ Unknown forge provider",
+			slog.String("provider", payload.Provider),
+			slog.String("delivery", payload.DeliveryID))
+
+		return fmt.Errorf("unknown forge provider %q: %w", payload.Provider, asynq.SkipRetry)
+	}
+
+	return handleWebhookDelivery(ctx, t, db, func(body []byte, delivery webhookDelivery) error {
+		webhook, err := adapter.IssueEvent(payload.Event, body)
+
+		if err != nil {
+			slog.Error("❌ Could not process forge webhook",
+				slog.String("provider", payload.Provider),
+				slog.String("event", payload.Event),
+				slog.String("error", err.Error()))
+
+			return fmt.Errorf("%s issue event: %v: %w", payload.Provider, err, asynq.SkipRetry)
+		}
+
+		delivery.scope(webhook.Repo)
+
+		return processIssueEvent(ctx, db, rdb, queue, webhook)
+	})
+}
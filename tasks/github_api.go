@@ -0,0 +1,83 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/github"
+)
+
+// RetryDelay waits out GitHub rate limits, everything else uses asynq's
+// backoff.
+func RetryDelay(n int, err error, t *asynq.Task) time.Duration {
+	var limited *github.RateLimitedError
+
+	if errors.As(err, &limited) {
+		if wait := time.Until(limited.Until); wait > 0 {
+			return wait
+		}
+
+		return time.Second
+	}
+
+	return asynq.DefaultRetryDelayFunc(n, err, t)
+}
+
+// fetchGithubPage GETs a page of the API. Missing repositories and bad tokens
+// won't fix themselves, so those errors skip the retries.
+func fetchGithubPage(ctx context.Context, gh *github.Client, pageURL string) (*github.Response, error) {
+	return skipPermanentGithubErrors(gh.Get(ctx, pageURL))
+}
+
+// fetchGithubPageConditional is fetchGithubPage revalidating the copy from
+// the last time, see github.Client.GetConditional.
+func fetchGithubPageConditional(ctx context.Context, gh *github.Client, pageURL string) (*github.Response, error) {
+	return skipPermanentGithubErrors(gh.GetConditional(ctx, pageURL))
+}
+
+func skipPermanentGithubErrors(resp *github.Response, err error) (*github.Response, error) {
+	var statusErr *github.StatusError
+
+	if errors.As(err, &statusErr) && !statusErr.Temporary() {
+		return nil, fmt.Errorf("%w: %w", err, asynq.SkipRetry)
+	}
+
+	return resp, err
+}
+
+// checkGithubHost refuses work on a host the client isn't configured for,
+// asking api.github.com about an Enterprise repository would find another
+// repository or none.
+func checkGithubHost(gh *github.Client, host string) error {
+	if host != gh.Host() {
+		return fmt.Errorf("github client is configured for %s, not %s: %w", gh.Host(), host, asynq.SkipRetry)
+	}
+
+	return nil
+}
+
+// fetchGithubRepository loads the repository, its payload carries the owner
+// and name with their real case.
+func fetchGithubRepository(ctx context.Context, gh *github.Client, host string, owner string, name string) (*forge.Repository, error) {
+	resp, err := fetchGithubPage(ctx, gh, github.RepoPath(owner, name))
+
+	if err != nil {
+		return nil, err
+	}
+
+	repo := forge.Repository{}
+
+	if err := json.Unmarshal(resp.Body, &repo); err != nil {
+		return nil, fmt.Errorf("github repository json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	repo.Provider = forge.ProviderGithub
+	repo.Host = host
+
+	return &repo, nil
+}
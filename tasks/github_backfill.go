@@ -0,0 +1,336 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/github"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	GithubBackfill = "github:backfill"
+
+	BackfillQueued    = "queued"
+	BackfillRunning   = "running"
+	BackfillCompleted = "completed"
+	BackfillFailed    = "failed"
+
+	backfillPerPage = 100
+)
+
+type GithubBackfillPayload struct {
+	Host      string
+	RepoOwner string
+	RepoName  string
+}
+
+func NewGithubBackfill(Host string, RepoOwner string, RepoName string) (*asynq.Task, error) {
+	payload, err := json.Marshal(GithubBackfillPayload{
+		Host:      Host,
+		RepoOwner: RepoOwner,
+		RepoName:  RepoName,
+	})
+
+	if err != nil {
+		slog.Error("Unable to schedule backfill of repo",
+			slog.String("error", err.Error()))
+
+		return nil, err
+	}
+
+	// Rate limit waits are retries too, so allow plenty of them
+	return asynq.NewTask(GithubBackfill, payload, asynq.MaxRetry(50)), nil
+}
+
+// EnqueueGithubBackfill queues a backfill's task. The task ID is the
+// backfill's, so triggering it again while the task is queued or running does
+// nothing, and the archived task of a failed run is deleted to make way for
+// the new one.
+func EnqueueGithubBackfill(ctx context.Context, queue *asynq.Client, inspector *asynq.Inspector, backfill models.Backfills) error {
+	task, err := NewGithubBackfill(backfill.Host, backfill.RepoOwner, backfill.RepoName)
+
+	if err != nil {
+		return err
+	}
+
+	taskID := fmt.Sprintf("backfill-%d", backfill.ID)
+	opts := []asynq.Option{asynq.TaskID(taskID), asynq.Queue("low"), asynq.Timeout(6 * time.Hour)}
+
+	_, err = queue.EnqueueContext(ctx, task, opts...)
+
+	if !errors.Is(err, asynq.ErrTaskIDConflict) {
+		return err
+	}
+
+	info, err := inspector.GetTaskInfo("low", taskID)
+
+	if err != nil && !errors.Is(err, asynq.ErrTaskNotFound) {
+		return err
+	}
+
+	if err == nil {
+		if info.State != asynq.TaskStateArchived && info.State != asynq.TaskStateCompleted {
+			slog.Info("💡 Backfill is already queued",
+				slog.Uint64("backfill_id", backfill.ID),
+				slog.String("state", info.State.String()))
+
+			return nil
+		}
+
+		if err := inspector.DeleteTask("low", taskID); err != nil && !errors.Is(err, asynq.ErrTaskNotFound) {
+			return err
+		}
+	}
+
+	_, err = queue.EnqueueContext(ctx, task, opts...)
+
+	return err
+}
+
+// HandleGithubBackfill pages through every issue of a repository and applies
+// them like issue webhooks, reindexing and notifying once per page. Each
+// finished page is checkpointed in backfills, so a retry resumes where the
+// last attempt stopped.
+func HandleGithubBackfill(ctx context.Context, t *asynq.Task, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, gh *github.Client) error {
+	slog.Info("🏃 Starting github backfill")
+
+	var p GithubBackfillPayload
+
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		slog.Error("❌ Could not process github backfill payload",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	backfill := models.Backfills{}
+
+	err := db.GetContext(ctx, &backfill, `
+	UPDATE backfills
+	SET status=$1, started_at=COALESCE(started_at, now()), updated_at=now()
+	WHERE provider=$2 AND host=$3 AND repo_owner=$4 AND repo_name=$5 AND status IN ($6, $1)
+	RETURNING *
+	`, BackfillRunning, forge.ProviderGithub, p.Host, p.RepoOwner, p.RepoName, BackfillQueued)
+
+	if err == sql.ErrNoRows {
+		slog.Info("💡 No backfill waiting for repo, nothing to do",
+			slog.String("owner", p.RepoOwner),
+			slog.String("name", p.RepoName))
+
+		return nil
+	} else if err != nil {
+		slog.Error("❌ Couldn't start backfill, will retry 💀",
+			slog.String("owner", p.RepoOwner),
+			slog.String("name", p.RepoName),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	err = runGithubBackfill(ctx, db, rdb, queue, gh, backfill)
+
+	if err != nil {
+		var limited *github.RateLimitedError
+
+		if errors.As(err, &limited) {
+			recordBackfillRateLimit(ctx, db, backfill.ID, limited.Until)
+		}
+
+		recordBackfillError(ctx, db, backfill.ID, err)
+
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+	UPDATE backfills
+	SET status=$1, finished_at=now(), updated_at=now(), next_page_url=NULL, rate_limited_until=NULL, last_error=NULL
+	WHERE id=$2
+	`, BackfillCompleted, backfill.ID)
+
+	if err != nil {
+		slog.Error("❌ Couldn't complete backfill, will retry 💀",
+			slog.Uint64("backfill_id", backfill.ID),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	slog.Info("✅ Completed github backfill",
+		slog.String("owner", p.RepoOwner),
+		slog.String("name", p.RepoName))
+
+	return nil
+}
+
+func runGithubBackfill(ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, gh *github.Client, backfill models.Backfills) error {
+	if err := checkGithubHost(gh, backfill.Host); err != nil {
+		return err
+	}
+
+	repo, err := fetchGithubRepository(ctx, gh, backfill.Host, backfill.RepoOwner, backfill.RepoName)
+
+	if err != nil {
+		return err
+	}
+
+	pageURL := backfill.NextPageURL.String
+
+	if pageURL == "" {
+		// Oldest first, so issues opened during the backfill land on later pages
+		pageURL = fmt.Sprintf("%s/issues?state=all&sort=created&direction=asc&per_page=%d", github.RepoPath(backfill.RepoOwner, backfill.RepoName), backfillPerPage)
+	}
+
+	return walkGithubBackfill(ctx, gh, pageURL, func(page backfillPage) error {
+		issueIDs := []uint64{}
+
+		repo.ActorsSeenAt = page.FetchedAt
+
+		for i := range page.Issues {
+			issue, err := applyIssueUpdate(ctx, db, rdb, repo, &page.Issues[i], nil)
+
+			if errors.Is(err, errStaleIssueUpdate) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			if !issue.DeletedAt.Valid {
+				issueIDs = append(issueIDs, issue.ID)
+			}
+		}
+
+		// One reindex and one broadcast for the page rather than each issue
+		if len(issueIDs) > 0 {
+			enqueueReindexIssues(queue, issueIDs)
+
+			broadcastRepoMessage(repo.Provider, repo.Host, repo.Owner.Login, repo.Name, fiber.Map{
+				"updated_at": time.Now().Format(time.RFC3339),
+			})
+		}
+
+		progress := models.Backfills{}
+
+		err := db.GetContext(ctx, &progress, `
+		UPDATE backfills
+		SET next_page_url=$1, pages=pages+1, issues_seen=issues_seen+$2, pull_requests_skipped=pull_requests_skipped+$3,
+			rate_limited_until=NULL, last_error=NULL, updated_at=now()
+		WHERE id=$4
+		RETURNING *
+		`, sql.NullString{String: page.NextURL, Valid: page.NextURL != ""}, uint64(len(page.Issues)), page.PullRequestsSkipped, backfill.ID)
+
+		if err != nil {
+			slog.Error("❌ Couldn't checkpoint backfill, will retry 💀",
+				slog.Uint64("backfill_id", backfill.ID),
+				slog.String("error", err.Error()))
+
+			return err
+		}
+
+		slog.Info("💡 Backfilled github issues page",
+			slog.String("owner", repo.Owner.Login),
+			slog.String("name", repo.Name),
+			slog.Uint64("pages", progress.Pages),
+			slog.Uint64("issues_seen", progress.IssuesSeen),
+			slog.Uint64("pull_requests_skipped", progress.PullRequestsSkipped))
+
+		return nil
+	})
+}
+
+// backfillPage is a page of issues, without the pull requests the issues
+// endpoint also lists.
+type backfillPage struct {
+	Issues              []forge.Issue
+	PullRequestsSkipped uint64
+	NextURL             string
+	// When the page was asked for, its user profiles are at least as new
+	FetchedAt time.Time
+}
+
+// walkGithubBackfill fetches the issue pages from pageURL on and hands each
+// to apply, which checkpoints NextURL, before fetching the next.
+func walkGithubBackfill(ctx context.Context, gh *github.Client, pageURL string, apply func(page backfillPage) error) error {
+	for pageURL != "" {
+		fetchedAt := time.Now()
+
+		resp, err := fetchGithubPage(ctx, gh, pageURL)
+
+		if err != nil {
+			return err
+		}
+
+		issues := []forge.Issue{}
+
+		if err := json.Unmarshal(resp.Body, &issues); err != nil {
+			return fmt.Errorf("github issues json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+		}
+
+		page := backfillPage{
+			Issues:    []forge.Issue{},
+			NextURL:   github.NextPage(resp.Header),
+			FetchedAt: fetchedAt,
+		}
+
+		for _, issue := range issues {
+			if issue.PullRequest != nil {
+				page.PullRequestsSkipped++
+
+				continue
+			}
+
+			page.Issues = append(page.Issues, issue)
+		}
+
+		if err := apply(page); err != nil {
+			return err
+		}
+
+		pageURL = page.NextURL
+	}
+
+	return nil
+}
+
+func recordBackfillRateLimit(ctx context.Context, db *sqlx.DB, backfillID uint64, until time.Time) {
+	_, err := db.ExecContext(ctx, "UPDATE backfills SET rate_limited_until=$1, updated_at=now() WHERE id=$2", until, backfillID)
+
+	if err != nil {
+		slog.Warn("💀 Could not record backfill rate limit",
+			slog.Uint64("backfill_id", backfillID),
+			slog.String("error", err.Error()))
+	}
+}
+
+func recordBackfillError(ctx context.Context, db *sqlx.DB, backfillID uint64, backfillErr error) {
+	status := BackfillRunning
+
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+
+	if errors.Is(backfillErr, asynq.SkipRetry) || retried >= maxRetry {
+		status = BackfillFailed
+	}
+
+	_, err := db.ExecContext(ctx, `
+	UPDATE backfills
+	SET status=$1, last_error=$2, updated_at=now()
+	WHERE id=$3
+	`, status, backfillErr.Error(), backfillID)
+
+	if err != nil {
+		slog.Warn("💀 Could not record backfill error",
+			slog.Uint64("backfill_id", backfillID),
+			slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,143 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/github"
+	"github.com/macwilko/issues-sync/github/githubtest"
+)
+
+func newStandInGithub(t *testing.T) (*githubtest.Server, *github.Client) {
+	standIn := githubtest.New(t)
+
+	return standIn, github.New(github.Config{BaseURL: standIn.URL, MaxWait: time.Second})
+}
+
+func walkAll(ctx context.Context, gh *github.Client, pageURL string) ([]backfillPage, error) {
+	pages := []backfillPage{}
+
+	err := walkGithubBackfill(ctx, gh, pageURL, func(page backfillPage) error {
+		pages = append(pages, page)
+
+		return nil
+	})
+
+	return pages, err
+}
+
+func TestWalkGithubBackfill(t *testing.T) {
+	_, gh := newStandInGithub(t)
+
+	pages, err := walkAll(context.Background(), gh, "/repos/octo/hello/issues")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages, want 2", len(pages))
+	}
+
+	if len(pages[0].Issues) != 1 || pages[0].Issues[0].Number != 1 || pages[0].PullRequestsSkipped != 1 {
+		t.Errorf("first page = %+v, want issue 1 and a skipped pull request", pages[0])
+	}
+
+	if pages[0].NextURL == "" {
+		t.Error("first page has no next URL to checkpoint")
+	}
+
+	if len(pages[1].Issues) != 1 || pages[1].Issues[0].Number != 3 || pages[1].NextURL != "" {
+		t.Errorf("second page = %+v, want issue 3 and no next URL", pages[1])
+	}
+}
+
+func TestWalkGithubBackfillResumesFromCheckpoint(t *testing.T) {
+	standIn, gh := newStandInGithub(t)
+
+	first, err := walkAll(context.Background(), gh, "/repos/octo/hello/issues")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := len(standIn.Requests())
+
+	pages, err := walkAll(context.Background(), gh, first[0].NextURL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pages) != 1 || pages[0].Issues[0].Number != 3 {
+		t.Fatalf("resumed pages = %+v, want only the second page", pages)
+	}
+
+	if requests := standIn.Requests()[seen:]; len(requests) != 1 || requests[0].URI != "/repos/octo/hello/issues?page=2" {
+		t.Errorf("requests = %+v, want only the checkpointed page", requests)
+	}
+}
+
+func TestWalkGithubBackfillRateLimited(t *testing.T) {
+	standIn, gh := newStandInGithub(t)
+	standIn.LimitIssuePages()
+
+	pages, err := walkAll(context.Background(), gh, "/repos/octo/hello/issues")
+
+	var limited *github.RateLimitedError
+
+	if !errors.As(err, &limited) {
+		t.Fatalf("err = %v, want a RateLimitedError", err)
+	}
+
+	if time.Until(limited.Until) < 30*time.Minute {
+		t.Errorf("limited until %s, want the X-RateLimit-Reset", limited.Until)
+	}
+
+	// The first page was applied, so a retry resumes from the second
+	if len(pages) != 1 || pages[0].NextURL == "" {
+		t.Errorf("pages = %+v, want the first page checkpointed", pages)
+	}
+
+	if errors.Is(err, asynq.SkipRetry) {
+		t.Error("a rate limit skips the retries")
+	}
+}
+
+func TestFetchGithubRepository(t *testing.T) {
+	_, gh := newStandInGithub(t)
+
+	repo, err := fetchGithubRepository(context.Background(), gh, "github.com", "octo", "hello")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if repo.Owner.Login != "Octo" || repo.Name != "Hello" || repo.Provider != forge.ProviderGithub || repo.Host != "github.com" {
+		t.Errorf("repo = %+v, want Octo/Hello on github.com", repo)
+	}
+
+	_, err = fetchGithubRepository(context.Background(), gh, "github.com", "octo", "missing")
+
+	if !errors.Is(err, asynq.SkipRetry) {
+		t.Errorf("err = %v, want a missing repository to skip the retries", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if delay := RetryDelay(1, &github.RateLimitedError{Until: time.Now().Add(time.Hour)}, nil); delay < 59*time.Minute {
+		t.Errorf("RetryDelay() = %s, want the wait until the rate limit resets", delay)
+	}
+
+	if delay := RetryDelay(1, &github.RateLimitedError{Until: time.Now().Add(-time.Minute)}, nil); delay != time.Second {
+		t.Errorf("RetryDelay() of a reset limit = %s, want 1s", delay)
+	}
+
+	if delay := RetryDelay(1, errors.New("boom"), nil); delay <= 0 {
+		t.Errorf("RetryDelay() = %s, want asynq's backoff", delay)
+	}
+}
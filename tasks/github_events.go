@@ -0,0 +1,119 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+var ErrUnhandledGithubEvent = errors.New("github event is not handled")
+
+type GithubEvent struct {
+	TaskType string
+	Queue    string
+}
+
+// GithubEvents maps the X-GitHub-Event header to the task that processes it.
+// Handling a new event means adding it here and registering its task type on
+// the worker mux.
+var GithubEvents = map[string]GithubEvent{
+	"issues":        {TaskType: GithubProcessIssueUpdate, Queue: "critical"},
+	"issue_comment": {TaskType: GithubProcessIssueComment, Queue: "critical"},
+	"label":         {TaskType: GithubProcessLabel, Queue: "default"},
+	"milestone":     {TaskType: GithubProcessMilestone, Queue: "default"},
+}
+
+// forgeIssueEvent processes issue webhooks from every other forge, the
+// adapter decides which of its events are issue events.
+var forgeIssueEvent = GithubEvent{TaskType: ForgeProcessIssueEvent, Queue: "critical"}
+
+// WebhookEvent looks up the task that processes a provider's webhook event.
+func WebhookEvent(provider string, event string) (GithubEvent, bool) {
+	if provider == "" || provider == forge.ProviderGithub {
+		githubEvent, ok := GithubEvents[event]
+
+		return githubEvent, ok
+	}
+
+	adapter, ok := forge.Adapters[provider]
+
+	if !ok || !adapter.IsIssueEvent(event) {
+		return GithubEvent{}, false
+	}
+
+	return forgeIssueEvent, true
+}
+
+type WebhookDeliveryPayload struct {
+	DeliveryID string
+	Provider   string
+	Event      string
+}
+
+func NewWebhookDelivery(provider string, event string, DeliveryID string) (*asynq.Task, GithubEvent, error) {
+	githubEvent, ok := WebhookEvent(provider, event)
+
+	if !ok {
+		return nil, githubEvent, fmt.Errorf("%s %s: %w", provider, event, ErrUnhandledGithubEvent)
+	}
+
+	payload, err := json.Marshal(WebhookDeliveryPayload{
+		DeliveryID: DeliveryID,
+		Provider:   provider,
+		Event:      event,
+	})
+
+	if err != nil {
+		slog.Error("Unable to schedule webhook delivery on queue",
+			slog.String("error", err.Error()))
+
+		return nil, githubEvent, err
+	}
+
+	return asynq.NewTask(githubEvent.TaskType, payload, asynq.MaxRetry(5)), githubEvent, nil
+}
+
+// handleWebhookDelivery loads the stored delivery a task points at, runs
+// process over its body and records the outcome on the delivery.
+func handleWebhookDelivery(ctx context.Context, t *asynq.Task, db *sqlx.DB, process func(body []byte, delivery webhookDelivery) error) error {
+	var payload WebhookDeliveryPayload
+
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		slog.Error("❌ Could not process github payload",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	delivery, err := loadWebhookDelivery(ctx, db, payload.DeliveryID)
+
+	if err == sql.ErrNoRows {
+		slog.Error("❌ Webhook delivery doesn't exist",
+			slog.String("delivery", payload.DeliveryID))
+
+		return fmt.Errorf("webhook delivery %s not found: %w", payload.DeliveryID, asynq.SkipRetry)
+	} else if err != nil {
+		slog.Error("❌ Couldn't load webhook delivery, will retry 💀",
+			slog.String("delivery", payload.DeliveryID),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	// A replay runs under a task ID of its own, see EnqueueWebhookDelivery
+	taskID, _ := asynq.GetTaskID(ctx)
+	delivery.Replay = taskID != payload.DeliveryID
+
+	err = process(delivery.Payload, delivery)
+
+	finishWebhookDelivery(ctx, db, payload.DeliveryID, err)
+
+	return err
+}
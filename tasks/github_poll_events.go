@@ -0,0 +1,315 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/github"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	GithubSchedulePolls = "github:schedule-polls"
+	GithubPollEvents    = "github:poll-events"
+
+	// GitHub asks for at least this much between polls through X-Poll-Interval
+	defaultPollInterval = 60 * time.Second
+)
+
+func NewSchedulePolls() *asynq.Task {
+	return asynq.NewTask(GithubSchedulePolls, nil)
+}
+
+type GithubPollEventsPayload struct {
+	Host      string
+	RepoOwner string
+	RepoName  string
+}
+
+func NewGithubPollEvents(Host string, RepoOwner string, RepoName string) (*asynq.Task, error) {
+	payload, err := json.Marshal(GithubPollEventsPayload{
+		Host:      Host,
+		RepoOwner: RepoOwner,
+		RepoName:  RepoName,
+	})
+
+	if err != nil {
+		slog.Error("Unable to schedule polling of repo",
+			slog.String("error", err.Error()))
+
+		return nil, err
+	}
+
+	// The next scheduled poll picks up where a failed one stopped
+	return asynq.NewTask(GithubPollEvents, payload, asynq.MaxRetry(1)), nil
+}
+
+// githubRepoEvent is an entry of the repository events feed.
+type githubRepoEvent struct {
+	ID    string                 `json:"id"`
+	Type  string                 `json:"type"`
+	Actor map[string]interface{} `json:"actor"`
+	Repo  struct {
+		Name string `json:"name"`
+	} `json:"repo"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// HandleSchedulePolls enqueues a poll for every repository in poll mode
+// whose poll interval has passed.
+func HandleSchedulePolls(ctx context.Context, t *asynq.Task, db *sqlx.DB, queue *asynq.Client) error {
+	repos := []models.Repositories{}
+
+	err := db.SelectContext(ctx, &repos, `
+	SELECT host, repo_owner, repo_name FROM repositories
+	WHERE provider=$1 AND ingestion_mode=$2 AND (next_poll_at IS NULL OR next_poll_at <= now())
+	`, forge.ProviderGithub, models.IngestionModePoll)
+
+	if err != nil {
+		slog.Error("❌ Couldn't list repositories to poll, will retry 💀",
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	for _, repo := range repos {
+		task, err := NewGithubPollEvents(repo.Host, repo.RepoOwner, repo.RepoName)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = queue.Enqueue(task, asynq.Unique(time.Minute), asynq.Queue("default"))
+
+		if err != nil && !errors.Is(err, asynq.ErrDuplicateTask) {
+			slog.Error("💀 Couldn't enqueue repository poll, will retry",
+				slog.String("owner", repo.RepoOwner),
+				slog.String("name", repo.RepoName),
+				slog.String("error", err.Error()))
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HandleGithubPollEvents reads a repository's events feed for repositories we
+// can't install a webhook on. Issue and issue comment events go through the
+// same processing as their webhooks, last_event_id is the cursor. The first
+// page is revalidated with its ETag, so unchanged polls are free.
+func HandleGithubPollEvents(ctx context.Context, t *asynq.Task, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, gh *github.Client) error {
+	var p GithubPollEventsPayload
+
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		slog.Error("❌ Could not process github poll payload",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	repository := models.Repositories{}
+
+	err := db.GetContext(ctx, &repository, `
+	SELECT * FROM repositories
+	WHERE provider=$1 AND host=$2 AND repo_owner=$3 AND repo_name=$4 AND ingestion_mode=$5
+	`, forge.ProviderGithub, p.Host, p.RepoOwner, p.RepoName, models.IngestionModePoll)
+
+	if err == sql.ErrNoRows {
+		slog.Info("💡 Repository isn't polled anymore, nothing to do",
+			slog.String("owner", p.RepoOwner),
+			slog.String("name", p.RepoName))
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	slog.Info("🏃 Starting polling github events",
+		slog.String("owner", p.RepoOwner),
+		slog.String("name", p.RepoName),
+		slog.Uint64("last_event_id", repository.LastEventID))
+
+	lastEventID, interval, pollErr := pollGithubEvents(ctx, db, rdb, queue, gh, repository)
+
+	_, err = db.ExecContext(ctx, `
+	UPDATE repositories
+	SET last_event_id=$1, poll_interval_seconds=$2, last_polled_at=now(), next_poll_at=now() + make_interval(secs => $2),
+		last_error=$3, updated_at=now()
+	WHERE id=$4
+	`, lastEventID, int64(interval.Seconds()), errorString(pollErr), repository.ID)
+
+	if err != nil {
+		slog.Error("❌ Couldn't save poll cursor, will retry 💀",
+			slog.Uint64("repository_id", repository.ID),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	if pollErr != nil {
+		return pollErr
+	}
+
+	slog.Info("✅ Completed polling github events",
+		slog.String("owner", p.RepoOwner),
+		slog.String("name", p.RepoName),
+		slog.Uint64("last_event_id", lastEventID))
+
+	return nil
+}
+
+// pollGithubEvents applies the events newer than the repository's cursor,
+// oldest first, and returns how far it got along with the poll interval
+// GitHub asked for.
+func pollGithubEvents(ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, gh *github.Client, repository models.Repositories) (uint64, time.Duration, error) {
+	lastEventID := repository.LastEventID
+	interval := time.Duration(repository.PollIntervalSeconds) * time.Second
+
+	if err := checkGithubHost(gh, repository.Host); err != nil {
+		return lastEventID, interval, err
+	}
+
+	pageURL := fmt.Sprintf("%s/events?per_page=100", github.RepoPath(repository.RepoOwner, repository.RepoName))
+
+	resp, err := fetchGithubPageConditional(ctx, gh, pageURL)
+
+	if err != nil {
+		return lastEventID, interval, err
+	}
+
+	interval = githubPollInterval(resp.Header)
+
+	// The feed is newest first, read back until the cursor. A 304 comes with
+	// the page we saw last time, which still has events past the cursor when
+	// the last poll failed partway through.
+	pending := []githubRepoEvent{}
+
+	for {
+		events := []githubRepoEvent{}
+
+		if err := json.Unmarshal(resp.Body, &events); err != nil {
+			return lastEventID, interval, fmt.Errorf("github events json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+		}
+
+		reachedCursor := false
+
+		for _, event := range events {
+			if githubEventID(event) <= repository.LastEventID {
+				reachedCursor = true
+
+				break
+			}
+
+			pending = append(pending, event)
+		}
+
+		pageURL = github.NextPage(resp.Header)
+
+		if reachedCursor || pageURL == "" {
+			break
+		}
+
+		resp, err = fetchGithubPage(ctx, gh, pageURL)
+
+		if err != nil {
+			return lastEventID, interval, err
+		}
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		err := processGithubRepoEvent(ctx, db, rdb, queue, repository, pending[i])
+
+		if errors.Is(err, asynq.SkipRetry) {
+			slog.Warn("❌ Skipping github event that can't be processed",
+				slog.String("event_id", pending[i].ID),
+				slog.String("type", pending[i].Type),
+				slog.String("error", err.Error()))
+		} else if err != nil {
+			return lastEventID, interval, err
+		}
+
+		lastEventID = githubEventID(pending[i])
+	}
+
+	return lastEventID, interval, nil
+}
+
+// processGithubRepoEvent turns a feed entry into the webhook it stands for.
+func processGithubRepoEvent(ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, repository models.Repositories, event githubRepoEvent) error {
+	owner, name, _ := strings.Cut(event.Repo.Name, "/")
+
+	repo := &forge.Repository{
+		Provider: forge.ProviderGithub,
+		Host:     repository.Host,
+		Name:     name,
+		Owner:    forge.RepositoryOwner{Login: owner},
+		HTMLURL:  fmt.Sprintf("https://%s/%s", repository.Host, event.Repo.Name),
+		// The event's user profiles are as they were when it happened
+		ActorsSeenAt: event.CreatedAt,
+	}
+
+	switch event.Type {
+	case "IssuesEvent":
+		webhook := forge.IssueEvent{}
+
+		if err := json.Unmarshal(event.Payload, &webhook); err != nil {
+			return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+		}
+
+		webhook.Repo = repo
+		webhook.Sender = event.Actor
+
+		return processIssueEvent(ctx, db, rdb, queue, &webhook)
+	case "IssueCommentEvent":
+		webhook := GitHubWebhookCommentPayload{}
+
+		if err := json.Unmarshal(event.Payload, &webhook); err != nil {
+			return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+		}
+
+		webhook.Repo = repo
+		webhook.Sender = event.Actor
+
+		return processIssueCommentEvent(ctx, db, rdb, queue, &webhook)
+	}
+
+	return nil
+}
+
+func githubEventID(event githubRepoEvent) uint64 {
+	id, _ := strconv.ParseUint(event.ID, 10, 64)
+
+	return id
+}
+
+func githubPollInterval(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("X-Poll-Interval"))
+
+	if err != nil || seconds <= 0 {
+		return defaultPollInterval
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func errorString(err error) sql.NullString {
+	if err == nil {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: err.Error(), Valid: true}
+}
@@ -0,0 +1,162 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	GithubProcessIssueComment = "github:issue-comment"
+)
+
+type GitHubWebhookCommentPayload struct {
+	Action  string                 `json:"action"`
+	Issue   *forge.Issue           `json:"issue"`
+	Comment *GitHubWebhookComment  `json:"comment"`
+	Repo    *forge.Repository      `json:"repository"`
+	Sender  map[string]interface{} `json:"sender"`
+}
+
+type GitHubWebhookComment struct {
+	ID                uint64                 `json:"id"`
+	CreatedAt         string                 `json:"created_at"`
+	UpdatedAt         *string                `json:"updated_at"`
+	Body              string                 `json:"body"`
+	HTMLURL           string                 `json:"html_url"`
+	AuthorAssociation string                 `json:"author_association"`
+	User              map[string]interface{} `json:"user"`
+	Reactions         map[string]interface{} `json:"reactions"`
+}
+
+func HandleGithubProcessIssueComment(ctx context.Context, t *asynq.Task, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client) error {
+	slog.Info("🏃 Starting processing github issue comment")
+
+	return handleWebhookDelivery(ctx, t, db, func(body []byte, delivery webhookDelivery) error {
+		return processGithubIssueCommentWebhook(ctx, db, rdb, queue, body, delivery)
+	})
+}
+
+func processGithubIssueCommentWebhook(ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, body []byte, delivery webhookDelivery) error {
+	var webhook GitHubWebhookCommentPayload
+
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		slog.Error("❌ Could not process github webhook",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	delivery.scope(webhook.Repo)
+
+	return processIssueCommentEvent(ctx, db, rdb, queue, &webhook)
+}
+
+// processIssueCommentEvent applies an issue comment event, whether it was
+// delivered by webhook or read from the events feed.
+func processIssueCommentEvent(ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, webhook *GitHubWebhookCommentPayload) error {
+	if webhook.Issue == nil || webhook.Comment == nil || webhook.Repo == nil {
+		slog.Info("❌ Aborting, not a valid comment webhook event",
+			slog.Any("info", webhook))
+
+		return fmt.Errorf("not a valid comment webhook event: %w", asynq.SkipRetry)
+	}
+
+	if webhook.Issue.PullRequest != nil {
+		slog.Info("💡 Skipping pull request comment",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login))
+
+		return nil
+	}
+
+	slog.Info("💡 Starting processing of comment webhook info",
+		slog.String("action", webhook.Action),
+		slog.String("name", webhook.Repo.Name),
+		slog.String("owner", webhook.Repo.Owner.Login))
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		ReadOnly: false,
+	})
+
+	if err != nil {
+		slog.Error("❌ Couldn't get tx, db error, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	// The payload carries the parent issue, keep its comment count current
+	issue, err := upsertGithubIssue(ctx, tx, webhook.Repo, webhook.Issue, webhook.Sender)
+
+	if errors.Is(err, errStaleIssueUpdate) {
+		metrics.Incr(ctx, rdb, metrics.IssueStaleUpdateSkipped)
+	} else if err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	commentID, err := upsertGithubComment(ctx, tx, webhook.Repo, webhook.Issue.ID, webhook.Comment, webhook.Action == "deleted")
+
+	if errors.Is(err, errStaleCommentUpdate) {
+		tx.Rollback()
+
+		metrics.Incr(ctx, rdb, metrics.CommentStaleUpdateSkipped)
+
+		return nil
+	} else if err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	if err := upsertGithubSender(ctx, tx, webhook.Repo, webhook.Sender); err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		slog.Error("❌ Couldn't store comment, commit db error, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	if issue.DeletedAt.Valid {
+		return nil
+	}
+
+	enqueueReindexIssue(queue, issue.ID)
+
+	broadcastRepoMessage(webhook.Repo.Provider, webhook.Repo.Host, webhook.Repo.Owner.Login, webhook.Repo.Name, fiber.Map{
+		"updated_at":   time.Now().Format(time.RFC3339),
+		"action":       "comment_" + webhook.Action,
+		"issue_number": issue.IssueNumber,
+		"comment_id":   commentID,
+	})
+
+	slog.Info("✅ Completed processing github issue comment",
+		slog.String("name", webhook.Repo.Name),
+		slog.String("owner", webhook.Repo.Owner.Login))
+
+	return nil
+}
@@ -3,105 +3,160 @@ package tasks
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/hibiken/asynq"
-	"github.com/imroc/req/v3"
 	"github.com/jmoiron/sqlx"
 	"github.com/macwilko/issues-sync/db/models"
-	"github.com/macwilko/issues-sync/ws_handlers"
-	"github.com/meilisearch/meilisearch-go"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/metrics"
+	"github.com/redis/go-redis/v9"
 )
 
 const (
 	GithubProcessIssueUpdate = "github:issue-update"
 )
 
-type GithubProcessIssueUpdatePayload struct {
-	WebHookPayload []byte
-}
+func HandleGithubProcessIssueUpdate(ctx context.Context, t *asynq.Task, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client) error {
+	slog.Info("🏃 Starting processing github issue update")
 
-type GitHubWebhookPayload struct {
-	Action string              `json:"action"`
-	Issue  *GitHubWebhookIssue `json:"issue"`
-	Repo   *GitHubWebhookRepo  `json:"repository"`
+	return handleWebhookDelivery(ctx, t, db, func(body []byte, delivery webhookDelivery) error {
+		return processGithubIssueWebhook(ctx, db, rdb, queue, body, delivery)
+	})
 }
 
-type GitHubWebhookIssue struct {
-	ID        uint64                 `json:"id"`
-	CreatedAt string                 `json:"created_at"`
-	UpdatedAt *string                `json:"updated_at"`
-	Title     string                 `json:"title"`
-	Number    uint64                 `json:"number"`
-	Comments  uint64                 `json:"comments"`
-	State     string                 `json:"state"`
-	User      map[string]interface{} `json:"user"`
-	Labels    []interface{}          `json:"labels"`
-	Assignees []interface{}          `json:"assignees"`
-}
+func processGithubIssueWebhook(ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, body []byte, delivery webhookDelivery) error {
+	webhook, err := forge.Github{}.IssueEvent("issues", body)
+
+	if err != nil {
+		slog.Error("❌ Could not process github webhook",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	delivery.scope(webhook.Repo)
 
-type GitHubWebhookRepo struct {
-	Name  string                 `json:"name"`
-	Owner GitHubWebhookRepoOwner `json:"owner"`
+	return processIssueEvent(ctx, db, rdb, queue, webhook)
 }
 
-type GitHubWebhookRepoOwner struct {
-	Login string `json:"login"`
+// processIssueEvent applies a provider neutral issue event, whichever forge
+// it came from.
+func processIssueEvent(ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, webhook *forge.IssueEvent) error {
+	if webhook.Issue == nil || webhook.Repo == nil {
+		slog.Info("❌ Aborting, not a valid webhook event",
+			slog.Any("info", webhook))
+
+		return fmt.Errorf("not a valid webhook event: %w", asynq.SkipRetry)
+	}
+
+	slog.Info("💡 Starting processing of webhook info",
+		slog.String("action", webhook.Action),
+		slog.String("provider", webhook.Repo.Provider),
+		slog.String("host", webhook.Repo.Host),
+		slog.String("name", webhook.Repo.Name),
+		slog.String("owner", webhook.Repo.Owner.Login))
+
+	if webhook.Issue.Confidential {
+		return processIssueHidden(ctx, db, queue, webhook)
+	}
+
+	switch webhook.Action {
+	case "deleted":
+		return processGithubIssueDeleted(ctx, db, queue, webhook)
+	case "transferred":
+		if webhook.Changes != nil && webhook.Changes.NewIssue != nil && webhook.Changes.NewRepository != nil {
+			return processGithubIssueTransferred(ctx, db, rdb, queue, webhook)
+		}
+
+		slog.Warn("❌ Transferred event without new issue, treating as update",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login))
+	}
+
+	issue, err := applyIssueUpdate(ctx, db, rdb, webhook.Repo, webhook.Issue, webhook.Sender)
+
+	if errors.Is(err, errStaleIssueUpdate) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if issue.DeletedAt.Valid {
+		return nil
+	}
+
+	enqueueReindexIssue(queue, issue.ID)
+	enqueueFetchIssueAuthor(queue, issue)
+
+	broadcastRepoMessage(webhook.Repo.Provider, webhook.Repo.Host, webhook.Repo.Owner.Login, webhook.Repo.Name, fiber.Map{
+		"updated_at": time.Now().Format(time.RFC3339),
+	})
+
+	slog.Info("✅ Completed processing github issue",
+		slog.String("name", webhook.Repo.Name),
+		slog.String("owner", webhook.Repo.Owner.Login))
+
+	return nil
 }
 
-func NewGithubProcessIssueUpdate(WebHookPayload []byte) (*asynq.Task, error) {
-	payload, err := json.Marshal(GithubProcessIssueUpdatePayload{
-		WebHookPayload: WebHookPayload,
+// applyIssueUpdate stores an issue and its sender in one transaction. A payload
+// older than the stored row is counted and returned as errStaleIssueUpdate.
+func applyIssueUpdate(ctx context.Context, db *sqlx.DB, rdb *redis.Client, repo *forge.Repository, ghIssue *forge.Issue, sender map[string]interface{}) (models.Issues, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		ReadOnly: false,
 	})
 
 	if err != nil {
-		slog.Error("Unable to schedule issue update on queue",
+		slog.Error("❌ Couldn't get tx, db error, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
 			slog.String("error", err.Error()))
 
-		return nil, err
+		return models.Issues{}, err
 	}
 
-	return asynq.NewTask(GithubProcessIssueUpdate, payload, asynq.MaxRetry(5)), nil
-}
+	issue, err := upsertGithubIssue(ctx, tx, repo, ghIssue, sender)
 
-func HandleGithubProcessIssueUpdate(ctx context.Context, t *asynq.Task, db *sqlx.DB, meili *meilisearch.Client, queue *asynq.Client) error {
-	slog.Info("🏃 Starting processing github issue update")
+	if errors.Is(err, errStaleIssueUpdate) {
+		tx.Rollback()
 
-	var payload GithubProcessIssueUpdatePayload
+		metrics.Incr(ctx, rdb, metrics.IssueStaleUpdateSkipped)
 
-	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-		slog.Error("❌ Could not process github payload",
-			slog.String("error", err.Error()))
+		return issue, err
+	} else if err != nil {
+		tx.Rollback()
 
-		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+		return issue, err
 	}
 
-	var webhook GitHubWebhookPayload
-
-	if err := json.Unmarshal(payload.WebHookPayload, &webhook); err != nil {
-		slog.Error("❌ Could not process github webhook",
-			slog.String("error", err.Error()))
+	if err := upsertGithubSender(ctx, tx, repo, sender); err != nil {
+		tx.Rollback()
 
-		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+		return issue, err
 	}
 
-	if webhook.Issue == nil || webhook.Repo == nil {
-		slog.Info("❌ Aborting, not a valid webhook event",
-			slog.Any("info", webhook))
+	err = tx.Commit()
 
-		return fmt.Errorf("not a valid webhook event: %w", asynq.SkipRetry)
+	if err != nil {
+		slog.Error("❌ Couldn't add message, commit db error, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
 	}
 
-	slog.Info("💡 Starting processing of webhook info",
-		slog.String("name", webhook.Repo.Name),
-		slog.String("owner", webhook.Repo.Owner.Login))
+	return issue, nil
+}
 
+// processGithubIssueDeleted tombstones a stored issue, so a late update can't
+// bring it back, and removes it from search.
+func processGithubIssueDeleted(ctx context.Context, db *sqlx.DB, queue *asynq.Client, webhook *forge.IssueEvent) error {
 	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
 		ReadOnly: false,
 	})
@@ -115,12 +170,40 @@ func HandleGithubProcessIssueUpdate(ctx context.Context, t *asynq.Task, db *sqlx
 		return err
 	}
 
-	createdAt, err := time.Parse(time.RFC3339, webhook.Issue.CreatedAt)
+	if err := lockGithubIssue(ctx, tx, webhook.Repo, webhook.Issue.ID); err != nil {
+		tx.Rollback()
 
-	if err != nil {
+		slog.Error("❌ Couldn't lock issue, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	// Deleting is final, so it goes through even if the stored row looks newer.
+	// The payload isn't applied, and an issue we never saw is left alone, a
+	// tombstone for it could be one another repository's issue needs.
+	issue := models.Issues{}
+
+	err = tx.GetContext(ctx, &issue, "SELECT * FROM issues WHERE provider=$1 AND host=$2 AND github_id=$3 LIMIT 1 FOR UPDATE",
+		webhook.Repo.Provider,
+		webhook.Repo.Host,
+		webhook.Issue.ID)
+
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+
+		slog.Info("💡 Deleted issue was never stored, nothing to do",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.Uint64("github_id", webhook.Issue.ID))
+
+		return nil
+	} else if err != nil {
 		tx.Rollback()
 
-		slog.Error("❌ Couldn't parse created_at, will retry 💀",
+		slog.Error("❌ Database issue fetching issues, will retry 💀",
 			slog.String("name", webhook.Repo.Name),
 			slog.String("owner", webhook.Repo.Owner.Login),
 			slog.String("error", err.Error()))
@@ -128,31 +211,49 @@ func HandleGithubProcessIssueUpdate(ctx context.Context, t *asynq.Task, db *sqlx
 		return err
 	}
 
-	var updatedAt time.Time
+	if err := checkIssueRepository(issue, webhook.Repo); err != nil {
+		tx.Rollback()
 
-	if webhook.Issue.UpdatedAt != nil {
-		updatedAt, err = time.Parse(time.RFC3339, *webhook.Issue.UpdatedAt)
+		slog.Warn("💀 Refusing issue deletion verified by another repository's secret",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("issue_owner", issue.RepoOwner),
+			slog.String("issue_name", issue.RepoName),
+			slog.Uint64("issue_id", issue.ID))
 
-		if err != nil {
-			tx.Rollback()
+		return err
+	}
 
-			slog.Error("❌ Couldn't parse updated_at, will retry 💀",
-				slog.String("name", webhook.Repo.Name),
-				slog.String("owner", webhook.Repo.Owner.Login),
-				slog.String("error", err.Error()))
+	// A hidden confidential issue is only deleted for now
+	alreadyDeleted := issue.DeletedAt.Valid && !issue.ConfidentialSince.Valid
 
-			return err
+	if !alreadyDeleted {
+		deletedAt := time.Now()
+
+		_, err = tx.ExecContext(ctx, "UPDATE issues SET deleted_at=$1, confidential_since=NULL WHERE id=$2", deletedAt, issue.ID)
+
+		if err == nil {
+			deleted := issueChange{Action: "deleted", Field: models.IssueEventFieldDeletedAt, NewValue: deletedAt}
+
+			err = recordIssueEvents(ctx, tx, issue.ID, deletedAt, webhook.Sender, []issueChange{deleted})
 		}
-	} else {
-		updatedAt = createdAt
 	}
 
-	author, err := json.Marshal(webhook.Issue.User)
-
 	if err != nil {
 		tx.Rollback()
 
-		slog.Error("❌ Couldn't marshal author, will retry 💀",
+		slog.Error("❌ Couldn't delete issue, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		slog.Error("❌ Couldn't delete issue, commit db error, will retry 💀",
 			slog.String("name", webhook.Repo.Name),
 			slog.String("owner", webhook.Repo.Owner.Login),
 			slog.String("error", err.Error()))
@@ -160,12 +261,91 @@ func HandleGithubProcessIssueUpdate(ctx context.Context, t *asynq.Task, db *sqlx
 		return err
 	}
 
-	labels, err := json.Marshal(webhook.Issue.Labels)
+	if alreadyDeleted {
+		slog.Info("💡 Issue was already deleted, nothing to do",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.Uint64("issue_id", issue.ID))
+
+		return nil
+	}
+
+	enqueueDeleteIssueDocument(queue, issue)
+
+	broadcastRepoMessage(issue.Provider, issue.Host, issue.RepoOwner, issue.RepoName, fiber.Map{
+		"updated_at":       time.Now().Format(time.RFC3339),
+		"action":           "deleted",
+		"removed_issue_id": issue.ID,
+		"issue_number":     issue.IssueNumber,
+	})
+
+	slog.Info("✅ Completed deleting github issue",
+		slog.String("name", webhook.Repo.Name),
+		slog.String("owner", webhook.Repo.Owner.Login),
+		slog.Uint64("issue_id", issue.ID))
+
+	return nil
+}
+
+// processIssueHidden hides a stored issue the forge made confidential, and
+// removes it from search. The payload isn't applied or recorded, its content
+// is private, and an issue we never saw isn't stored. A later public payload
+// brings the issue back, see upsertGithubIssue.
+func processIssueHidden(ctx context.Context, db *sqlx.DB, queue *asynq.Client, webhook *forge.IssueEvent) error {
+	hiddenSince, err := time.Parse(time.RFC3339, webhook.Issue.CreatedAt)
+
+	if webhook.Issue.UpdatedAt != nil {
+		hiddenSince, err = time.Parse(time.RFC3339, *webhook.Issue.UpdatedAt)
+	}
+
+	if err != nil {
+		return fmt.Errorf("confidential issue time: %v: %w", err, asynq.SkipRetry)
+	}
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		ReadOnly: false,
+	})
 
 	if err != nil {
+		slog.Error("❌ Couldn't get tx, db error, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	if err := lockGithubIssue(ctx, tx, webhook.Repo, webhook.Issue.ID); err != nil {
+		tx.Rollback()
+
+		slog.Error("❌ Couldn't lock issue, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	issue := models.Issues{}
+
+	err = tx.GetContext(ctx, &issue, "SELECT * FROM issues WHERE provider=$1 AND host=$2 AND github_id=$3 LIMIT 1 FOR UPDATE",
+		webhook.Repo.Provider,
+		webhook.Repo.Host,
+		webhook.Issue.ID)
+
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+
+		slog.Info("💡 Confidential issue was never stored, nothing to do",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.Uint64("github_id", webhook.Issue.ID))
+
+		return nil
+	} else if err != nil {
 		tx.Rollback()
 
-		slog.Error("❌ Couldn't marshal labels, will retry 💀",
+		slog.Error("❌ Database issue fetching issues, will retry 💀",
 			slog.String("name", webhook.Repo.Name),
 			slog.String("owner", webhook.Repo.Owner.Login),
 			slog.String("error", err.Error()))
@@ -173,12 +353,37 @@ func HandleGithubProcessIssueUpdate(ctx context.Context, t *asynq.Task, db *sqlx
 		return err
 	}
 
-	assignees, err := json.Marshal(webhook.Issue.Assignees)
+	if err := checkIssueRepository(issue, webhook.Repo); err != nil {
+		tx.Rollback()
+
+		slog.Warn("💀 Refusing to hide an issue verified by another repository's secret",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("issue_owner", issue.RepoOwner),
+			slog.String("issue_name", issue.RepoName),
+			slog.Uint64("issue_id", issue.ID))
+
+		return err
+	}
+
+	// Deleted, already hidden, or made public again since
+	if issue.DeletedAt.Valid || (issue.UpdatedAt.Valid && hiddenSince.Before(issue.UpdatedAt.Time)) {
+		tx.Rollback()
+
+		slog.Info("💡 Issue is deleted, hidden or newer, nothing to hide",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.Uint64("issue_id", issue.ID))
+
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE issues SET deleted_at=now(), confidential_since=$1 WHERE id=$2", hiddenSince, issue.ID)
 
 	if err != nil {
 		tx.Rollback()
 
-		slog.Error("❌ Couldn't marshal assignees, will retry 💀",
+		slog.Error("❌ Couldn't hide issue, will retry 💀",
 			slog.String("name", webhook.Repo.Name),
 			slog.String("owner", webhook.Repo.Owner.Login),
 			slog.String("error", err.Error()))
@@ -186,59 +391,84 @@ func HandleGithubProcessIssueUpdate(ctx context.Context, t *asynq.Task, db *sqlx
 		return err
 	}
 
-	issue := models.Issues{}
+	err = tx.Commit()
+
+	if err != nil {
+		slog.Error("❌ Couldn't hide issue, commit db error, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
 
-	selectIssue := `
-	SELECT * FROM issues
-	WHERE github_id=$1
-	LIMIT 1
-	`
+		return err
+	}
 
-	err = tx.Get(&issue, selectIssue, webhook.Issue.ID)
+	enqueueDeleteIssueDocument(queue, issue)
 
-	if err == sql.ErrNoRows {
-		insertIntoIssues := `
-		INSERT INTO issues
-			(id, created_at, updated_at, title, issue_number, comments_count, repo_name, repo_owner, author, labels, assignees, closed, github_id)
-		VALUES
-			(nextval('issues_id_seq'::regclass), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-		RETURNING
-			id
-		`
-
-		var issueId uint64
-
-		err = tx.
-			QueryRowx(
-				insertIntoIssues,
-				createdAt,
-				updatedAt,
-				webhook.Issue.Title,
-				webhook.Issue.Number,
-				webhook.Issue.Comments,
-				webhook.Repo.Name,
-				webhook.Repo.Owner.Login,
-				author,
-				labels,
-				assignees,
-				webhook.Issue.State == "closed",
-				webhook.Issue.ID,
-			).
-			Scan(&issueId)
+	broadcastRepoMessage(issue.Provider, issue.Host, issue.RepoOwner, issue.RepoName, fiber.Map{
+		"updated_at":       time.Now().Format(time.RFC3339),
+		"action":           "hidden",
+		"removed_issue_id": issue.ID,
+		"issue_number":     issue.IssueNumber,
+	})
 
-		if err != nil {
+	slog.Info("✅ Completed hiding confidential issue",
+		slog.String("name", webhook.Repo.Name),
+		slog.String("owner", webhook.Repo.Owner.Login),
+		slog.Uint64("issue_id", issue.ID))
+
+	return nil
+}
+
+// processGithubIssueTransferred moves the stored issue over to its new
+// repository. If the new repository's copy already arrived, the old row is
+// tombstoned instead so the issue isn't listed twice. A repo scoped delivery
+// always tombstones and leaves the new repository to its own deliveries.
+func processGithubIssueTransferred(ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, webhook *forge.IssueEvent) error {
+	newIssue := webhook.Changes.NewIssue
+	newRepo := webhook.Changes.NewRepository
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		ReadOnly: false,
+	})
+
+	if err != nil {
+		slog.Error("❌ Couldn't get tx, db error, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	// Always lock in the same order so two transfers can't deadlock, a
+	// transfer never leaves the forge so the old repository's identity is used
+	first, second := webhook.Issue.ID, newIssue.ID
+
+	if second < first {
+		first, second = second, first
+	}
+
+	for _, githubID := range []uint64{first, second} {
+		if err := lockGithubIssue(ctx, tx, webhook.Repo, githubID); err != nil {
 			tx.Rollback()
 
-			slog.Error("❌ Couldn't insert issue, will retry 💀",
+			slog.Error("❌ Couldn't lock issue, will retry 💀",
 				slog.String("name", webhook.Repo.Name),
 				slog.String("owner", webhook.Repo.Owner.Login),
 				slog.String("error", err.Error()))
 
 			return err
 		}
+	}
 
-		issue.ID = issueId
-	} else if err != nil {
+	oldIssue := models.Issues{}
+
+	err = tx.GetContext(ctx, &oldIssue, "SELECT * FROM issues WHERE provider=$1 AND host=$2 AND github_id=$3 AND deleted_at IS NULL LIMIT 1 FOR UPDATE",
+		webhook.Repo.Provider,
+		webhook.Repo.Host,
+		webhook.Issue.ID)
+
+	if err != nil && err != sql.ErrNoRows {
 		tx.Rollback()
 
 		slog.Error("❌ Database issue fetching issues, will retry 💀",
@@ -247,97 +477,142 @@ func HandleGithubProcessIssueUpdate(ctx context.Context, t *asynq.Task, db *sqlx
 			slog.String("error", err.Error()))
 
 		return err
-	} else {
-		updateIssue := `
-		UPDATE issues
-		SET updated_at=$1, title=$2, issue_number=$3, comments_count=$4, repo_name=$5, repo_owner=$6, author=$7, labels=$8, assignees=$9, closed=$10
-		WHERE id=$11
-		`
-		_, err = tx.
-			Exec(
-				updateIssue,
-				updatedAt,
-				webhook.Issue.Title,
-				webhook.Issue.Number,
-				webhook.Issue.Comments,
-				webhook.Repo.Name,
-				webhook.Repo.Owner.Login,
-				author,
-				labels,
-				assignees,
-				webhook.Issue.State == "closed",
-				issue.ID,
-			)
+	}
+
+	moved := err == nil
+
+	if moved {
+		if err := checkIssueRepository(oldIssue, webhook.Repo); err != nil {
+			tx.Rollback()
+
+			slog.Warn("💀 Refusing transfer verified by another repository's secret",
+				slog.String("name", webhook.Repo.Name),
+				slog.String("owner", webhook.Repo.Owner.Login),
+				slog.String("issue_owner", oldIssue.RepoOwner),
+				slog.String("issue_name", oldIssue.RepoName))
+
+			return err
+		}
+
+		var newExists bool
+
+		err = tx.GetContext(ctx, &newExists, "SELECT EXISTS(SELECT 1 FROM issues WHERE provider=$1 AND host=$2 AND github_id=$3)",
+			webhook.Repo.Provider,
+			webhook.Repo.Host,
+			newIssue.ID)
 
 		if err != nil {
 			tx.Rollback()
 
-			slog.Error("❌ Couldn't update issue with new info, will retry 💀",
+			slog.Error("❌ Database issue fetching issues, will retry 💀",
 				slog.String("name", webhook.Repo.Name),
 				slog.String("owner", webhook.Repo.Owner.Login),
 				slog.String("error", err.Error()))
 
 			return err
 		}
-	}
 
-	err = tx.Commit()
+		transferredAt := time.Now()
+
+		var transferred issueChange
+
+		// A repo scoped delivery only vouches for the old repository, so it
+		// can take the issue out of it but not write into the new one
+		if newExists || webhook.Repo.RepoScoped {
+			_, err = tx.ExecContext(ctx, "UPDATE issues SET deleted_at=$1 WHERE id=$2", transferredAt, oldIssue.ID)
+
+			transferred = issueChange{Action: "transferred", Field: models.IssueEventFieldDeletedAt, NewValue: transferredAt}
+		} else {
+			_, err = tx.ExecContext(ctx, "UPDATE issues SET github_id=$1, repo_owner=$2, repo_name=$3, issue_number=$4 WHERE id=$5",
+				newIssue.ID,
+				newRepo.Owner.Login,
+				newRepo.Name,
+				newIssue.Number,
+				oldIssue.ID)
+
+			transferred = issueChange{
+				Action:   "transferred",
+				Field:    models.IssueEventFieldRepository,
+				OldValue: oldIssue.Location(),
+				NewValue: models.IssueLocation{RepoOwner: newRepo.Owner.Login, RepoName: newRepo.Name, IssueNumber: newIssue.Number},
+			}
+		}
 
-	if err != nil {
-		slog.Error("❌ Couldn't add message, commit db error, will retry 💀",
-			slog.String("name", webhook.Repo.Name),
-			slog.String("owner", webhook.Repo.Owner.Login),
-			slog.String("error", err.Error()))
+		if err == nil {
+			err = recordIssueEvents(ctx, tx, oldIssue.ID, transferredAt, webhook.Sender, []issueChange{transferred})
+		}
 
-		return err
+		if err == nil && !webhook.Repo.RepoScoped {
+			_, err = tx.ExecContext(ctx, "UPDATE issue_comments SET issue_github_id=$1 WHERE provider=$2 AND host=$3 AND issue_github_id=$4",
+				newIssue.ID,
+				webhook.Repo.Provider,
+				webhook.Repo.Host,
+				webhook.Issue.ID)
+		}
+
+		if err != nil {
+			tx.Rollback()
+
+			slog.Error("❌ Couldn't move transferred issue, will retry 💀",
+				slog.String("name", webhook.Repo.Name),
+				slog.String("owner", webhook.Repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return err
+		}
 	}
 
-	marshalled, err := json.Marshal(fiber.Map{
-		"updated_at": time.Now().Format(time.RFC3339),
-	})
+	issue := models.Issues{}
 
-	if err != nil {
-		slog.Error("💀 Couldn't marshal message",
-			slog.String("error", err.Error()))
+	if !webhook.Repo.RepoScoped {
+		newRepo.ActorsSeenAt = webhook.Repo.ActorsSeenAt
 
-		return nil
+		issue, err = upsertGithubIssue(ctx, tx, newRepo, newIssue, webhook.Sender)
+
+		if errors.Is(err, errStaleIssueUpdate) {
+			metrics.Incr(ctx, rdb, metrics.IssueStaleUpdateSkipped)
+		} else if err != nil {
+			tx.Rollback()
+
+			return err
+		}
 	}
 
-	task, err := NewReindexIssue(issue.ID)
+	err = tx.Commit()
 
 	if err != nil {
-		slog.Warn("💀 Could not enqueue search thread",
+		slog.Error("❌ Couldn't transfer issue, commit db error, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
 			slog.String("error", err.Error()))
 
-		return nil
+		return err
 	}
 
-	_, err = queue.Enqueue(task, asynq.Unique(time.Hour), asynq.Queue("low"))
+	if moved {
+		enqueueDeleteIssueDocument(queue, oldIssue)
 
-	if err != nil {
-		switch {
-		case errors.Is(err, asynq.ErrDuplicateTask):
-			slog.Warn("💀 Duplicate task search reindex",
-				slog.String("error", err.Error()))
-		default:
-			slog.Warn("💀 Could not enqueue search reindex",
-				slog.String("error", err.Error()))
-		}
+		broadcastRepoMessage(oldIssue.Provider, oldIssue.Host, oldIssue.RepoOwner, oldIssue.RepoName, fiber.Map{
+			"updated_at":       time.Now().Format(time.RFC3339),
+			"action":           "transferred",
+			"removed_issue_id": oldIssue.ID,
+			"issue_number":     oldIssue.IssueNumber,
+		})
 	}
 
-	client := req.C()
+	if issue.ID != 0 && !issue.DeletedAt.Valid {
+		enqueueReindexIssue(queue, issue.ID)
 
-	client.R().
-		SetContentType("application/json").
-		SetBody(&ws_handlers.BroadcastMessageInput{
-			Topic:   fmt.Sprintf("repo-%s-%s", webhook.Repo.Name, webhook.Repo.Owner.Login),
-			Message: string(marshalled),
-		}).
-		Post(os.Getenv("WS_API_PRIVATE_URL") + "/broadcast-message")
+		broadcastRepoMessage(webhook.Repo.Provider, webhook.Repo.Host, newRepo.Owner.Login, newRepo.Name, fiber.Map{
+			"updated_at": time.Now().Format(time.RFC3339),
+		})
+	}
 
-	slog.Info("✅ Completed processing github issue",
+	slog.Info("✅ Completed transferring github issue",
 		slog.String("name", webhook.Repo.Name),
-		slog.String("owner", webhook.Repo.Owner.Login))
+		slog.String("owner", webhook.Repo.Owner.Login),
+		slog.String("new_name", newRepo.Name),
+		slog.String("new_owner", newRepo.Owner.Login))
 
 	return nil
 }
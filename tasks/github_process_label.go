@@ -0,0 +1,126 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+const (
+	GithubProcessLabel = "github:label"
+)
+
+type GitHubWebhookLabelPayload struct {
+	Action string                 `json:"action"`
+	Label  *GitHubWebhookLabel    `json:"label"`
+	Repo   *forge.Repository      `json:"repository"`
+	Sender map[string]interface{} `json:"sender"`
+}
+
+func HandleGithubProcessLabel(ctx context.Context, t *asynq.Task, db *sqlx.DB, queue *asynq.Client) error {
+	slog.Info("🏃 Starting processing github label")
+
+	return handleWebhookDelivery(ctx, t, db, func(body []byte, delivery webhookDelivery) error {
+		return processGithubLabelWebhook(ctx, db, queue, body, delivery)
+	})
+}
+
+// processGithubLabelWebhook keeps the labels table current and rewrites the
+// copy of the label held on every issue that carries it.
+func processGithubLabelWebhook(ctx context.Context, db *sqlx.DB, queue *asynq.Client, body []byte, delivery webhookDelivery) error {
+	var webhook GitHubWebhookLabelPayload
+
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		slog.Error("❌ Could not process github webhook",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	if webhook.Label == nil || webhook.Repo == nil {
+		slog.Info("❌ Aborting, not a valid label webhook event",
+			slog.Any("info", webhook))
+
+		return fmt.Errorf("not a valid label webhook event: %w", asynq.SkipRetry)
+	}
+
+	delivery.scope(webhook.Repo)
+
+	slog.Info("💡 Starting processing of label webhook info",
+		slog.String("action", webhook.Action),
+		slog.String("label", webhook.Label.Name),
+		slog.String("name", webhook.Repo.Name),
+		slog.String("owner", webhook.Repo.Owner.Login))
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		ReadOnly: false,
+	})
+
+	if err != nil {
+		slog.Error("❌ Couldn't get tx, db error, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	var issueIDs []uint64
+
+	if webhook.Action == "deleted" {
+		issueIDs, err = deleteGithubLabel(ctx, tx, webhook.Repo, webhook.Label.ID)
+	} else {
+		issueIDs, err = updateGithubLabel(ctx, tx, webhook.Repo, *webhook.Label)
+	}
+
+	if err == nil {
+		err = upsertGithubSender(ctx, tx, webhook.Repo, webhook.Sender)
+	}
+
+	if err != nil {
+		tx.Rollback()
+
+		slog.Error("❌ Couldn't apply label change, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		slog.Error("❌ Couldn't apply label change, commit db error, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	for _, issueID := range issueIDs {
+		enqueueReindexIssue(queue, issueID)
+	}
+
+	broadcastRepoMessage(webhook.Repo.Provider, webhook.Repo.Host, webhook.Repo.Owner.Login, webhook.Repo.Name, fiber.Map{
+		"updated_at": time.Now().Format(time.RFC3339),
+		"action":     "label_" + webhook.Action,
+		"label":      webhook.Label.Name,
+	})
+
+	slog.Info("✅ Completed processing github label",
+		slog.String("name", webhook.Repo.Name),
+		slog.String("owner", webhook.Repo.Owner.Login),
+		slog.Int("issues", len(issueIDs)))
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+const (
+	GithubProcessMilestone = "github:milestone"
+)
+
+type GitHubWebhookMilestonePayload struct {
+	Action    string                 `json:"action"`
+	Milestone json.RawMessage        `json:"milestone"`
+	Repo      *forge.Repository      `json:"repository"`
+	Sender    map[string]interface{} `json:"sender"`
+}
+
+func HandleGithubProcessMilestone(ctx context.Context, t *asynq.Task, db *sqlx.DB, queue *asynq.Client) error {
+	slog.Info("🏃 Starting processing github milestone")
+
+	return handleWebhookDelivery(ctx, t, db, func(body []byte, delivery webhookDelivery) error {
+		return processGithubMilestoneWebhook(ctx, db, queue, body, delivery)
+	})
+}
+
+// processGithubMilestoneWebhook keeps the milestones table current and
+// rewrites the copy of the milestone held on every issue in it.
+func processGithubMilestoneWebhook(ctx context.Context, db *sqlx.DB, queue *asynq.Client, body []byte, delivery webhookDelivery) error {
+	var webhook GitHubWebhookMilestonePayload
+	var milestone GitHubWebhookMilestone
+
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		slog.Error("❌ Could not process github webhook",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	if len(webhook.Milestone) == 0 || webhook.Repo == nil || json.Unmarshal(webhook.Milestone, &milestone) != nil || milestone.ID == 0 {
+		slog.Info("❌ Aborting, not a valid milestone webhook event",
+			slog.Any("info", webhook))
+
+		return fmt.Errorf("not a valid milestone webhook event: %w", asynq.SkipRetry)
+	}
+
+	delivery.scope(webhook.Repo)
+
+	slog.Info("💡 Starting processing of milestone webhook info",
+		slog.String("action", webhook.Action),
+		slog.String("milestone", milestone.Title),
+		slog.String("name", webhook.Repo.Name),
+		slog.String("owner", webhook.Repo.Owner.Login))
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		ReadOnly: false,
+	})
+
+	if err != nil {
+		slog.Error("❌ Couldn't get tx, db error, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	var issueIDs []uint64
+
+	if webhook.Action == "deleted" {
+		issueIDs, err = deleteGithubMilestone(ctx, tx, webhook.Repo, milestone.ID)
+	} else {
+		issueIDs, err = updateGithubMilestone(ctx, tx, webhook.Repo, milestone, webhook.Milestone)
+	}
+
+	if err == nil {
+		err = upsertGithubSender(ctx, tx, webhook.Repo, webhook.Sender)
+	}
+
+	if err != nil {
+		tx.Rollback()
+
+		slog.Error("❌ Couldn't apply milestone change, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		slog.Error("❌ Couldn't apply milestone change, commit db error, will retry 💀",
+			slog.String("name", webhook.Repo.Name),
+			slog.String("owner", webhook.Repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	for _, issueID := range issueIDs {
+		enqueueReindexIssue(queue, issueID)
+	}
+
+	broadcastRepoMessage(webhook.Repo.Provider, webhook.Repo.Host, webhook.Repo.Owner.Login, webhook.Repo.Name, fiber.Map{
+		"updated_at":       time.Now().Format(time.RFC3339),
+		"action":           "milestone_" + webhook.Action,
+		"milestone_number": milestone.Number,
+	})
+
+	slog.Info("✅ Completed processing github milestone",
+		slog.String("name", webhook.Repo.Name),
+		slog.String("owner", webhook.Repo.Owner.Login),
+		slog.Int("issues", len(issueIDs)))
+
+	return nil
+}
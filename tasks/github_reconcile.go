@@ -0,0 +1,318 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/github"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	GithubScheduleReconciliations = "github:schedule-reconciliations"
+	GithubReconcile               = "github:reconcile"
+
+	ReconciliationRunning   = "running"
+	ReconciliationSucceeded = "succeeded"
+	ReconciliationFailed    = "failed"
+
+	// A repository that was never reconciled is checked this far back
+	firstReconcileWindow = 24 * time.Hour
+)
+
+func NewScheduleReconciliations() *asynq.Task {
+	return asynq.NewTask(GithubScheduleReconciliations, nil)
+}
+
+type GithubReconcilePayload struct {
+	Host      string
+	RepoOwner string
+	RepoName  string
+}
+
+func NewGithubReconcile(Host string, RepoOwner string, RepoName string) (*asynq.Task, error) {
+	payload, err := json.Marshal(GithubReconcilePayload{
+		Host:      Host,
+		RepoOwner: RepoOwner,
+		RepoName:  RepoName,
+	})
+
+	if err != nil {
+		slog.Error("Unable to schedule reconciliation of repo",
+			slog.String("error", err.Error()))
+
+		return nil, err
+	}
+
+	return asynq.NewTask(GithubReconcile, payload, asynq.MaxRetry(10)), nil
+}
+
+// HandleScheduleReconciliations enqueues a reconciliation for every GitHub
+// repository we hold issues for, have backfilled or have configured, on the
+// host the GitHub client serves.
+func HandleScheduleReconciliations(ctx context.Context, t *asynq.Task, db *sqlx.DB, queue *asynq.Client, gh *github.Client) error {
+	slog.Info("🏃 Starting scheduling reconciliations")
+
+	repos := []models.Reconciliations{}
+
+	err := db.SelectContext(ctx, &repos, `
+	SELECT DISTINCT host, lower(repo_owner) AS repo_owner, lower(repo_name) AS repo_name FROM issues WHERE provider=$1 AND host=$2
+	UNION
+	SELECT host, repo_owner, repo_name FROM backfills WHERE provider=$1 AND host=$2
+	UNION
+	SELECT host, repo_owner, repo_name FROM repositories WHERE provider=$1 AND host=$2
+	`, forge.ProviderGithub, gh.Host())
+
+	if err != nil {
+		slog.Error("❌ Couldn't list repositories to reconcile, will retry 💀",
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	for _, repo := range repos {
+		task, err := NewGithubReconcile(repo.Host, repo.RepoOwner, repo.RepoName)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = queue.Enqueue(task, asynq.Unique(time.Hour), asynq.Queue("low"))
+
+		if err != nil && !errors.Is(err, asynq.ErrDuplicateTask) {
+			slog.Error("💀 Couldn't enqueue reconciliation, will retry",
+				slog.String("owner", repo.RepoOwner),
+				slog.String("name", repo.RepoName),
+				slog.String("error", err.Error()))
+
+			return err
+		}
+	}
+
+	slog.Info("✅ Completed scheduling reconciliations",
+		slog.Int("repos", len(repos)))
+
+	return nil
+}
+
+// HandleGithubReconcile asks GitHub for the issues updated since the last
+// successful reconciliation and applies any we missed or hold an older copy
+// of. Every run leaves a report in reconciliations.
+func HandleGithubReconcile(ctx context.Context, t *asynq.Task, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, gh *github.Client) error {
+	slog.Info("🏃 Starting github reconciliation")
+
+	var p GithubReconcilePayload
+
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		slog.Error("❌ Could not process github reconciliation payload",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	var since time.Time
+
+	// Starting from when the last run started covers anything it raced with
+	err := db.GetContext(ctx, &since, `
+	SELECT started_at FROM reconciliations
+	WHERE provider=$1 AND host=$2 AND repo_owner=$3 AND repo_name=$4 AND status=$5
+	ORDER BY started_at DESC
+	LIMIT 1
+	`, forge.ProviderGithub, p.Host, p.RepoOwner, p.RepoName, ReconciliationSucceeded)
+
+	if err == sql.ErrNoRows {
+		since = time.Now().Add(-firstReconcileWindow)
+	} else if err != nil {
+		slog.Error("❌ Couldn't load last reconciliation, will retry 💀",
+			slog.String("owner", p.RepoOwner),
+			slog.String("name", p.RepoName),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	report := models.Reconciliations{}
+
+	err = db.GetContext(ctx, &report, `
+	INSERT INTO reconciliations
+		(provider, host, repo_owner, repo_name, status, since)
+	VALUES
+		($1, $2, $3, $4, $5, $6)
+	RETURNING *
+	`, forge.ProviderGithub, p.Host, p.RepoOwner, p.RepoName, ReconciliationRunning, since)
+
+	if err != nil {
+		slog.Error("❌ Couldn't start reconciliation, will retry 💀",
+			slog.String("owner", p.RepoOwner),
+			slog.String("name", p.RepoName),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	reconcileErr := runGithubReconcile(ctx, db, rdb, queue, gh, &report)
+
+	report.Status = ReconciliationSucceeded
+
+	if reconcileErr != nil {
+		report.Status = ReconciliationFailed
+		report.LastError = sql.NullString{String: reconcileErr.Error(), Valid: true}
+	}
+
+	_, err = db.ExecContext(ctx, `
+	UPDATE reconciliations
+	SET status=$1, finished_at=now(), duration_ms=$2, issues_checked=$3, rows_fixed=$4, rows_missing=$5, last_error=$6
+	WHERE id=$7
+	`, report.Status, time.Since(report.StartedAt).Milliseconds(), report.IssuesChecked, report.RowsFixed, report.RowsMissing, report.LastError, report.ID)
+
+	if err != nil {
+		slog.Error("❌ Couldn't record reconciliation report",
+			slog.Uint64("reconciliation_id", report.ID),
+			slog.String("error", err.Error()))
+
+		if reconcileErr == nil {
+			return err
+		}
+	}
+
+	if reconcileErr != nil {
+		return reconcileErr
+	}
+
+	slog.Info("✅ Completed github reconciliation",
+		slog.String("owner", p.RepoOwner),
+		slog.String("name", p.RepoName),
+		slog.Uint64("issues_checked", report.IssuesChecked),
+		slog.Uint64("rows_fixed", report.RowsFixed),
+		slog.Uint64("rows_missing", report.RowsMissing))
+
+	return nil
+}
+
+func runGithubReconcile(ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, gh *github.Client, report *models.Reconciliations) error {
+	if err := checkGithubHost(gh, report.Host); err != nil {
+		return err
+	}
+
+	repo, err := fetchGithubRepository(ctx, gh, report.Host, report.RepoOwner, report.RepoName)
+
+	if err != nil {
+		return err
+	}
+
+	pageURL := fmt.Sprintf("%s/issues?state=all&sort=updated&direction=asc&per_page=%d&since=%s",
+		github.RepoPath(report.RepoOwner, report.RepoName), backfillPerPage, url.QueryEscape(report.Since.UTC().Format(time.RFC3339)))
+
+	for pageURL != "" {
+		// The page's user profiles are at least as new as the request
+		repo.ActorsSeenAt = time.Now()
+
+		resp, err := fetchGithubPage(ctx, gh, pageURL)
+
+		if err != nil {
+			return err
+		}
+
+		issues := []forge.Issue{}
+
+		if err := json.Unmarshal(resp.Body, &issues); err != nil {
+			return fmt.Errorf("github issues json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+		}
+
+		issueIDs := []uint64{}
+
+		for i := range issues {
+			if issues[i].PullRequest != nil {
+				continue
+			}
+
+			report.IssuesChecked++
+
+			missing, err := githubIssueDrifted(ctx, db, repo, &issues[i])
+
+			if errors.Is(err, errIssueInSync) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			issue, err := applyIssueUpdate(ctx, db, rdb, repo, &issues[i], nil)
+
+			if errors.Is(err, errStaleIssueUpdate) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			if !issue.DeletedAt.Valid {
+				issueIDs = append(issueIDs, issue.ID)
+			}
+
+			if missing {
+				report.RowsMissing++
+			} else {
+				report.RowsFixed++
+			}
+		}
+
+		// One reindex and one broadcast for the page rather than each issue
+		if len(issueIDs) > 0 {
+			enqueueReindexIssues(queue, issueIDs)
+
+			broadcastRepoMessage(repo.Provider, repo.Host, repo.Owner.Login, repo.Name, fiber.Map{
+				"updated_at": time.Now().Format(time.RFC3339),
+			})
+		}
+
+		pageURL = github.NextPage(resp.Header)
+	}
+
+	return nil
+}
+
+var errIssueInSync = errors.New("stored issue is up to date")
+
+// githubIssueDrifted compares GitHub's copy of an issue with ours. It reports
+// whether we're missing the issue entirely, or errIssueInSync when our copy is
+// at least as new.
+func githubIssueDrifted(ctx context.Context, db *sqlx.DB, repo *forge.Repository, ghIssue *forge.Issue) (bool, error) {
+	remoteUpdatedAt := ghIssue.CreatedAt
+
+	if ghIssue.UpdatedAt != nil {
+		remoteUpdatedAt = *ghIssue.UpdatedAt
+	}
+
+	remote, err := time.Parse(time.RFC3339, remoteUpdatedAt)
+
+	if err != nil {
+		return false, fmt.Errorf("github issue updated_at: %v: %w", err, asynq.SkipRetry)
+	}
+
+	var stored sql.NullTime
+
+	err = db.GetContext(ctx, &stored, "SELECT updated_at FROM issues WHERE provider=$1 AND host=$2 AND github_id=$3",
+		repo.Provider, repo.Host, ghIssue.ID)
+
+	if err == sql.ErrNoRows {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if stored.Valid && !stored.Time.Before(remote) {
+		return false, errIssueInSync
+	}
+
+	return false, nil
+}
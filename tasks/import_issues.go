@@ -0,0 +1,673 @@
+package tasks
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/search"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ImportIssues = "import:issues"
+
+	ImportFormatJSONL   = "jsonl"
+	ImportFormatArchive = "archive"
+
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+
+	// Only the first errors are kept, records_failed still counts them all
+	maxImportErrors = 1000
+
+	importIndexBatch = 500
+)
+
+type ImportIssuesPayload struct {
+	ImportID uint64
+}
+
+func NewImportIssues(ImportID uint64) (*asynq.Task, error) {
+	payload, err := json.Marshal(ImportIssuesPayload{
+		ImportID: ImportID,
+	})
+
+	if err != nil {
+		slog.Error("Unable to schedule import",
+			slog.String("error", err.Error()))
+
+		return nil, err
+	}
+
+	return asynq.NewTask(ImportIssues, payload, asynq.MaxRetry(3)), nil
+}
+
+type importRecordError struct {
+	Record string `json:"record"`
+	Error  string `json:"error"`
+}
+
+// importRun tallies an import as it goes.
+type importRun struct {
+	repo     *forge.Repository
+	report   models.Imports
+	errors   []importRecordError
+	issueIDs map[uint64]bool
+}
+
+func (r *importRun) fail(record string, err error) {
+	r.report.RecordsFailed++
+
+	if len(r.errors) < maxImportErrors {
+		r.errors = append(r.errors, importRecordError{Record: record, Error: err.Error()})
+	}
+}
+
+// HandleImportIssues applies an uploaded JSONL file or migration archive the
+// way the issue webhooks would, then indexes everything it touched in bulk.
+// A record that can't be imported is reported and the rest carry on.
+func HandleImportIssues(ctx context.Context, t *asynq.Task, db *sqlx.DB, rdb *redis.Client, backend search.Backend) error {
+	slog.Info("🏃 Starting issue import")
+
+	var p ImportIssuesPayload
+
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		slog.Error("❌ Could not process import payload",
+			slog.String("error", err.Error()))
+
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	report := models.Imports{}
+
+	// A retry parses the whole payload again, so it counts from zero
+	err := db.GetContext(ctx, &report, `
+	UPDATE imports
+	SET status=$1, started_at=now(), records=0, issues_imported=0, comments_imported=0,
+		records_skipped=0, records_failed=0, errors='[]'::jsonb, last_error=NULL
+	WHERE id=$2 AND status IN ($1, $3)
+	RETURNING *
+	`, ImportRunning, p.ImportID, ImportQueued)
+
+	if err == sql.ErrNoRows {
+		slog.Info("💡 Import isn't waiting to run, nothing to do",
+			slog.Uint64("import_id", p.ImportID))
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	run := &importRun{
+		repo: &forge.Repository{
+			Provider: report.Provider,
+			Host:     report.Host,
+			Name:     report.RepoName,
+			Owner:    forge.RepositoryOwner{Login: report.RepoOwner},
+			HTMLURL:  fmt.Sprintf("https://%s/%s/%s", report.Host, report.RepoOwner, report.RepoName),
+		},
+		report:   report,
+		issueIDs: map[uint64]bool{},
+	}
+
+	switch report.Format {
+	case ImportFormatJSONL:
+		err = importJSONL(ctx, db, rdb, run)
+	case ImportFormatArchive:
+		err = importArchive(ctx, db, rdb, run)
+	default:
+		err = fmt.Errorf("unknown import format %q: %w", report.Format, asynq.SkipRetry)
+	}
+
+	if err == nil {
+		err = indexImportedIssues(ctx, db, backend, run)
+	}
+
+	return finishImport(ctx, db, run, err)
+}
+
+func importJSONL(ctx context.Context, db *sqlx.DB, rdb *redis.Client, run *importRun) error {
+	reader := bufio.NewReader(bytes.NewReader(run.report.Payload))
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			record := fmt.Sprintf("line %d", lineNumber)
+			ghIssue := forge.Issue{}
+
+			run.report.Records++
+
+			if err := json.Unmarshal(line, &ghIssue); err != nil {
+				run.fail(record, err)
+			} else {
+				importIssue(ctx, db, rdb, run, record, &ghIssue)
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading jsonl: %v: %w", err, asynq.SkipRetry)
+		}
+	}
+}
+
+// importIssue applies one GitHub shaped issue through the webhook path.
+func importIssue(ctx context.Context, db *sqlx.DB, rdb *redis.Client, run *importRun, record string, ghIssue *forge.Issue) {
+	if ghIssue.PullRequest != nil {
+		run.report.RecordsSkipped++
+
+		return
+	}
+
+	if ghIssue.ID == 0 || ghIssue.Number == 0 || ghIssue.CreatedAt == "" {
+		run.fail(record, errors.New("issue needs an id, number and created_at"))
+
+		return
+	}
+
+	issue, err := applyIssueUpdate(ctx, db, rdb, run.repo, ghIssue, nil)
+
+	if errors.Is(err, errStaleIssueUpdate) {
+		// We already hold a newer copy
+		run.report.RecordsSkipped++
+
+		return
+	} else if err != nil {
+		run.fail(record, err)
+
+		return
+	}
+
+	run.report.IssuesImported++
+
+	if !issue.DeletedAt.Valid {
+		run.issueIDs[issue.ID] = true
+	}
+}
+
+// archiveIssue and archiveComment are the shapes of the issues_*.json and
+// issue_comments_*.json files in a GitHub migration archive, which refer to
+// users, labels and issues by URL instead of embedding them.
+type archiveIssue struct {
+	URL       string   `json:"url"`
+	User      string   `json:"user"`
+	Title     string   `json:"title"`
+	Body      *string  `json:"body"`
+	Assignees []string `json:"assignees"`
+	Labels    []string `json:"labels"`
+	ClosedAt  *string  `json:"closed_at"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt *string  `json:"updated_at"`
+}
+
+type archiveComment struct {
+	URL       string  `json:"url"`
+	Issue     string  `json:"issue"`
+	User      string  `json:"user"`
+	Body      string  `json:"body"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt *string `json:"updated_at"`
+}
+
+var (
+	archiveIssuesFile   = regexp.MustCompile(`^issues_\d+\.json$`)
+	archiveCommentsFile = regexp.MustCompile(`^issue_comments_\d+\.json$`)
+	archiveCommentID    = regexp.MustCompile(`#issuecomment-(\d+)$`)
+)
+
+// importArchive reads a migration archive tarball, gzipped or not. Every issue
+// is applied before any comment so comments find their issue.
+func importArchive(ctx context.Context, db *sqlx.DB, rdb *redis.Client, run *importRun) error {
+	var reader io.Reader = bytes.NewReader(run.report.Payload)
+
+	if bytes.HasPrefix(run.report.Payload, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(reader)
+
+		if err != nil {
+			return fmt.Errorf("reading archive: %v: %w", err, asynq.SkipRetry)
+		}
+
+		defer gz.Close()
+
+		reader = gz
+	}
+
+	issueFiles := map[string][]byte{}
+	commentFiles := map[string][]byte{}
+
+	archive := tar.NewReader(reader)
+
+	for {
+		header, err := archive.Next()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("reading archive: %v: %w", err, asynq.SkipRetry)
+		}
+
+		name := path.Base(header.Name)
+
+		if !archiveIssuesFile.MatchString(name) && !archiveCommentsFile.MatchString(name) {
+			continue
+		}
+
+		contents, err := io.ReadAll(archive)
+
+		if err != nil {
+			return fmt.Errorf("reading %s: %v: %w", header.Name, err, asynq.SkipRetry)
+		}
+
+		if archiveIssuesFile.MatchString(name) {
+			issueFiles[name] = contents
+		} else {
+			commentFiles[name] = contents
+		}
+	}
+
+	for _, name := range sortedKeys(issueFiles) {
+		issues := []archiveIssue{}
+
+		if err := json.Unmarshal(issueFiles[name], &issues); err != nil {
+			run.fail(name, err)
+
+			continue
+		}
+
+		for i := range issues {
+			record := fmt.Sprintf("%s[%d]", name, i)
+
+			run.report.Records++
+
+			ghIssue, err := issueFromArchive(ctx, db, run.repo, issues[i])
+
+			if err != nil {
+				run.fail(record, err)
+
+				continue
+			}
+
+			importIssue(ctx, db, rdb, run, record, ghIssue)
+		}
+	}
+
+	for _, name := range sortedKeys(commentFiles) {
+		comments := []archiveComment{}
+
+		if err := json.Unmarshal(commentFiles[name], &comments); err != nil {
+			run.fail(name, err)
+
+			continue
+		}
+
+		for i := range comments {
+			record := fmt.Sprintf("%s[%d]", name, i)
+
+			run.report.Records++
+
+			importArchiveComment(ctx, db, rdb, run, record, comments[i])
+		}
+	}
+
+	// Archives don't carry comment counts, count what was imported instead
+	_, err := db.ExecContext(ctx, `
+	UPDATE issues
+	SET comments_count=GREATEST(comments_count, (
+		SELECT count(*) FROM issue_comments c
+		WHERE c.provider=issues.provider AND c.host=issues.host AND c.issue_github_id=issues.github_id AND c.deleted_at IS NULL
+	))
+	WHERE id = ANY($1)
+	`, pq.Array(importedIssueIDs(run)))
+
+	return err
+}
+
+// issueFromArchive rebuilds a GitHub shaped issue from an archive record. The
+// archive has no issue ids, so an issue we already hold keeps its id and a
+// new one gets a synthetic id until its real one turns up.
+func issueFromArchive(ctx context.Context, db *sqlx.DB, repo *forge.Repository, record archiveIssue) (*forge.Issue, error) {
+	number, err := archiveIssueNumber(record.URL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	githubID, err := archiveIssueGithubID(ctx, db, repo, number)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ghIssue := &forge.Issue{
+		ID:        githubID,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+		ClosedAt:  record.ClosedAt,
+		Title:     record.Title,
+		Body:      record.Body,
+		HTMLURL:   record.URL,
+		Number:    number,
+		State:     "open",
+		User:      archiveUser(record.User),
+		Labels:    []interface{}{},
+		Assignees: []interface{}{},
+	}
+
+	if record.ClosedAt != nil {
+		ghIssue.State = "closed"
+	}
+
+	for _, labelURL := range record.Labels {
+		ghIssue.Labels = append(ghIssue.Labels, map[string]interface{}{"name": archiveURLName(labelURL)})
+	}
+
+	for _, userURL := range record.Assignees {
+		ghIssue.Assignees = append(ghIssue.Assignees, archiveUser(userURL))
+	}
+
+	return ghIssue, nil
+}
+
+func archiveIssueGithubID(ctx context.Context, db *sqlx.DB, repo *forge.Repository, number uint64) (uint64, error) {
+	var githubID uint64
+
+	err := db.GetContext(ctx, &githubID, `
+	SELECT github_id FROM issues
+	WHERE provider=$1 AND host=$2 AND lower(repo_owner)=lower($3) AND lower(repo_name)=lower($4) AND issue_number=$5
+	ORDER BY deleted_at NULLS FIRST
+	LIMIT 1
+	`, repo.Provider, repo.Host, repo.Owner.Login, repo.Name, number)
+
+	if err == sql.ErrNoRows {
+		return syntheticGithubID(repo, number), nil
+	}
+
+	return githubID, err
+}
+
+func importArchiveComment(ctx context.Context, db *sqlx.DB, rdb *redis.Client, run *importRun, record string, archived archiveComment) {
+	// Comments on pull requests point at a pull request instead
+	if archived.Issue == "" {
+		run.report.RecordsSkipped++
+
+		return
+	}
+
+	match := archiveCommentID.FindStringSubmatch(archived.URL)
+
+	if match == nil {
+		run.fail(record, fmt.Errorf("comment url %q has no comment id", archived.URL))
+
+		return
+	}
+
+	commentID, _ := strconv.ParseUint(match[1], 10, 64)
+
+	number, err := archiveIssueNumber(archived.Issue)
+
+	if err != nil {
+		run.fail(record, err)
+
+		return
+	}
+
+	issue := models.Issues{}
+
+	err = db.GetContext(ctx, &issue, `
+	SELECT * FROM issues
+	WHERE provider=$1 AND host=$2 AND lower(repo_owner)=lower($3) AND lower(repo_name)=lower($4) AND issue_number=$5
+	ORDER BY deleted_at NULLS FIRST
+	LIMIT 1
+	`, run.repo.Provider, run.repo.Host, run.repo.Owner.Login, run.repo.Name, number)
+
+	if err == sql.ErrNoRows {
+		run.fail(record, fmt.Errorf("issue #%d isn't in the archive or the database", number))
+
+		return
+	} else if err != nil {
+		run.fail(record, err)
+
+		return
+	}
+
+	comment := &GitHubWebhookComment{
+		ID:        commentID,
+		CreatedAt: archived.CreatedAt,
+		UpdatedAt: archived.UpdatedAt,
+		Body:      archived.Body,
+		HTMLURL:   archived.URL,
+		User:      archiveUser(archived.User),
+	}
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		ReadOnly: false,
+	})
+
+	if err != nil {
+		run.fail(record, err)
+
+		return
+	}
+
+	_, err = upsertGithubComment(ctx, tx, run.repo, issue.GitHubID, comment, false)
+
+	if errors.Is(err, errStaleCommentUpdate) {
+		tx.Rollback()
+
+		run.report.RecordsSkipped++
+
+		return
+	} else if err != nil {
+		tx.Rollback()
+
+		run.fail(record, err)
+
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		run.fail(record, err)
+
+		return
+	}
+
+	run.report.CommentsImported++
+
+	if !issue.DeletedAt.Valid {
+		run.issueIDs[issue.ID] = true
+	}
+}
+
+// archiveIssueNumber reads the number out of an issue URL,
+// e.g. https://github.com/owner/name/issues/12.
+func archiveIssueNumber(issueURL string) (uint64, error) {
+	parsed, err := url.Parse(issueURL)
+
+	if err != nil {
+		return 0, err
+	}
+
+	number, err := strconv.ParseUint(path.Base(parsed.Path), 10, 64)
+
+	if err != nil || !strings.Contains(parsed.Path, "/issues/") {
+		return 0, fmt.Errorf("%q is not an issue url", issueURL)
+	}
+
+	return number, nil
+}
+
+func archiveURLName(rawURL string) string {
+	name := path.Base(rawURL)
+
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		return unescaped
+	}
+
+	return name
+}
+
+// archiveUser stands in for a user the archive only links to. Without an id
+// it's kept on the issue but not stored as an actor.
+func archiveUser(userURL string) map[string]interface{} {
+	if userURL == "" {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"login":    archiveURLName(userURL),
+		"html_url": userURL,
+	}
+}
+
+func importedIssueIDs(run *importRun) []int64 {
+	ids := []int64{}
+
+	for id := range run.issueIDs {
+		ids = append(ids, int64(id))
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
+
+func sortedKeys(files map[string][]byte) []string {
+	names := []string{}
+
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// indexImportedIssues sends everything the import touched to search in
+// batches, instead of a reindex task per issue.
+func indexImportedIssues(ctx context.Context, db *sqlx.DB, backend search.Backend, run *importRun) error {
+	ids := importedIssueIDs(run)
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	repo := search.Repo{
+		Provider: run.repo.Provider,
+		Host:     run.repo.Host,
+		Owner:    run.repo.Owner.Login,
+		Name:     run.repo.Name,
+	}
+
+	for start := 0; start < len(ids); start += importIndexBatch {
+		end := min(start+importIndexBatch, len(ids))
+
+		issues := []models.Issues{}
+
+		err := db.SelectContext(ctx, &issues, "SELECT * FROM issues WHERE id = ANY($1) AND deleted_at IS NULL", pq.Array(ids[start:end]))
+
+		if err != nil {
+			return err
+		}
+
+		documents, err := issueSearchDocuments(ctx, db, issues)
+
+		if err != nil {
+			return err
+		}
+
+		if err := backend.Index(ctx, repo, documents); err != nil {
+			return err
+		}
+
+		slog.Info("💡 Indexed imported issues",
+			slog.Uint64("import_id", run.report.ID),
+			slog.Int("indexed", end),
+			slog.Int("total", len(ids)))
+	}
+
+	return nil
+}
+
+// finishImport records the outcome. The upload is dropped once the import is
+// done with it, a failed import that will be retried keeps it.
+func finishImport(ctx context.Context, db *sqlx.DB, run *importRun, importErr error) error {
+	status := ImportCompleted
+
+	if importErr != nil {
+		status = ImportQueued
+
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+
+		if errors.Is(importErr, asynq.SkipRetry) || retried >= maxRetry {
+			status = ImportFailed
+		}
+	}
+
+	recordErrors, err := json.Marshal(run.errors)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+	UPDATE imports
+	SET status=$1, finished_at=CASE WHEN $1 IN ($2, $3) THEN now() END, records=$4, issues_imported=$5, comments_imported=$6,
+		records_skipped=$7, records_failed=$8, errors=$9, last_error=$10,
+		payload=CASE WHEN $1=$2 THEN ''::bytea ELSE payload END
+	WHERE id=$11
+	`, status, ImportCompleted, ImportFailed, run.report.Records, run.report.IssuesImported, run.report.CommentsImported,
+		run.report.RecordsSkipped, run.report.RecordsFailed, recordErrors, errorString(importErr), run.report.ID)
+
+	if err != nil {
+		slog.Error("❌ Couldn't record import outcome",
+			slog.Uint64("import_id", run.report.ID),
+			slog.String("error", err.Error()))
+
+		if importErr == nil {
+			return err
+		}
+	}
+
+	if importErr != nil {
+		slog.Error("❌ Import failed",
+			slog.Uint64("import_id", run.report.ID),
+			slog.String("error", importErr.Error()))
+
+		return importErr
+	}
+
+	slog.Info("✅ Completed issue import",
+		slog.Uint64("import_id", run.report.ID),
+		slog.Uint64("records", run.report.Records),
+		slog.Uint64("issues_imported", run.report.IssuesImported),
+		slog.Uint64("comments_imported", run.report.CommentsImported),
+		slog.Uint64("records_failed", run.report.RecordsFailed))
+
+	return nil
+}
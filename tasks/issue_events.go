@@ -0,0 +1,249 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/macwilko/issues-sync/db/models"
+)
+
+type issueChange struct {
+	Action   string
+	Field    string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+type githubObjectID struct {
+	ID uint64 `json:"id"`
+}
+
+// diffGithubIssue lists the field level changes between the stored row and the
+// row it's being replaced with.
+func diffGithubIssue(before models.Issues, after models.Issues) ([]issueChange, error) {
+	changes := []issueChange{}
+
+	if before.Title != after.Title {
+		changes = append(changes, issueChange{Action: "renamed", Field: models.IssueEventFieldTitle, OldValue: before.Title, NewValue: after.Title})
+	}
+
+	if before.Body != after.Body {
+		changes = append(changes, issueChange{Action: "edited", Field: models.IssueEventFieldBody, OldValue: nullStringValue(before.Body), NewValue: nullStringValue(after.Body)})
+	}
+
+	if before.Closed != after.Closed {
+		action := "reopened"
+
+		if after.Closed {
+			action = "closed"
+		}
+
+		changes = append(changes, issueChange{Action: action, Field: models.IssueEventFieldState, OldValue: before.State(), NewValue: after.State()})
+	} else if before.StateReason != after.StateReason {
+		changes = append(changes, issueChange{Action: "state_reason_changed", Field: models.IssueEventFieldState, OldValue: before.State(), NewValue: after.State()})
+	}
+
+	action, err := diffGithubObjects(before.Labels, after.Labels, "labeled", "unlabeled", "relabeled")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if action != "" {
+		changes = append(changes, issueChange{Action: action, Field: models.IssueEventFieldLabels, OldValue: before.Labels, NewValue: after.Labels})
+	}
+
+	action, err = diffGithubObjects(before.Assignees, after.Assignees, "assigned", "unassigned", "reassigned")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if action != "" {
+		changes = append(changes, issueChange{Action: action, Field: models.IssueEventFieldAssignees, OldValue: before.Assignees, NewValue: after.Assignees})
+	}
+
+	// Milestones carry live issue counts, so only a different milestone counts
+	beforeMilestone, err := githubObjectIDOf(before.Milestone)
+
+	if err != nil {
+		return nil, err
+	}
+
+	afterMilestone, err := githubObjectIDOf(after.Milestone)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if beforeMilestone != afterMilestone {
+		action := "milestone_changed"
+
+		if beforeMilestone == 0 {
+			action = "milestoned"
+		} else if afterMilestone == 0 {
+			action = "demilestoned"
+		}
+
+		changes = append(changes, issueChange{Action: action, Field: models.IssueEventFieldMilestone, OldValue: before.Milestone, NewValue: after.Milestone})
+	}
+
+	if before.Locked != after.Locked {
+		action := "unlocked"
+
+		if after.Locked {
+			action = "locked"
+		}
+
+		changes = append(changes, issueChange{Action: action, Field: models.IssueEventFieldLock, OldValue: before.Lock(), NewValue: after.Lock()})
+	} else if before.ActiveLockReason != after.ActiveLockReason {
+		changes = append(changes, issueChange{Action: "lock_reason_changed", Field: models.IssueEventFieldLock, OldValue: before.Lock(), NewValue: after.Lock()})
+	}
+
+	return changes, nil
+}
+
+// diffGithubObjects compares two JSON lists of GitHub objects by id and names
+// the change: added, removed or both.
+func diffGithubObjects(before types.JSONText, after types.JSONText, added string, removed string, replaced string) (string, error) {
+	beforeIDs, err := githubObjectIDs(before)
+
+	if err != nil {
+		return "", err
+	}
+
+	afterIDs, err := githubObjectIDs(after)
+
+	if err != nil {
+		return "", err
+	}
+
+	hasAdded, hasRemoved := false, false
+
+	for id := range afterIDs {
+		if !beforeIDs[id] {
+			hasAdded = true
+		}
+	}
+
+	for id := range beforeIDs {
+		if !afterIDs[id] {
+			hasRemoved = true
+		}
+	}
+
+	switch {
+	case hasAdded && hasRemoved:
+		return replaced, nil
+	case hasAdded:
+		return added, nil
+	case hasRemoved:
+		return removed, nil
+	}
+
+	return "", nil
+}
+
+func githubObjectIDs(raw types.JSONText) (map[uint64]bool, error) {
+	objects := []githubObjectID{}
+	ids := map[uint64]bool{}
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &objects); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, object := range objects {
+		ids[object.ID] = true
+	}
+
+	return ids, nil
+}
+
+func githubObjectIDOf(raw types.NullJSONText) (uint64, error) {
+	object := githubObjectID{}
+
+	if !raw.Valid {
+		return 0, nil
+	}
+
+	if err := json.Unmarshal(raw.JSONText, &object); err != nil {
+		return 0, err
+	}
+
+	return object.ID, nil
+}
+
+func nullStringValue(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+
+	return &value.String
+}
+
+// recordIssueEvents writes the changes to the issue's history inside tx.
+func recordIssueEvents(ctx context.Context, tx *sqlx.Tx, issueID uint64, occurredAt time.Time, sender map[string]interface{}, changes []issueChange) error {
+	actor, err := marshalNullJSON(sender)
+
+	if err != nil {
+		return err
+	}
+
+	insertEvent := `
+	INSERT INTO issue_events
+		(issue_id, occurred_at, actor, action, field, old_value, new_value)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	for _, change := range changes {
+		oldValue, err := marshalEventValue(change.OldValue)
+
+		if err != nil {
+			return err
+		}
+
+		newValue, err := marshalEventValue(change.NewValue)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, insertEvent, issueID, occurredAt, actor, change.Action, change.Field, oldValue, newValue)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func marshalEventValue(value interface{}) (types.NullJSONText, error) {
+	switch v := value.(type) {
+	case nil:
+		return types.NullJSONText{}, nil
+	case *string:
+		if v == nil {
+			return types.NullJSONText{}, nil
+		}
+	case types.NullJSONText:
+		return v, nil
+	case types.JSONText:
+		return types.NullJSONText{JSONText: v, Valid: true}, nil
+	}
+
+	marshalled, err := json.Marshal(value)
+
+	if err != nil {
+		return types.NullJSONText{}, err
+	}
+
+	return types.NullJSONText{JSONText: marshalled, Valid: true}, nil
+}
@@ -0,0 +1,543 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+// errStaleIssueUpdate is returned when the stored issue is newer than the
+// payload, which happens when asynq runs retries or concurrent tasks out of order.
+var errStaleIssueUpdate = errors.New("issue update is older than the stored issue")
+
+// errForeignRepository is returned when a repo scoped delivery names a row
+// stored under another repository. Retrying won't change who verified it.
+var errForeignRepository = fmt.Errorf("row belongs to another repository: %w", asynq.SkipRetry)
+
+// checkIssueRepository refuses a repo scoped write to an issue of another
+// repository, see forge.Repository.RepoScoped.
+func checkIssueRepository(issue models.Issues, repo *forge.Repository) error {
+	if repo.RepoScoped && !sameRepository(issue.RepoOwner, issue.RepoName, repo) {
+		return errForeignRepository
+	}
+
+	return nil
+}
+
+// checkRowRepository is checkIssueRepository for the label and milestone
+// tables, which are keyed by the forge's id alone.
+func checkRowRepository(ctx context.Context, tx *sqlx.Tx, table string, repo *forge.Repository, githubID uint64) error {
+	if !repo.RepoScoped {
+		return nil
+	}
+
+	row := struct {
+		RepoOwner string `db:"repo_owner"`
+		RepoName  string `db:"repo_name"`
+	}{}
+
+	err := tx.GetContext(ctx, &row, "SELECT repo_owner, repo_name FROM "+table+" WHERE provider=$1 AND host=$2 AND github_id=$3",
+		repo.Provider, repo.Host, githubID)
+
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !sameRepository(row.RepoOwner, row.RepoName, repo) {
+		return errForeignRepository
+	}
+
+	return nil
+}
+
+// checkNewIssueRepository refuses a repo scoped insert of an issue whose
+// html_url places it in another repository. Stored under the delivery's
+// repository, the row would turn away the real repository's deliveries.
+func checkNewIssueRepository(repo *forge.Repository, ghIssue *forge.Issue) error {
+	if !repo.RepoScoped {
+		return nil
+	}
+
+	issueURL, err := url.Parse(ghIssue.HTMLURL)
+
+	if err != nil || !strings.EqualFold(issueURL.Host, repo.Host) {
+		return errForeignRepository
+	}
+
+	prefix := "/" + repo.Owner.Login + "/" + repo.Name + "/"
+
+	if len(issueURL.Path) < len(prefix) || !strings.EqualFold(issueURL.Path[:len(prefix)], prefix) {
+		return errForeignRepository
+	}
+
+	return nil
+}
+
+func sameRepository(owner string, name string, repo *forge.Repository) bool {
+	return strings.EqualFold(owner, repo.Owner.Login) && strings.EqualFold(name, repo.Name)
+}
+
+// lockGithubIssue serialises writers of the same forge issue until tx ends.
+// It's an advisory lock rather than a row lock so it also covers the insert.
+func lockGithubIssue(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, githubID uint64) error {
+	key := fmt.Sprintf("%s/%s/%d", repo.Provider, repo.Host, githubID)
+
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtextextended($1, 0))", key)
+
+	return err
+}
+
+// Migration archives don't carry issue ids, imported issues get one from this
+// range, far above any real GitHub id, until a webhook or backfill brings it.
+const syntheticGithubIDBase = 1 << 62
+
+func syntheticGithubID(repo *forge.Repository, number uint64) uint64 {
+	h := fnv.New64a()
+
+	fmt.Fprintf(h, "%s/%s/%s/%s#%d", repo.Provider, repo.Host, strings.ToLower(repo.Owner.Login), strings.ToLower(repo.Name), number)
+
+	return syntheticGithubIDBase | h.Sum64()&(syntheticGithubIDBase-1)
+}
+
+// adoptSyntheticIssue hands an imported issue, and its comments, over to the
+// real id of the same issue.
+func adoptSyntheticIssue(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, ghIssue *forge.Issue) error {
+	syntheticID := syntheticGithubID(repo, ghIssue.Number)
+
+	result, err := tx.ExecContext(ctx, "UPDATE issues SET github_id=$1 WHERE provider=$2 AND host=$3 AND github_id=$4",
+		ghIssue.ID, repo.Provider, repo.Host, syntheticID)
+
+	if err != nil {
+		return err
+	}
+
+	if adopted, _ := result.RowsAffected(); adopted == 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE issue_comments SET issue_github_id=$1 WHERE provider=$2 AND host=$3 AND issue_github_id=$4",
+		ghIssue.ID, repo.Provider, repo.Host, syntheticID)
+
+	return err
+}
+
+// upsertGithubIssue inserts or updates the row for a GitHub issue inside tx and
+// returns the stored row, recording what changed against sender. Tombstoned
+// issues are left alone, hidden confidential ones come back, and a payload
+// older than the stored row is rejected with errStaleIssueUpdate.
+func upsertGithubIssue(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, ghIssue *forge.Issue, sender map[string]interface{}) (models.Issues, error) {
+	issue := models.Issues{}
+
+	createdAt, err := time.Parse(time.RFC3339, ghIssue.CreatedAt)
+
+	if err != nil {
+		slog.Error("❌ Couldn't parse created_at, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	var updatedAt time.Time
+
+	if ghIssue.UpdatedAt != nil {
+		updatedAt, err = time.Parse(time.RFC3339, *ghIssue.UpdatedAt)
+
+		if err != nil {
+			slog.Error("❌ Couldn't parse updated_at, will retry 💀",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return issue, err
+		}
+	} else {
+		updatedAt = createdAt
+	}
+
+	ghIssue, err = fillGithubIssueAuthor(ctx, tx, repo, ghIssue)
+
+	if err != nil {
+		slog.Error("❌ Couldn't look up author, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	author, err := json.Marshal(ghIssue.User)
+
+	if err != nil {
+		slog.Error("❌ Couldn't marshal author, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	labels, err := json.Marshal(ghIssue.Labels)
+
+	if err != nil {
+		slog.Error("❌ Couldn't marshal labels, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	assignees, err := json.Marshal(ghIssue.Assignees)
+
+	if err != nil {
+		slog.Error("❌ Couldn't marshal assignees, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	closedAt, err := parseGithubTime(ghIssue.ClosedAt)
+
+	if err != nil {
+		slog.Error("❌ Couldn't parse closed_at, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	closedBy, err := marshalNullJSON(ghIssue.ClosedBy)
+
+	if err != nil {
+		slog.Error("❌ Couldn't marshal closed_by, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	milestone, err := marshalNullJSON(ghIssue.Milestone)
+
+	if err != nil {
+		slog.Error("❌ Couldn't marshal milestone, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	reactions := []byte("{}")
+
+	if ghIssue.Reactions != nil {
+		reactions, err = json.Marshal(ghIssue.Reactions)
+
+		if err != nil {
+			slog.Error("❌ Couldn't marshal reactions, will retry 💀",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return issue, err
+		}
+	}
+
+	if err := lockGithubIssue(ctx, tx, repo, ghIssue.ID); err != nil {
+		slog.Error("❌ Couldn't lock issue, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	if ghIssue.ID < syntheticGithubIDBase {
+		if err := adoptSyntheticIssue(ctx, tx, repo, ghIssue); err != nil {
+			slog.Error("❌ Couldn't adopt imported issue, will retry 💀",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return issue, err
+		}
+	}
+
+	selectIssue := `
+	SELECT * FROM issues
+	WHERE provider=$1 AND host=$2 AND github_id=$3
+	LIMIT 1
+	FOR UPDATE
+	`
+
+	err = tx.GetContext(ctx, &issue, selectIssue, repo.Provider, repo.Host, ghIssue.ID)
+
+	if err == sql.ErrNoRows {
+		if err := checkNewIssueRepository(repo, ghIssue); err != nil {
+			slog.Warn("💀 Refusing new issue from another repository verified by this one's secret",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("html_url", ghIssue.HTMLURL))
+
+			return issue, err
+		}
+
+		insertIntoIssues := `
+		INSERT INTO issues
+			(id, created_at, updated_at, title, issue_number, comments_count, repo_name, repo_owner, author, labels, assignees, closed, github_id,
+			 body, html_url, state_reason, closed_at, closed_by, milestone, locked, active_lock_reason, reactions, author_association, provider, host)
+		VALUES
+			(nextval('issues_id_seq'::regclass), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
+			 $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)
+		RETURNING
+			*
+		`
+
+		err = tx.
+			QueryRowxContext(
+				ctx,
+				insertIntoIssues,
+				createdAt,
+				updatedAt,
+				ghIssue.Title,
+				ghIssue.Number,
+				ghIssue.Comments,
+				repo.Name,
+				repo.Owner.Login,
+				author,
+				labels,
+				assignees,
+				ghIssue.State == "closed",
+				ghIssue.ID,
+				ghIssue.Body,
+				nullIfEmpty(ghIssue.HTMLURL),
+				ghIssue.StateReason,
+				closedAt,
+				closedBy,
+				milestone,
+				ghIssue.Locked,
+				ghIssue.ActiveLockReason,
+				reactions,
+				nullIfEmpty(ghIssue.AuthorAssociation),
+				repo.Provider,
+				repo.Host,
+			).
+			StructScan(&issue)
+
+		if err != nil {
+			slog.Error("❌ Couldn't insert issue, will retry 💀",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return issue, err
+		}
+
+		created := issueChange{Action: "created", Field: models.IssueEventFieldIssue, NewValue: issue.Location()}
+
+		if err := recordIssueEvents(ctx, tx, issue.ID, createdAt, sender, []issueChange{created}); err != nil {
+			slog.Error("❌ Couldn't record issue events, will retry 💀",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return issue, err
+		}
+
+		return issue, syncIssueRelations(ctx, tx, repo, issue.ID, ghIssue)
+	} else if err != nil {
+		slog.Error("❌ Database issue fetching issues, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	if err := checkIssueRepository(issue, repo); err != nil {
+		slog.Warn("💀 Refusing issue update verified by another repository's secret",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("issue_owner", issue.RepoOwner),
+			slog.String("issue_name", issue.RepoName),
+			slog.Uint64("issue_id", issue.ID))
+
+		return issue, err
+	}
+
+	// A confidential issue made public again comes back, an older payload
+	// from before it was hidden doesn't
+	if issue.ConfidentialSince.Valid && !updatedAt.Before(issue.ConfidentialSince.Time) {
+		_, err = tx.ExecContext(ctx, "UPDATE issues SET deleted_at=NULL, confidential_since=NULL WHERE id=$1", issue.ID)
+
+		if err != nil {
+			slog.Error("❌ Couldn't unhide issue, will retry 💀",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return issue, err
+		}
+
+		issue.DeletedAt = sql.NullTime{}
+		issue.ConfidentialSince = sql.NullTime{}
+	}
+
+	if issue.DeletedAt.Valid {
+		slog.Info("💡 Issue was deleted, ignoring update",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.Uint64("issue_id", issue.ID))
+
+		return issue, nil
+	}
+
+	// Last writer wins by GitHub's updated_at, equal timestamps are reapplied
+	if issue.UpdatedAt.Valid && updatedAt.Before(issue.UpdatedAt.Time) {
+		slog.Info("💡 Skipping stale issue update",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.Uint64("issue_id", issue.ID),
+			slog.String("stored_updated_at", issue.UpdatedAt.Time.Format(time.RFC3339)),
+			slog.String("updated_at", updatedAt.Format(time.RFC3339)))
+
+		return issue, errStaleIssueUpdate
+	}
+
+	before := issue
+
+	// An author we couldn't fill in stays as stored rather than losing its login
+	if ghIssue.User != nil && ghIssue.User["login"] == nil {
+		author = issue.Author
+	}
+
+	updateIssue := `
+	UPDATE issues
+	SET updated_at=$1, title=$2, issue_number=$3, comments_count=$4, repo_name=$5, repo_owner=$6, author=$7, labels=$8, assignees=$9, closed=$10,
+		body=$11, html_url=$12, state_reason=$13, closed_at=$14, closed_by=CASE WHEN $10 THEN COALESCE($15, closed_by) END, milestone=$16, locked=$17, active_lock_reason=$18,
+		reactions=$19, author_association=$20
+	WHERE id=$21
+	RETURNING
+		*
+	`
+
+	err = tx.
+		QueryRowxContext(
+			ctx,
+			updateIssue,
+			updatedAt,
+			ghIssue.Title,
+			ghIssue.Number,
+			ghIssue.Comments,
+			repo.Name,
+			repo.Owner.Login,
+			author,
+			labels,
+			assignees,
+			ghIssue.State == "closed",
+			ghIssue.Body,
+			nullIfEmpty(ghIssue.HTMLURL),
+			ghIssue.StateReason,
+			closedAt,
+			closedBy,
+			milestone,
+			ghIssue.Locked,
+			ghIssue.ActiveLockReason,
+			reactions,
+			nullIfEmpty(ghIssue.AuthorAssociation),
+			issue.ID,
+		).
+		StructScan(&issue)
+
+	if err != nil {
+		slog.Error("❌ Couldn't update issue with new info, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	changes, err := diffGithubIssue(before, issue)
+
+	if err == nil {
+		err = recordIssueEvents(ctx, tx, issue.ID, updatedAt, sender, changes)
+	}
+
+	if err != nil {
+		slog.Error("❌ Couldn't record issue events, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return issue, err
+	}
+
+	return issue, syncIssueRelations(ctx, tx, repo, issue.ID, ghIssue)
+}
+
+// syncIssueRelations brings the normalized tables in line with the payload.
+func syncIssueRelations(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, issueID uint64, ghIssue *forge.Issue) error {
+	if err := syncIssueActors(ctx, tx, repo, issueID, ghIssue); err != nil {
+		return err
+	}
+
+	if err := syncIssueLabels(ctx, tx, repo, issueID, ghIssue.Labels); err != nil {
+		return err
+	}
+
+	return syncIssueMilestone(ctx, tx, repo, issueID, ghIssue.Milestone)
+}
+
+func parseGithubTime(value *string) (sql.NullTime, error) {
+	if value == nil || *value == "" {
+		return sql.NullTime{}, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, *value)
+
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+
+	return sql.NullTime{Time: parsed, Valid: true}, nil
+}
+
+// marshalNullJSON keeps a missing object as SQL NULL rather than JSON null.
+func marshalNullJSON(value map[string]interface{}) (types.NullJSONText, error) {
+	if value == nil {
+		return types.NullJSONText{}, nil
+	}
+
+	marshalled, err := json.Marshal(value)
+
+	if err != nil {
+		return types.NullJSONText{}, err
+	}
+
+	return types.NullJSONText{JSONText: marshalled, Valid: true}, nil
+}
+
+func nullIfEmpty(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,71 @@
+package tasks
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hibiken/asynq"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+func TestCheckIssueRepository(t *testing.T) {
+	stored := models.Issues{RepoOwner: "octo", RepoName: "private"}
+
+	// A delivery signed with octo/hello's own secret names an issue of octo/private
+	scoped := &forge.Repository{Name: "hello", Owner: forge.RepositoryOwner{Login: "octo"}, RepoScoped: true}
+
+	err := checkIssueRepository(stored, scoped)
+
+	if !errors.Is(err, errForeignRepository) || !errors.Is(err, asynq.SkipRetry) {
+		t.Errorf("cross-repository write = %v, want errForeignRepository without retries", err)
+	}
+
+	own := &forge.Repository{Name: "Private", Owner: forge.RepositoryOwner{Login: "Octo"}, RepoScoped: true}
+
+	if err := checkIssueRepository(stored, own); err != nil {
+		t.Errorf("write to the repository's own issue = %v, want it allowed", err)
+	}
+
+	// A global secret vouches for any repository, transfers rely on that
+	global := &forge.Repository{Name: "hello", Owner: forge.RepositoryOwner{Login: "octo"}}
+
+	if err := checkIssueRepository(stored, global); err != nil {
+		t.Errorf("write verified by a global secret = %v, want it allowed", err)
+	}
+}
+
+func TestCheckNewIssueRepository(t *testing.T) {
+	scoped := &forge.Repository{Host: "github.com", Name: "Hello", Owner: forge.RepositoryOwner{Login: "Octo"}, RepoScoped: true}
+
+	for _, test := range []struct {
+		htmlURL string
+		allowed bool
+	}{
+		{"https://github.com/octo/hello/issues/1", true},
+		{"https://github.com/Octo/Hello/issues/1", true},
+		{"https://github.com/octo/private/issues/1", false},
+		{"https://github.com/octo/hello-world/issues/1", false},
+		{"https://github.example.com/octo/hello/issues/1", false},
+		{"", false},
+	} {
+		err := checkNewIssueRepository(scoped, &forge.Issue{HTMLURL: test.htmlURL})
+
+		if allowed := err == nil; allowed != test.allowed {
+			t.Errorf("new issue at %q allowed = %v, want %v", test.htmlURL, allowed, test.allowed)
+		}
+	}
+
+	// Nested GitLab groups keep the whole namespace as the owner
+	gitlab := &forge.Repository{Host: "gitlab.com", Name: "hello", Owner: forge.RepositoryOwner{Login: "octo/tools"}, RepoScoped: true}
+
+	if err := checkNewIssueRepository(gitlab, &forge.Issue{HTMLURL: "https://gitlab.com/octo/tools/hello/-/issues/3"}); err != nil {
+		t.Errorf("new gitlab issue = %v, want it allowed", err)
+	}
+
+	global := &forge.Repository{Host: "github.com", Name: "hello", Owner: forge.RepositoryOwner{Login: "octo"}}
+
+	if err := checkNewIssueRepository(global, &forge.Issue{HTMLURL: "https://github.com/octo/private/issues/1"}); err != nil {
+		t.Errorf("new issue verified by a global secret = %v, want it allowed", err)
+	}
+}
@@ -0,0 +1,243 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+type GitHubWebhookLabel struct {
+	ID          uint64  `json:"id"`
+	Name        string  `json:"name"`
+	Color       string  `json:"color"`
+	Description *string `json:"description"`
+	Default     bool    `json:"default"`
+}
+
+// githubLabels reads the typed labels back out of an issue's raw label list.
+func githubLabels(raw []interface{}) ([]GitHubWebhookLabel, error) {
+	labels := []GitHubWebhookLabel{}
+
+	marshalled, err := json.Marshal(raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(marshalled, &labels); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// Lock order: the issue rows first, in id order, then the label rows. Issue
+// payloads lock their issue and then link its labels, label events lock every
+// issue carrying the label before they change it, so the two can't deadlock.
+
+// upsertGithubLabel stores a label as a label event describes it. Only label
+// events change the catalog, see ensureGithubLabel.
+func upsertGithubLabel(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, label GitHubWebhookLabel) (uint64, error) {
+	upsertLabel := `
+	INSERT INTO labels
+		(github_id, repo_name, repo_owner, name, color, description, is_default, provider, host)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (provider, host, github_id) DO UPDATE
+	SET updated_at=now(), repo_name=EXCLUDED.repo_name, repo_owner=EXCLUDED.repo_owner, name=EXCLUDED.name,
+		color=EXCLUDED.color, description=EXCLUDED.description, is_default=EXCLUDED.is_default
+	RETURNING
+		id
+	`
+
+	var labelID uint64
+
+	err := tx.
+		QueryRowxContext(ctx, upsertLabel, label.ID, repo.Name, repo.Owner.Login, label.Name, label.Color, label.Description, label.Default, repo.Provider, repo.Host).
+		Scan(&labelID)
+
+	return labelID, err
+}
+
+// ensureGithubLabel returns the id of a label seen on an issue, adding it when
+// it's new. Issue payloads can be late or replayed, so a label that's already
+// stored is left as it is rather than renamed back.
+func ensureGithubLabel(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, label GitHubWebhookLabel) (uint64, error) {
+	insertLabel := `
+	INSERT INTO labels
+		(github_id, repo_name, repo_owner, name, color, description, is_default, provider, host)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (provider, host, github_id) DO NOTHING
+	RETURNING
+		id
+	`
+
+	var labelID uint64
+
+	err := tx.
+		QueryRowxContext(ctx, insertLabel, label.ID, repo.Name, repo.Owner.Login, label.Name, label.Color, label.Description, label.Default, repo.Provider, repo.Host).
+		Scan(&labelID)
+
+	if err == sql.ErrNoRows {
+		err = tx.GetContext(ctx, &labelID, "SELECT id FROM labels WHERE provider=$1 AND host=$2 AND github_id=$3",
+			repo.Provider, repo.Host, label.ID)
+	}
+
+	return labelID, err
+}
+
+// lockLabelIssues locks the issues carrying a label, see the lock order above.
+func lockLabelIssues(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, labelGithubID uint64) error {
+	_, err := tx.ExecContext(ctx, `
+	SELECT i.id FROM issues i
+	WHERE i.id IN (SELECT il.issue_id FROM issue_labels il JOIN labels lb ON lb.id = il.label_id WHERE lb.provider = $1 AND lb.host = $2 AND lb.github_id = $3)
+	ORDER BY i.id
+	FOR UPDATE
+	`, repo.Provider, repo.Host, labelGithubID)
+
+	return err
+}
+
+// syncIssueLabels makes the issue_labels join match the labels on the payload.
+func syncIssueLabels(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, issueID uint64, raw []interface{}) error {
+	labels, err := githubLabels(raw)
+
+	if err != nil {
+		slog.Error("❌ Couldn't read issue labels, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	labelIDs := []int64{}
+
+	for _, label := range labels {
+		if label.ID == 0 {
+			continue
+		}
+
+		labelID, err := ensureGithubLabel(ctx, tx, repo, label)
+
+		if err != nil {
+			slog.Error("❌ Couldn't upsert label, will retry 💀",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return err
+		}
+
+		labelIDs = append(labelIDs, int64(labelID))
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM issue_labels WHERE issue_id=$1 AND NOT (label_id = ANY($2))", issueID, pq.Array(labelIDs))
+
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO issue_labels (issue_id, label_id)
+		SELECT $1, unnest($2::bigint[])
+		ON CONFLICT DO NOTHING
+		`, issueID, pq.Array(labelIDs))
+	}
+
+	if err != nil {
+		slog.Error("❌ Couldn't link issue labels, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	return nil
+}
+
+// updateGithubLabel stores a created or edited label and rewrites it on every
+// issue carrying it, returning the ids of the issues it touched.
+func updateGithubLabel(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, label GitHubWebhookLabel) ([]uint64, error) {
+	issueIDs := []uint64{}
+
+	if err := checkRowRepository(ctx, tx, "labels", repo, label.ID); err != nil {
+		return nil, err
+	}
+
+	if err := lockLabelIssues(ctx, tx, repo, label.ID); err != nil {
+		return nil, err
+	}
+
+	labelID, err := upsertGithubLabel(ctx, tx, repo, label)
+
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := json.Marshal(map[string]interface{}{
+		"name":        label.Name,
+		"color":       label.Color,
+		"description": label.Description,
+		"default":     label.Default,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	updateLabel := `
+	UPDATE issues
+	SET labels = (
+		SELECT COALESCE(jsonb_agg(CASE WHEN (l->>'id')::bigint = $1 THEN l || $2::jsonb ELSE l END ORDER BY ord), '[]'::jsonb)
+		FROM jsonb_array_elements(issues.labels) WITH ORDINALITY AS e(l, ord)
+	)
+	WHERE id IN (SELECT issue_id FROM issue_labels WHERE label_id = $3)
+	RETURNING
+		id
+	`
+
+	err = tx.SelectContext(ctx, &issueIDs, updateLabel, label.ID, changes, labelID)
+
+	return issueIDs, err
+}
+
+// deleteGithubLabel drops a label and strips it from every issue carrying it,
+// returning the ids of the issues it touched.
+func deleteGithubLabel(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, labelGithubID uint64) ([]uint64, error) {
+	issueIDs := []uint64{}
+
+	if err := checkRowRepository(ctx, tx, "labels", repo, labelGithubID); err != nil {
+		return nil, err
+	}
+
+	if err := lockLabelIssues(ctx, tx, repo, labelGithubID); err != nil {
+		return nil, err
+	}
+
+	removeLabel := `
+	UPDATE issues
+	SET labels = (
+		SELECT COALESCE(jsonb_agg(l ORDER BY ord), '[]'::jsonb)
+		FROM jsonb_array_elements(issues.labels) WITH ORDINALITY AS e(l, ord)
+		WHERE (l->>'id')::bigint IS DISTINCT FROM $1
+	)
+	WHERE id IN (SELECT il.issue_id FROM issue_labels il JOIN labels lb ON lb.id = il.label_id WHERE lb.provider = $2 AND lb.host = $3 AND lb.github_id = $1)
+	RETURNING
+		id
+	`
+
+	err := tx.SelectContext(ctx, &issueIDs, removeLabel, labelGithubID, repo.Provider, repo.Host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM labels WHERE provider=$1 AND host=$2 AND github_id=$3", repo.Provider, repo.Host, labelGithubID)
+
+	return issueIDs, err
+}
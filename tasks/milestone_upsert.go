@@ -0,0 +1,208 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+type GitHubWebhookMilestone struct {
+	ID           uint64  `json:"id"`
+	Number       uint64  `json:"number"`
+	Title        string  `json:"title"`
+	Description  *string `json:"description"`
+	State        string  `json:"state"`
+	DueOn        *string `json:"due_on"`
+	ClosedAt     *string `json:"closed_at"`
+	UpdatedAt    *string `json:"updated_at"`
+	OpenIssues   uint64  `json:"open_issues"`
+	ClosedIssues uint64  `json:"closed_issues"`
+	HTMLURL      string  `json:"html_url"`
+}
+
+// githubMilestone reads the typed milestone back out of an issue's raw
+// milestone, nil when the issue has none.
+func githubMilestone(raw map[string]interface{}) (*GitHubWebhookMilestone, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	milestone := GitHubWebhookMilestone{}
+
+	marshalled, err := json.Marshal(raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(marshalled, &milestone); err != nil {
+		return nil, err
+	}
+
+	if milestone.ID == 0 {
+		return nil, nil
+	}
+
+	return &milestone, nil
+}
+
+// upsertGithubMilestone stores the milestone unless we already hold a newer
+// copy of it, the counts embedded on issue payloads can lag the milestone event.
+func upsertGithubMilestone(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, milestone GitHubWebhookMilestone) (uint64, error) {
+	if err := checkRowRepository(ctx, tx, "milestones", repo, milestone.ID); err != nil {
+		return 0, err
+	}
+
+	dueOn, err := parseGithubTime(milestone.DueOn)
+
+	if err != nil {
+		return 0, err
+	}
+
+	closedAt, err := parseGithubTime(milestone.ClosedAt)
+
+	if err != nil {
+		return 0, err
+	}
+
+	updatedAt, err := parseGithubTime(milestone.UpdatedAt)
+
+	if err != nil {
+		return 0, err
+	}
+
+	state := milestone.State
+
+	if state == "" {
+		state = "open"
+	}
+
+	upsertMilestone := `
+	INSERT INTO milestones
+		(github_id, github_updated_at, repo_name, repo_owner, number, title, description, state, due_on, closed_at, open_issues, closed_issues, html_url,
+		 provider, host)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	ON CONFLICT (provider, host, github_id) DO UPDATE
+	SET updated_at=now(), github_updated_at=EXCLUDED.github_updated_at, repo_name=EXCLUDED.repo_name, repo_owner=EXCLUDED.repo_owner,
+		number=EXCLUDED.number, title=EXCLUDED.title, description=EXCLUDED.description, state=EXCLUDED.state, due_on=EXCLUDED.due_on,
+		closed_at=EXCLUDED.closed_at, open_issues=EXCLUDED.open_issues, closed_issues=EXCLUDED.closed_issues, html_url=EXCLUDED.html_url
+	WHERE milestones.github_updated_at IS NULL OR EXCLUDED.github_updated_at IS NULL OR EXCLUDED.github_updated_at >= milestones.github_updated_at
+	RETURNING
+		id
+	`
+
+	var milestoneID uint64
+
+	err = tx.
+		QueryRowxContext(ctx, upsertMilestone, milestone.ID, updatedAt, repo.Name, repo.Owner.Login, milestone.Number, milestone.Title,
+			milestone.Description, state, dueOn, closedAt, milestone.OpenIssues, milestone.ClosedIssues, nullIfEmpty(milestone.HTMLURL),
+			repo.Provider, repo.Host).
+		Scan(&milestoneID)
+
+	if err == sql.ErrNoRows {
+		err = tx.GetContext(ctx, &milestoneID, "SELECT id FROM milestones WHERE provider=$1 AND host=$2 AND github_id=$3", repo.Provider, repo.Host, milestone.ID)
+	}
+
+	return milestoneID, err
+}
+
+// syncIssueMilestone points the issue at the milestone on the payload.
+func syncIssueMilestone(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, issueID uint64, raw map[string]interface{}) error {
+	milestone, err := githubMilestone(raw)
+
+	if err != nil {
+		slog.Error("❌ Couldn't read issue milestone, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	var milestoneID sql.NullInt64
+
+	if milestone != nil {
+		id, err := upsertGithubMilestone(ctx, tx, repo, *milestone)
+
+		if err != nil {
+			slog.Error("❌ Couldn't upsert milestone, will retry 💀",
+				slog.String("name", repo.Name),
+				slog.String("owner", repo.Owner.Login),
+				slog.String("error", err.Error()))
+
+			return err
+		}
+
+		milestoneID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE issues SET milestone_id=$1 WHERE id=$2", milestoneID, issueID)
+
+	if err != nil {
+		slog.Error("❌ Couldn't link issue milestone, will retry 💀",
+			slog.String("name", repo.Name),
+			slog.String("owner", repo.Owner.Login),
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	return nil
+}
+
+// updateGithubMilestone stores a changed milestone and rewrites the copy held
+// on every issue in it, returning the ids of the issues it touched.
+func updateGithubMilestone(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, milestone GitHubWebhookMilestone, raw json.RawMessage) ([]uint64, error) {
+	issueIDs := []uint64{}
+
+	milestoneID, err := upsertGithubMilestone(ctx, tx, repo, milestone)
+
+	if err != nil {
+		return nil, err
+	}
+
+	updateMilestone := `
+	UPDATE issues
+	SET milestone = COALESCE(milestone, '{}'::jsonb) || $1::jsonb
+	WHERE milestone_id = $2
+	RETURNING
+		id
+	`
+
+	err = tx.SelectContext(ctx, &issueIDs, updateMilestone, []byte(raw), milestoneID)
+
+	return issueIDs, err
+}
+
+// deleteGithubMilestone drops a milestone and clears it from every issue in it,
+// returning the ids of the issues it touched.
+func deleteGithubMilestone(ctx context.Context, tx *sqlx.Tx, repo *forge.Repository, milestoneGithubID uint64) ([]uint64, error) {
+	issueIDs := []uint64{}
+
+	if err := checkRowRepository(ctx, tx, "milestones", repo, milestoneGithubID); err != nil {
+		return nil, err
+	}
+
+	removeMilestone := `
+	UPDATE issues
+	SET milestone = NULL, milestone_id = NULL
+	WHERE milestone_id IN (SELECT id FROM milestones WHERE provider = $2 AND host = $3 AND github_id = $1)
+	RETURNING
+		id
+	`
+
+	err := tx.SelectContext(ctx, &issueIDs, removeMilestone, milestoneGithubID, repo.Provider, repo.Host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM milestones WHERE provider=$1 AND host=$2 AND github_id=$3", repo.Provider, repo.Host, milestoneGithubID)
+
+	return issueIDs, err
+}
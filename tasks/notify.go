@@ -0,0 +1,91 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hibiken/asynq"
+	"github.com/imroc/req/v3"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/ws_handlers"
+)
+
+// broadcastRepoMessage tells WebSocket subscribers of a repo that something changed.
+func broadcastRepoMessage(provider string, host string, owner string, name string, message fiber.Map) {
+	marshalled, err := json.Marshal(message)
+
+	if err != nil {
+		slog.Error("💀 Couldn't marshal message",
+			slog.String("error", err.Error()))
+
+		return
+	}
+
+	client := req.C()
+
+	_, err = client.R().
+		SetContentType("application/json").
+		SetBody(&ws_handlers.BroadcastMessageInput{
+			Topic:   forge.RepoTopic(provider, host, owner, name),
+			Message: string(marshalled),
+		}).
+		Post(os.Getenv("WS_API_PRIVATE_URL") + "/broadcast-message")
+
+	if err != nil {
+		slog.Warn("💀 Could not broadcast repo message",
+			slog.String("provider", provider),
+			slog.String("host", host),
+			slog.String("name", name),
+			slog.String("owner", owner),
+			slog.String("error", err.Error()))
+	}
+}
+
+func enqueueSearchTask(queue *asynq.Client, task *asynq.Task, err error) {
+	if err != nil {
+		slog.Warn("💀 Could not enqueue search thread",
+			slog.String("error", err.Error()))
+
+		return
+	}
+
+	_, err = queue.Enqueue(task, asynq.Unique(time.Hour), asynq.Queue("low"))
+
+	if err != nil {
+		switch {
+		case errors.Is(err, asynq.ErrDuplicateTask):
+			slog.Warn("💀 Duplicate task search reindex",
+				slog.String("error", err.Error()))
+		default:
+			slog.Warn("💀 Could not enqueue search reindex",
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+func enqueueReindexIssue(queue *asynq.Client, issueID uint64) {
+	task, err := NewReindexIssue(issueID)
+
+	enqueueSearchTask(queue, task, err)
+}
+
+func enqueueReindexIssues(queue *asynq.Client, issueIDs []uint64) {
+	if len(issueIDs) == 0 {
+		return
+	}
+
+	task, err := NewReindexIssues(issueIDs)
+
+	enqueueSearchTask(queue, task, err)
+}
+
+func enqueueDeleteIssueDocument(queue *asynq.Client, issue models.Issues) {
+	task, err := NewDeleteIssueDocument(issue.ID, issue.Provider, issue.Host, issue.RepoOwner, issue.RepoName)
+
+	enqueueSearchTask(queue, task, err)
+}
@@ -0,0 +1,151 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/db/models"
+)
+
+const (
+	PropagateActors = "actors:propagate"
+)
+
+func NewPropagateActors() *asynq.Task {
+	return asynq.NewTask(PropagateActors, nil)
+}
+
+// HandlePropagateActors copies changed logins and avatars onto the issues and
+// comments that embed the actor, then reindexes those issues.
+func HandlePropagateActors(ctx context.Context, t *asynq.Task, db *sqlx.DB, queue *asynq.Client) error {
+	slog.Info("🏃 Starting propagating actors")
+
+	actors := []models.Actors{}
+
+	err := db.SelectContext(ctx, &actors, `
+	SELECT * FROM actors
+	WHERE updated_at > propagated_at
+	ORDER BY updated_at ASC
+	LIMIT 100
+	`)
+
+	if err != nil {
+		slog.Error("💀 Couldn't fetch changed actors, will retry",
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	for _, actor := range actors {
+		issueIDs, err := propagateActor(ctx, db, actor)
+
+		if err != nil {
+			slog.Error("💀 Couldn't propagate actor, will retry",
+				slog.String("login", actor.Login),
+				slog.String("error", err.Error()))
+
+			return err
+		}
+
+		for _, issueID := range issueIDs {
+			enqueueReindexIssue(queue, issueID)
+		}
+	}
+
+	slog.Info("✅ Completed propagating actors",
+		slog.Int("actors", len(actors)))
+
+	return nil
+}
+
+func propagateActor(ctx context.Context, db *sqlx.DB, actor models.Actors) ([]uint64, error) {
+	profile, err := json.Marshal(actor.ToProfileMap())
+
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		ReadOnly: false,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	authored := []uint64{}
+
+	err = tx.SelectContext(ctx, &authored, "UPDATE issues SET author = author || $1::jsonb WHERE author_id=$2 RETURNING id", profile, actor.ID)
+
+	if err != nil {
+		tx.Rollback()
+
+		return nil, err
+	}
+
+	assigned := []uint64{}
+
+	updateAssignees := `
+	UPDATE issues
+	SET assignees = (
+		SELECT COALESCE(jsonb_agg(CASE WHEN (a->>'id')::bigint = $1 THEN a || $2::jsonb ELSE a END ORDER BY ord), '[]'::jsonb)
+		FROM jsonb_array_elements(issues.assignees) WITH ORDINALITY AS e(a, ord)
+	)
+	WHERE id IN (SELECT issue_id FROM issue_assignees WHERE actor_id = $3)
+	RETURNING
+		id
+	`
+
+	err = tx.SelectContext(ctx, &assigned, updateAssignees, actor.GitHubID, profile, actor.ID)
+
+	if err != nil {
+		tx.Rollback()
+
+		return nil, err
+	}
+
+	commented := []uint64{}
+
+	updateComments := `
+	WITH updated AS (
+		UPDATE issue_comments SET author = author || $1::jsonb WHERE author_id=$2 RETURNING provider, host, issue_github_id
+	)
+	SELECT DISTINCT i.id FROM issues i JOIN updated u ON u.provider = i.provider AND u.host = i.host AND u.issue_github_id = i.github_id
+	`
+
+	err = tx.SelectContext(ctx, &commented, updateComments, profile, actor.ID)
+
+	if err != nil {
+		tx.Rollback()
+
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE actors SET propagated_at=$1 WHERE id=$2", actor.UpdatedAt, actor.ID)
+
+	if err != nil {
+		tx.Rollback()
+
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	unique := map[uint64]bool{}
+	issueIDs := []uint64{}
+
+	for _, issueID := range append(append(authored, assigned...), commented...) {
+		if !unique[issueID] {
+			unique[issueID] = true
+			issueIDs = append(issueIDs, issueID)
+		}
+	}
+
+	return issueIDs, nil
+}
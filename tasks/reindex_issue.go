@@ -2,15 +2,15 @@ package tasks
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 
 	"github.com/hibiken/asynq"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/macwilko/issues-sync/db/models"
-	"github.com/meilisearch/meilisearch-go"
+	"github.com/macwilko/issues-sync/search"
 )
 
 const (
@@ -19,6 +19,9 @@ const (
 
 type ReindexIssuePayload struct {
 	IssueID uint64
+	// IssueIDs batches the issues of a backfilled or reconciled page into
+	// one task, IssueID is kept for tasks queued before it
+	IssueIDs []uint64
 }
 
 func NewReindexIssue(IssueID uint64) (*asynq.Task, error) {
@@ -38,85 +41,107 @@ func NewReindexIssue(IssueID uint64) (*asynq.Task, error) {
 	return asynq.NewTask(ReindexIssue, payload), nil
 }
 
-func HandleReindexIssue(ctx context.Context, t *asynq.Task, db *sqlx.DB, meili *meilisearch.Client) error {
-	slog.Info("🏃 Starting reindexing issue ")
+func NewReindexIssues(IssueIDs []uint64) (*asynq.Task, error) {
+	payload, err := json.Marshal(ReindexIssuePayload{
+		IssueIDs: IssueIDs,
+	})
 
-	var p ReindexIssuePayload
+	slog.Info("Scheduling reindex issues",
+		slog.Int("issues", len(IssueIDs)))
 
-	if err := json.Unmarshal(t.Payload(), &p); err != nil {
-		slog.Error("Could not reindex issue",
+	if err != nil {
+		slog.Error("Unable to schedule reindex issues",
 			slog.String("error", err.Error()))
 
-		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+		return nil, err
 	}
 
-	issue := models.Issues{}
+	return asynq.NewTask(ReindexIssue, payload), nil
+}
 
-	err := db.Get(&issue, "SELECT * FROM issues WHERE id=$1", p.IssueID)
+func HandleReindexIssue(ctx context.Context, t *asynq.Task, db *sqlx.DB, backend search.Backend) error {
+	slog.Info("🏃 Starting reindexing issue ")
 
-	if err != nil && err != sql.ErrNoRows {
-		slog.Error("💀 An internal error happened",
-			slog.Uint64("issue_id", p.IssueID),
-			slog.String("error", err.Error()),
-		)
+	var p ReindexIssuePayload
 
-		return err
-	}
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		slog.Error("Could not reindex issue",
+			slog.String("error", err.Error()))
 
-	json, err := issue.ToMap()
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
 
-	if err != nil && err != sql.ErrNoRows {
-		slog.Error("💀 An internal error happened",
-			slog.Uint64("issue_id", p.IssueID),
-			slog.String("error", err.Error()),
-		)
+	issueIDs := p.IssueIDs
 
-		return err
+	if p.IssueID != 0 {
+		issueIDs = append(issueIDs, p.IssueID)
 	}
 
-	index := meili.Index("issues-" + issue.RepoOwner + "-" + issue.RepoName)
+	issues := []models.Issues{}
 
-	_, err = index.UpdateFilterableAttributes(&[]string{"repo_owner", "repo_name", "closed"})
+	err := db.SelectContext(ctx, &issues, "SELECT * FROM issues WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id ASC", pq.Array(issueIDs))
 
 	if err != nil {
-		slog.Error("💀 Couldnt update filterable attributed",
-			slog.Uint64("issue_id", issue.ID),
+		slog.Error("💀 An internal error happened",
+			slog.Any("issue_ids", issueIDs),
 			slog.String("error", err.Error()),
 		)
 
 		return err
 	}
 
-	documents := []map[string]interface{}{}
+	if len(issues) < len(issueIDs) {
+		slog.Info("💡 Issues were deleted, not reindexing them",
+			slog.Int("skipped", len(issueIDs)-len(issues)))
+	}
 
-	documents = append(documents, *json)
+	// A batch is normally one repository's, but documents go to the index of
+	// the repository they belong to
+	repos := []search.Repo{}
+	repoIssues := map[search.Repo][]models.Issues{}
 
-	taskInfo, err := index.UpdateDocuments(documents, "id")
+	for _, issue := range issues {
+		repo := search.Repo{
+			Provider: issue.Provider,
+			Host:     issue.Host,
+			Owner:    issue.RepoOwner,
+			Name:     issue.RepoName,
+		}
 
-	if err != nil {
-		slog.Error("💀 Couldn't trigger meilisearch index",
-			slog.Uint64("issue_id", issue.ID),
-			slog.String("error", err.Error()),
-		)
+		if _, ok := repoIssues[repo]; !ok {
+			repos = append(repos, repo)
+		}
 
-		return err
+		repoIssues[repo] = append(repoIssues[repo], issue)
 	}
 
-	task, err := meili.WaitForTask(taskInfo.TaskUID)
-
-	if err != nil {
-		slog.Error("💀 Couldn't trigger meilisearch index",
-			slog.Uint64("issue_id", issue.ID),
-			slog.String("error", err.Error()),
-		)
-
-		return err
+	for _, repo := range repos {
+		documents, err := issueSearchDocuments(ctx, db, repoIssues[repo])
+
+		if err != nil {
+			slog.Error("💀 An internal error happened",
+				slog.String("owner", repo.Owner),
+				slog.String("name", repo.Name),
+				slog.String("error", err.Error()),
+			)
+
+			return err
+		}
+
+		if err := backend.Index(ctx, repo, documents); err != nil {
+			slog.Error("💀 Couldn't index issues",
+				slog.String("backend", backend.Name()),
+				slog.String("owner", repo.Owner),
+				slog.String("name", repo.Name),
+				slog.String("error", err.Error()),
+			)
+
+			return err
+		}
 	}
 
-	slog.Info("Completed",
-		slog.String("duration", task.Duration))
-
-	slog.Info("Completed reindexing issue ✅")
+	slog.Info("Completed reindexing issue ✅",
+		slog.Int("issues", len(issues)))
 
 	return nil
 }
@@ -8,20 +8,28 @@ import (
 
 	"github.com/hibiken/asynq"
 	"github.com/jmoiron/sqlx"
-	"github.com/meilisearch/meilisearch-go"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/search"
 )
 
 const (
 	ReindexSearchDatabase = "search:reindex"
+
+	// Issues read from Postgres and sent to search at a time
+	reindexBatchSize = 500
 )
 
 type ReindexSearchDatabasePayload struct {
+	Provider  string
+	Host      string
 	RepoName  string
 	RepoOwner string
 }
 
-func NewReindexSearchDatabase(RepoOwner string, RepoName string) (*asynq.Task, error) {
+func NewReindexSearchDatabase(Provider string, Host string, RepoOwner string, RepoName string) (*asynq.Task, error) {
 	payload, err := json.Marshal(ReindexSearchDatabasePayload{
+		Provider:  Provider,
+		Host:      Host,
 		RepoName:  RepoName,
 		RepoOwner: RepoOwner,
 	})
@@ -38,8 +46,10 @@ func NewReindexSearchDatabase(RepoOwner string, RepoName string) (*asynq.Task, e
 	return asynq.NewTask(ReindexSearchDatabase, payload), nil
 }
 
-func HandleReindexSearchDatabase(ctx context.Context, t *asynq.Task, db *sqlx.DB, meili *meilisearch.Client) error {
-	slog.Info("Starting reindexing search database ✅")
+// HandleReindexSearchDatabase rebuilds a repository's search documents from
+// Postgres in batches, without taking search down, see search.Backend.
+func HandleReindexSearchDatabase(ctx context.Context, t *asynq.Task, db *sqlx.DB, backend search.Backend) error {
+	slog.Info("🏃 Starting reindexing search database")
 
 	var p ReindexSearchDatabasePayload
 
@@ -50,63 +60,37 @@ func HandleReindexSearchDatabase(ctx context.Context, t *asynq.Task, db *sqlx.DB
 		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
 	}
 
-	deleteIndex, err := meili.DeleteIndex("issues-" + p.RepoOwner + "-" + p.RepoName)
-
-	if err != nil {
-		slog.Error("💀 Couldn't trigger meilisearch index, error deleting index",
-			slog.String("repo_owner", p.RepoOwner),
-			slog.String("repo_name", p.RepoName),
-			slog.String("error", err.Error()),
-		)
-
-		return err
-	}
-
-	_, err = meili.WaitForTask(deleteIndex.TaskUID)
-
-	if err != nil {
-		slog.Error("💀 Couldn't trigger meilisearch index, error deleting index",
-			slog.String("repo_owner", p.RepoOwner),
-			slog.String("repo_name", p.RepoName),
-			slog.String("error", err.Error()),
-		)
-
-		return err
-	}
-
-	createIndex, err := meili.CreateIndex(&meilisearch.IndexConfig{
-		Uid:        "issues-" + p.RepoOwner + "-" + p.RepoName,
-		PrimaryKey: "id",
-	})
+	var lastID uint64
 
-	if err != nil {
-		slog.Error("💀 Couldn't trigger meilisearch index, error creating index",
-			slog.String("repo_owner", p.RepoOwner),
-			slog.String("repo_name", p.RepoName),
-			slog.String("error", err.Error()),
-		)
+	next := func() ([]search.Document, error) {
+		issues := []models.Issues{}
 
-		return err
-	}
+		err := db.SelectContext(ctx, &issues, `
+		SELECT * FROM issues
+		WHERE provider=$1 AND host=$2 AND lower(repo_owner)=lower($3) AND lower(repo_name)=lower($4) AND deleted_at IS NULL AND id > $5
+		ORDER BY id ASC
+		LIMIT $6
+		`, p.Provider, p.Host, p.RepoOwner, p.RepoName, lastID, reindexBatchSize)
 
-	_, err = meili.WaitForTask(createIndex.TaskUID)
+		if err != nil || len(issues) == 0 {
+			return nil, err
+		}
 
-	if err != nil {
-		slog.Error("💀 Couldn't trigger meilisearch index, error creating index",
-			slog.String("repo_owner", p.RepoOwner),
-			slog.String("repo_name", p.RepoName),
-			slog.String("error", err.Error()),
-		)
+		lastID = issues[len(issues)-1].ID
 
-		return err
+		return issueSearchDocuments(ctx, db, issues)
 	}
 
-	index := meili.Index("issues-" + p.RepoOwner + "-" + p.RepoName)
-
-	_, err = index.UpdateFilterableAttributes(&[]string{"repo_owner", "repo_name", "closed"})
+	indexed, err := backend.Rebuild(ctx, search.Repo{
+		Provider: p.Provider,
+		Host:     p.Host,
+		Owner:    p.RepoOwner,
+		Name:     p.RepoName,
+	}, next)
 
 	if err != nil {
-		slog.Error("💀 Couldnt update filterable attributed",
+		slog.Error("💀 Couldn't rebuild search index, will retry",
+			slog.String("backend", backend.Name()),
 			slog.String("repo_owner", p.RepoOwner),
 			slog.String("repo_name", p.RepoName),
 			slog.String("error", err.Error()),
@@ -115,7 +99,10 @@ func HandleReindexSearchDatabase(ctx context.Context, t *asynq.Task, db *sqlx.DB
 		return err
 	}
 
-	slog.Info("Completed reindexing search database 🚀")
+	slog.Info("✅ Completed reindexing search database",
+		slog.String("repo_owner", p.RepoOwner),
+		slog.String("repo_name", p.RepoName),
+		slog.Int("issues", indexed))
 
 	return nil
 }
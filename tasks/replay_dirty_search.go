@@ -0,0 +1,61 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/search"
+)
+
+const (
+	ReplayDirtySearch = "search:replay-dirty"
+)
+
+func NewReplayDirtySearch() *asynq.Task {
+	return asynq.NewTask(ReplayDirtySearch, nil)
+}
+
+// HandleReplayDirtySearch queues a rebuild of every repository whose primary
+// search index missed writes, see search.Failover. A rebuild that runs while
+// the primary is still down fails and is retried, the mark stays until one
+// finishes.
+func HandleReplayDirtySearch(ctx context.Context, t *asynq.Task, db *sqlx.DB, queue *asynq.Client) error {
+	slog.Info("🏃 Starting replaying dirty search indexes")
+
+	repos, err := search.DirtyRepos(ctx, db)
+
+	if err != nil {
+		slog.Error("💀 Couldn't list dirty search indexes, will retry",
+			slog.String("error", err.Error()))
+
+		return err
+	}
+
+	for _, repo := range repos {
+		task, err := NewReindexSearchDatabase(repo.Provider, repo.Host, repo.Owner, repo.Name)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = queue.EnqueueContext(ctx, task, asynq.Unique(time.Hour), asynq.Timeout(time.Hour), asynq.Queue("low"))
+
+		if err != nil && !errors.Is(err, asynq.ErrDuplicateTask) {
+			slog.Error("💀 Couldn't enqueue rebuild of dirty search index, will retry",
+				slog.String("owner", repo.Owner),
+				slog.String("name", repo.Name),
+				slog.String("error", err.Error()))
+
+			return err
+		}
+	}
+
+	slog.Info("✅ Completed replaying dirty search indexes",
+		slog.Int("repos", len(repos)))
+
+	return nil
+}
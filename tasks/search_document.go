@@ -0,0 +1,73 @@
+package tasks
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/macwilko/issues-sync/db/models"
+	"github.com/macwilko/issues-sync/search"
+)
+
+// issueSearchDocuments builds the documents for a batch of one repository's
+// issues, each with the text of its comments folded in so a search matches on
+// the whole thread. All their comments are loaded in one query.
+func issueSearchDocuments(ctx context.Context, db *sqlx.DB, issues []models.Issues) ([]search.Document, error) {
+	if len(issues) == 0 {
+		return []search.Document{}, nil
+	}
+
+	githubIDs := []int64{}
+
+	for _, issue := range issues {
+		githubIDs = append(githubIDs, int64(issue.GitHubID))
+	}
+
+	rows := []struct {
+		IssueGithubID uint64 `db:"issue_github_id"`
+		Body          string `db:"body"`
+	}{}
+
+	err := db.SelectContext(ctx, &rows, `
+	SELECT issue_github_id, body FROM issue_comments
+	WHERE provider=$1 AND host=$2 AND issue_github_id = ANY($3) AND deleted_at IS NULL
+	ORDER BY created_at ASC
+	`, issues[0].Provider, issues[0].Host, pq.Array(githubIDs))
+
+	if err != nil {
+		return nil, err
+	}
+
+	comments := map[uint64][]string{}
+
+	for _, row := range rows {
+		comments[row.IssueGithubID] = append(comments[row.IssueGithubID], row.Body)
+	}
+
+	documents := []search.Document{}
+
+	for _, issue := range issues {
+		document, err := issue.ToMap()
+
+		if err != nil {
+			return nil, err
+		}
+
+		(*document)["comments"] = append([]string{}, comments[issue.GitHubID]...)
+
+		// Numbers, so search can filter and sort on them
+		updatedAt := issue.CreatedAt
+
+		if issue.UpdatedAt.Valid {
+			updatedAt = issue.UpdatedAt.Time
+		}
+
+		(*document)[search.AttributeCreatedAt] = issue.CreatedAt.Unix()
+		(*document)[search.AttributeUpdatedAt] = updatedAt.Unix()
+		(*document)[search.AttributeReactions] = issue.ReactionsCount()
+
+		documents = append(documents, search.Document(*document))
+	}
+
+	return documents, nil
+}
@@ -0,0 +1,156 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryEnqueued  = "enqueued"
+	WebhookDeliveryProcessed = "processed"
+	WebhookDeliveryFailed    = "failed"
+	WebhookDeliveryIgnored   = "ignored"
+)
+
+// EnqueueWebhookDelivery schedules a stored delivery for processing. The asynq
+// task ID is the delivery ID, so a delivery can only be queued once at a time.
+// Replays pass replay=true to get a fresh task ID, as the original task may
+// still be kept in the archive.
+//
+// The delivery is marked enqueued before the task exists, so a worker that
+// finishes it straight away can't be overwritten. Only a replay reopens a
+// delivery that's already finished.
+func EnqueueWebhookDelivery(ctx context.Context, db *sqlx.DB, queue *asynq.Client, provider string, event string, deliveryID string, replay bool) error {
+	task, githubEvent, err := NewWebhookDelivery(provider, event, deliveryID)
+
+	if err != nil {
+		return err
+	}
+
+	taskID := deliveryID
+
+	if replay {
+		taskID = fmt.Sprintf("%s-replay-%d", deliveryID, time.Now().UnixNano())
+	}
+
+	result, err := db.ExecContext(ctx, `
+	UPDATE webhook_deliveries
+	SET status=$1, enqueued_at=now()
+	WHERE delivery_id=$2 AND ($3 OR status IN ($4, $1))
+	`, WebhookDeliveryEnqueued, deliveryID, replay, WebhookDeliveryPending)
+
+	if err != nil {
+		return err
+	}
+
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		slog.Info("💡 Delivery is already finished",
+			slog.String("event", event),
+			slog.String("delivery", deliveryID))
+
+		return nil
+	}
+
+	info, err := queue.EnqueueContext(ctx, task, asynq.TaskID(taskID), asynq.Queue(githubEvent.Queue))
+
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		slog.Info("💡 Delivery is already queued",
+			slog.String("event", event),
+			slog.String("delivery", deliveryID))
+
+		return nil
+	}
+
+	if err != nil {
+		// Hand it back to the drainer, unless a worker got to it already
+		db.ExecContext(ctx, "UPDATE webhook_deliveries SET status=$1 WHERE delivery_id=$2 AND status=$3",
+			WebhookDeliveryPending, deliveryID, WebhookDeliveryEnqueued)
+
+		return err
+	}
+
+	slog.Info("✅ Delivery is scheduled for processing",
+		slog.String("event", event),
+		slog.String("delivery", deliveryID),
+		slog.String("task-id", info.ID),
+		slog.String("queue", info.Queue))
+
+	_, err = db.ExecContext(ctx, "UPDATE webhook_deliveries SET attempts=attempts+1 WHERE delivery_id=$1", deliveryID)
+
+	return err
+}
+
+// webhookDelivery is a stored delivery's body and what's known of where it
+// came from.
+type webhookDelivery struct {
+	Payload    []byte    `db:"payload"`
+	RepoScoped bool      `db:"repo_scoped"`
+	ReceivedAt time.Time `db:"received_at"`
+	Replay     bool      `db:"-"`
+}
+
+func loadWebhookDelivery(ctx context.Context, db *sqlx.DB, deliveryID string) (webhookDelivery, error) {
+	delivery := webhookDelivery{}
+
+	err := db.GetContext(ctx, &delivery, "SELECT payload, repo_scoped, received_at FROM webhook_deliveries WHERE delivery_id=$1", deliveryID)
+
+	return delivery, err
+}
+
+// scope marks the payload's repository with what the delivery vouches for,
+// see forge.Repository. A replay's profiles are old news, it leaves
+// ActorsSeenAt zero.
+func (d webhookDelivery) scope(repo *forge.Repository) {
+	if repo == nil {
+		return
+	}
+
+	repo.RepoScoped = d.RepoScoped
+
+	if !d.Replay {
+		repo.ActorsSeenAt = d.ReceivedAt
+	}
+}
+
+// finishWebhookDelivery records the outcome of a processing attempt. A failure
+// only marks the delivery failed once asynq won't retry it again.
+func finishWebhookDelivery(ctx context.Context, db *sqlx.DB, deliveryID string, processErr error) {
+	var err error
+
+	if processErr == nil {
+		_, err = db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status=$1, processed_at=now(), last_error=NULL
+		WHERE delivery_id=$2
+		`, WebhookDeliveryProcessed, deliveryID)
+	} else {
+		status := WebhookDeliveryEnqueued
+
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+
+		if errors.Is(processErr, asynq.SkipRetry) || retried >= maxRetry {
+			status = WebhookDeliveryFailed
+		}
+
+		_, err = db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status=$1, last_error=$2
+		WHERE delivery_id=$3
+		`, status, processErr.Error(), deliveryID)
+	}
+
+	if err != nil {
+		slog.Warn("💀 Could not record webhook delivery outcome",
+			slog.String("delivery", deliveryID),
+			slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,162 @@
+package webhook_handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/metrics"
+	"github.com/macwilko/issues-sync/tasks"
+	"github.com/redis/go-redis/v9"
+)
+
+// Forge receives webhooks from GitLab and Gitea, it stores and enqueues them
+// the same way Github does but leaves verification and parsing to the adapter.
+func Forge(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client, adapter forge.Adapter) error {
+	provider := adapter.Provider()
+
+	slog.Info("🏃 Starting a forge webhook request",
+		slog.String("provider", provider))
+
+	c.Accepts("application/json")
+
+	headers := http.Header{}
+
+	for key, values := range c.GetReqHeaders() {
+		for _, value := range values {
+			headers.Add(key, value)
+		}
+	}
+
+	secrets, repoSecrets, err := webhookSecrets(ctx, db, adapter, c.Body())
+
+	if err != nil {
+		slog.Error("💀 Could not load webhook secrets",
+			slog.String("provider", provider),
+			slog.String("error", err.Error()))
+
+		return c.
+			Status(fiber.StatusInternalServerError).
+			JSON(&fiber.Map{"message": "an internal error happened"})
+	}
+
+	if len(secrets) == 0 && len(repoSecrets) == 0 {
+		slog.Warn("❌ No webhook secrets configured, rejecting delivery",
+			slog.String("provider", provider))
+	}
+
+	verified, repoScoped := verifyWebhook(func(secrets []string) bool {
+		return adapter.Verify(headers, c.Body(), secrets)
+	}, secrets, repoSecrets)
+
+	if !verified {
+		slog.Warn("❌ Invalid forge webhook signature",
+			slog.String("provider", provider),
+			slog.String("ip", c.IP()))
+
+		metrics.Incr(ctx, rdb, metrics.WebhookInvalidSignature)
+
+		return c.
+			Status(fiber.StatusUnauthorized).
+			JSON(&fiber.Map{"message": "invalid signature"})
+	}
+
+	deliveryID := adapter.DeliveryID(headers, c.Body())
+	event := adapter.Event(headers)
+
+	if deliveryID == "" || event == "" {
+		slog.Warn("❌ Missing forge delivery id or event",
+			slog.String("provider", provider),
+			slog.String("delivery", deliveryID),
+			slog.String("event", event))
+
+		return c.
+			Status(fiber.StatusBadRequest).
+			JSON(&fiber.Map{"message": "missing delivery id or event"})
+	}
+
+	status := tasks.WebhookDeliveryPending
+	handled := adapter.IsIssueEvent(event)
+
+	if !handled {
+		status = tasks.WebhookDeliveryIgnored
+	}
+
+	var repoOwner, repoName sql.NullString
+
+	if repo := adapter.Repository(c.Body()); repo != nil {
+		repoOwner = sql.NullString{String: repo.Owner.Login, Valid: true}
+		repoName = sql.NullString{String: repo.Name, Valid: true}
+	}
+
+	insertIntoDeliveries := `
+	INSERT INTO webhook_deliveries
+		(delivery_id, provider, event, status, repo_owner, repo_name, repo_scoped, payload)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (delivery_id) DO NOTHING
+	RETURNING
+		id
+	`
+
+	var id uint64
+
+	err = db.
+		QueryRowxContext(ctx, insertIntoDeliveries, deliveryID, provider, event, status, repoOwner, repoName, repoScoped, c.Body()).
+		Scan(&id)
+
+	if err == sql.ErrNoRows {
+		slog.Info("💡 Duplicate forge delivery, already stored",
+			slog.String("provider", provider),
+			slog.String("delivery", deliveryID))
+
+		return c.
+			Status(fiber.StatusOK).
+			JSON(&fiber.Map{"message": "duplicate"})
+	} else if err != nil {
+		slog.Error("💀 Could not store forge delivery",
+			slog.String("provider", provider),
+			slog.String("delivery", deliveryID),
+			slog.String("error", err.Error()))
+
+		return c.
+			Status(fiber.StatusInternalServerError).
+			JSON(&fiber.Map{"message": "an internal error happened"})
+	}
+
+	if !handled {
+		slog.Info("💡 Recorded unhandled forge event",
+			slog.String("provider", provider),
+			slog.String("delivery", deliveryID),
+			slog.String("event", event))
+
+		metrics.Incr(ctx, rdb, metrics.WebhookUnhandledEvent)
+
+		return c.
+			Status(fiber.StatusOK).
+			JSON(&fiber.Map{"message": "ignored"})
+	}
+
+	err = tasks.EnqueueWebhookDelivery(ctx, db, queue, provider, event, deliveryID, false)
+
+	if err != nil {
+		// The delivery is stored, the drainer will enqueue it once redis is back
+		slog.Error("💀 Could not enqueue forge delivery, left pending",
+			slog.String("provider", provider),
+			slog.String("delivery", deliveryID),
+			slog.String("error", err.Error()))
+
+		return c.
+			Status(fiber.StatusOK).
+			JSON(&fiber.Map{"message": "accepted"})
+	}
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"message": "ok"})
+}
@@ -0,0 +1,170 @@
+package webhook_handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/hibiken/asynq"
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+	"github.com/macwilko/issues-sync/metrics"
+	"github.com/macwilko/issues-sync/tasks"
+	"github.com/redis/go-redis/v9"
+)
+
+type githubPing struct {
+	Zen    string `json:"zen"`
+	HookID uint64 `json:"hook_id"`
+}
+
+func Github(c *fiber.Ctx, ctx context.Context, db *sqlx.DB, rdb *redis.Client, queue *asynq.Client) error {
+
+	slog.Info("🏃 Starting a github webhook request")
+
+	c.Accepts("application/json")
+
+	secrets, repoSecrets, err := webhookSecrets(ctx, db, forge.Github{}, c.Body())
+
+	if err != nil {
+		slog.Error("💀 Could not load webhook secrets",
+			slog.String("error", err.Error()))
+
+		return c.
+			Status(fiber.StatusInternalServerError).
+			JSON(&fiber.Map{"message": "an internal error happened"})
+	}
+
+	if len(secrets) == 0 && len(repoSecrets) == 0 {
+		slog.Warn("❌ No webhook secrets configured, rejecting delivery")
+	}
+
+	verified, repoScoped := verifyWebhook(func(secrets []string) bool {
+		return forge.VerifyGithubSignature(c.Body(), c.Get("X-Hub-Signature-256"), secrets)
+	}, secrets, repoSecrets)
+
+	if !verified {
+		slog.Warn("❌ Invalid github webhook signature",
+			slog.String("delivery", c.Get("X-GitHub-Delivery")),
+			slog.String("ip", c.IP()))
+
+		metrics.Incr(ctx, rdb, metrics.WebhookInvalidSignature)
+
+		return c.
+			Status(fiber.StatusUnauthorized).
+			JSON(&fiber.Map{"message": "invalid signature"})
+	}
+
+	deliveryID := utils.CopyString(c.Get("X-GitHub-Delivery"))
+	event := utils.CopyString(c.Get("X-GitHub-Event"))
+
+	if deliveryID == "" || event == "" {
+		slog.Warn("❌ Missing github delivery id or event",
+			slog.String("delivery", deliveryID),
+			slog.String("event", event))
+
+		return c.
+			Status(fiber.StatusBadRequest).
+			JSON(&fiber.Map{"message": "missing X-GitHub-Delivery or X-GitHub-Event"})
+	}
+
+	status := tasks.WebhookDeliveryPending
+	processedAt := sql.NullTime{}
+	_, handled := tasks.GithubEvents[event]
+
+	switch {
+	case event == "ping":
+		status = tasks.WebhookDeliveryProcessed
+		processedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	case !handled:
+		status = tasks.WebhookDeliveryIgnored
+	}
+
+	var repoOwner, repoName sql.NullString
+
+	if repo := (forge.Github{}).Repository(c.Body()); repo != nil {
+		repoOwner = sql.NullString{String: repo.Owner.Login, Valid: true}
+		repoName = sql.NullString{String: repo.Name, Valid: true}
+	}
+
+	insertIntoDeliveries := `
+	INSERT INTO webhook_deliveries
+		(delivery_id, event, status, processed_at, repo_owner, repo_name, repo_scoped, payload)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (delivery_id) DO NOTHING
+	RETURNING
+		id
+	`
+
+	var id uint64
+
+	err = db.
+		QueryRowxContext(ctx, insertIntoDeliveries, deliveryID, event, status, processedAt, repoOwner, repoName, repoScoped, c.Body()).
+		Scan(&id)
+
+	if err == sql.ErrNoRows {
+		slog.Info("💡 Duplicate github delivery, already stored",
+			slog.String("delivery", deliveryID))
+
+		return c.
+			Status(fiber.StatusOK).
+			JSON(&fiber.Map{"message": "duplicate"})
+	} else if err != nil {
+		// Not acknowledging lets the delivery be redelivered from GitHub
+		slog.Error("💀 Could not store github delivery",
+			slog.String("delivery", deliveryID),
+			slog.String("error", err.Error()))
+
+		return c.
+			Status(fiber.StatusInternalServerError).
+			JSON(&fiber.Map{"message": "an internal error happened"})
+	}
+
+	if event == "ping" {
+		var ping githubPing
+
+		json.Unmarshal(c.Body(), &ping)
+
+		slog.Info("✅ Answered github ping",
+			slog.String("delivery", deliveryID),
+			slog.Uint64("hook_id", ping.HookID))
+
+		return c.
+			Status(fiber.StatusOK).
+			JSON(&fiber.Map{"message": "pong", "zen": ping.Zen})
+	}
+
+	if !handled {
+		slog.Info("💡 Recorded unhandled github event",
+			slog.String("delivery", deliveryID),
+			slog.String("event", event))
+
+		metrics.Incr(ctx, rdb, metrics.WebhookUnhandledEvent)
+
+		return c.
+			Status(fiber.StatusOK).
+			JSON(&fiber.Map{"message": "ignored"})
+	}
+
+	err = tasks.EnqueueWebhookDelivery(ctx, db, queue, forge.ProviderGithub, event, deliveryID, false)
+
+	if err != nil {
+		// The delivery is stored, the drainer will enqueue it once redis is back
+		slog.Error("💀 Could not enqueue github delivery, left pending",
+			slog.String("delivery", deliveryID),
+			slog.String("error", err.Error()))
+
+		return c.
+			Status(fiber.StatusOK).
+			JSON(&fiber.Map{"message": "accepted"})
+	}
+
+	return c.
+		Status(fiber.StatusOK).
+		JSON(&fiber.Map{"message": "ok"})
+}
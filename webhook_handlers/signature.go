@@ -0,0 +1,59 @@
+package webhook_handlers
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/macwilko/issues-sync/forge"
+)
+
+// webhookSecrets returns the global secrets for the adapter's forge, e.g.
+// GITHUB_WEBHOOK_SECRETS, and the secrets registered for the repository named
+// in the payload.
+func webhookSecrets(ctx context.Context, db *sqlx.DB, adapter forge.Adapter, body []byte) ([]string, []string, error) {
+	secrets := []string{}
+
+	for _, secret := range strings.Split(os.Getenv(strings.ToUpper(adapter.Provider())+"_WEBHOOK_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	repo := adapter.Repository(body)
+
+	if repo == nil {
+		return secrets, nil, nil
+	}
+
+	repoSecrets := []string{}
+
+	err := db.SelectContext(ctx, &repoSecrets, "SELECT secret FROM webhook_secrets WHERE provider=$1 AND host=$2 AND repo_owner=$3 AND repo_name=$4",
+		repo.Provider,
+		repo.Host,
+		strings.ToLower(repo.Owner.Login),
+		strings.ToLower(repo.Name))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return secrets, repoSecrets, nil
+}
+
+// verifyWebhook checks a delivery against the global secrets, then against the
+// repository's. The repository is taken from the payload before it's verified,
+// so a delivery only its secret vouches for is repo scoped: it may only change
+// rows of that repository.
+func verifyWebhook(verify func(secrets []string) bool, secrets []string, repoSecrets []string) (bool, bool) {
+	if len(secrets) > 0 && verify(secrets) {
+		return true, false
+	}
+
+	if len(repoSecrets) > 0 && verify(repoSecrets) {
+		return true, true
+	}
+
+	return false, false
+}
@@ -0,0 +1,44 @@
+package webhook_handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/macwilko/issues-sync/forge"
+)
+
+func sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"repository":{"name":"hello","owner":{"login":"octo"}}}`)
+
+	tests := []struct {
+		name       string
+		signedWith string
+		verified   bool
+		repoScoped bool
+	}{
+		{name: "global secret", signedWith: "global", verified: true},
+		{name: "repository secret", signedWith: "octo-hello", verified: true, repoScoped: true},
+		{name: "unknown secret", signedWith: "other"},
+	}
+
+	for _, test := range tests {
+		signature := sign(body, test.signedWith)
+
+		verified, repoScoped := verifyWebhook(func(secrets []string) bool {
+			return forge.VerifyGithubSignature(body, signature, secrets)
+		}, []string{"global"}, []string{"octo-hello"})
+
+		if verified != test.verified || repoScoped != test.repoScoped {
+			t.Errorf("%s: verifyWebhook() = %t, %t, want %t, %t", test.name, verified, repoScoped, test.verified, test.repoScoped)
+		}
+	}
+}